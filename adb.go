@@ -0,0 +1,439 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Shell protocol v2 packet ids
+const (
+	shellIdStdin      = 0
+	shellIdStdout     = 1
+	shellIdStderr     = 2
+	shellIdExit       = 3
+	shellIdCloseStdin = 4
+)
+
+// legacyExitMarker prefixes the exit status appended to legacy shell output
+const legacyExitMarker = "__DRIVER_EXIT__"
+
+// AdbError represents a FAIL response returned by the ADB server
+type AdbError struct {
+	Request string // request that was rejected
+	Message string // failure message sent by the server
+}
+
+// Error implements the error interface
+func (e *AdbError) Error() string {
+	return fmt.Sprintf("adb: %s: %s", e.Request, e.Message)
+}
+
+// adbClient is a pure-Go client for the ADB server wire protocol
+type adbClient struct {
+	addr string // ADB server address (host:port)
+
+	startMu sync.Mutex // serializes starts of a local ADB server
+
+	mu       sync.Mutex          // guards features
+	features map[string][]string // cached device features by serial
+}
+
+// adbConn is a single connection to the ADB server
+type adbConn struct {
+	net.Conn
+	stop func() bool // detaches the context watcher
+}
+
+// newAdbClient creates an ADB client for the server at the given address
+// Parameters:
+//   - addr: ADB server address (host:port)
+//
+// Returns:
+//   - *adbClient: client ready to issue requests
+func newAdbClient(addr string) *adbClient {
+	return &adbClient{
+		addr:     addr,
+		features: make(map[string][]string),
+	}
+}
+
+// parseServerAddr parses an ADB server address given as "host:port", or in the
+// ADB_SERVER_SOCKET format "tcp:host:port" or "tcp:port"
+func parseServerAddr(s string) string {
+	s = strings.TrimPrefix(s, "tcp:")
+	if _, err := strconv.Atoi(s); err == nil {
+		return net.JoinHostPort("127.0.0.1", s)
+	}
+	return s
+}
+
+// isLocal reports whether the server runs on this machine
+func (c *adbClient) isLocal() bool {
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serverHost returns the host of the server, on which forwarded ports listen
+func (c *adbClient) serverHost() string {
+	host, _, err := net.SplitHostPort(c.addr)
+	if err != nil || c.isLocal() {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// serverArgs returns the options making the adb binary use this server
+func (c *adbClient) serverArgs() []string {
+	if c.addr == ADB_SERVER_ADDR {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(c.addr)
+	if err != nil {
+		return nil
+	}
+	return []string{"-H", host, "-P", port}
+}
+
+// dial opens a new connection to the ADB server.
+// If a local server is not reachable, it starts it with the adb binary. Callers
+// arriving during a start wait for it instead of failing, and a failed start is
+// tried again by the next dial, as is a server that was killed later.
+// The connection is closed as soon as ctx is done, which unblocks pending reads and writes.
+func (c *adbClient) dial(ctx context.Context) (*adbConn, error) {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		if !c.isLocal() {
+			return nil, err
+		}
+
+		conn, err = c.startServer(ctx, &dialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ac := &adbConn{Conn: conn}
+	ac.stop = context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	return ac, nil
+}
+
+// startServer starts the local ADB server and connects to it, one start at a time
+func (c *adbClient) startServer(ctx context.Context, dialer *net.Dialer) (net.Conn, error) {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+
+	// The server may have been started by another caller while waiting for the lock
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err == nil {
+		return conn, nil
+	}
+
+	args := append(c.serverArgs(), "start-server")
+	if out, startErr := exec.CommandContext(ctx, "adb", args...).CombinedOutput(); startErr != nil {
+		return nil, fmt.Errorf("%w (adb start-server: %v %s)", err, startErr, bytes.TrimSpace(out))
+	}
+
+	return dialer.DialContext(ctx, "tcp", c.addr)
+}
+
+// Close detaches the context watcher and closes the connection
+func (c *adbConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// send writes a length-prefixed request and waits for the server status
+func (c *adbConn) send(req string) error {
+	if _, err := fmt.Fprintf(c, "%04x%s", len(req), req); err != nil {
+		return err
+	}
+
+	return c.readStatus(req)
+}
+
+// readStatus reads an OKAY/FAIL status, turning FAIL into an *AdbError
+func (c *adbConn) readStatus(req string) error {
+	status := make([]byte, 4)
+	if _, err := io.ReadFull(c, status); err != nil {
+		return err
+	}
+
+	switch string(status) {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		msg, err := c.readString()
+		if err != nil {
+			return err
+		}
+		return &AdbError{Request: req, Message: msg}
+	}
+
+	return fmt.Errorf("adb: unexpected status %q for %s", status, req)
+}
+
+// readString reads a string prefixed with its length as 4 hex digits
+func (c *adbConn) readString() (string, error) {
+	size := make([]byte, 4)
+	if _, err := io.ReadFull(c, size); err != nil {
+		return "", err
+	}
+
+	n, err := strconv.ParseUint(string(size), 16, 32)
+	if err != nil {
+		return "", fmt.Errorf("adb: invalid length %q", size)
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c, data); err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// host sends a host request (e.g. "host:devices") and returns its payload
+func (c *adbClient) host(ctx context.Context, req string) (string, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err := conn.send(req); err != nil {
+		return "", err
+	}
+
+	return conn.readString()
+}
+
+// transport opens a connection switched to the given device.
+// An empty serial selects the only connected device.
+func (c *adbClient) transport(ctx context.Context, serial string) (*adbConn, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := "host:transport-any"
+	if serial != "" {
+		req = "host:transport:" + serial
+	}
+
+	if err := conn.send(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// service opens a device service (e.g. "shell:ls") and reads until the device closes the stream
+func (c *adbClient) service(ctx context.Context, serial, req string) ([]byte, error) {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.send(req); err != nil {
+		return nil, err
+	}
+
+	output, err := io.ReadAll(conn)
+	if err != nil && ctx.Err() != nil {
+		return output, ctx.Err()
+	}
+
+	return output, err
+}
+
+// devices returns the raw device list as printed by "adb devices",
+// or by "adb devices -l" when long is set
+func (c *adbClient) devices(ctx context.Context, long bool) (string, error) {
+	if long {
+		return c.host(ctx, "host:devices-l")
+	}
+	return c.host(ctx, "host:devices")
+}
+
+// trackDevices follows "host:track-devices-l", calling fn with every device list
+// sent by the server, the first one being the current list.
+// It returns when ctx is done or the server closes the stream.
+func (c *adbClient) trackDevices(ctx context.Context, fn func(list string)) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.send("host:track-devices-l"); err != nil {
+		return err
+	}
+
+	for {
+		list, err := conn.readString()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		fn(list)
+	}
+}
+
+// shell runs a command line through the device shell, stdout and stderr combined
+func (c *adbClient) shell(ctx context.Context, serial, cmdline string) ([]byte, error) {
+	return c.service(ctx, serial, "shell:"+cmdline)
+}
+
+// exec runs a command on the device without a shell or pty, keeping binary output intact
+func (c *adbClient) exec(ctx context.Context, serial, cmdline string) ([]byte, error) {
+	return c.service(ctx, serial, "exec:"+cmdline)
+}
+
+// hasFeature reports whether the device supports the given feature (e.g. "shell_v2").
+// The feature list is fetched once per device and cached.
+func (c *adbClient) hasFeature(ctx context.Context, serial, feature string) (bool, error) {
+	c.mu.Lock()
+	features, ok := c.features[serial]
+	c.mu.Unlock()
+
+	if !ok {
+		req := "host:features"
+		if serial != "" {
+			req = "host-serial:" + serial + ":features"
+		}
+
+		list, err := c.host(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		features = strings.Split(strings.TrimSpace(list), ",")
+
+		c.mu.Lock()
+		c.features[serial] = features
+		c.mu.Unlock()
+	}
+
+	for _, f := range features {
+		if f == feature {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// run executes a command line in the device shell and returns its structured result.
+// It uses the shell v2 protocol when the device supports it, which keeps stdout and
+// stderr apart and reports the exit status. Older devices fall back to the legacy
+// shell, where stderr is merged into stdout and the exit status is echoed by the shell.
+func (c *adbClient) run(ctx context.Context, serial, cmdline string) (*Result, error) {
+	v2, err := c.hasFeature(ctx, serial, "shell_v2")
+	if err != nil {
+		return nil, err
+	}
+
+	if v2 {
+		return c.shellV2(ctx, serial, cmdline)
+	}
+
+	output, err := c.shell(ctx, serial, fmt.Sprintf("%s; printf '\\n%s%%d\\n' $?", cmdline, legacyExitMarker))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLegacyOutput(output), nil
+}
+
+// parseLegacyOutput splits the exit status appended by run from legacy shell output
+func parseLegacyOutput(output []byte) *Result {
+	output = bytes.ReplaceAll(output, []byte("\r\n"), []byte("\n"))
+
+	i := bytes.LastIndex(output, []byte("\n"+legacyExitMarker))
+	if i < 0 {
+		return &Result{Stdout: string(output)}
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(string(output[i+len(legacyExitMarker)+1:])))
+	if err != nil {
+		code = -1
+	}
+
+	return &Result{Stdout: string(output[:i]), ExitCode: code}
+}
+
+// shellV2 runs a command line with the shell v2 protocol.
+// Every packet is a one byte id, a little endian length and the payload.
+func (c *adbClient) shellV2(ctx context.Context, serial, cmdline string) (*Result, error) {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.send("shell,v2,raw:" + cmdline); err != nil {
+		return nil, err
+	}
+
+	// Nothing is written to stdin, close it so commands reading it do not block
+	if _, err := conn.Write([]byte{shellIdCloseStdin, 0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+
+		data := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+		if _, err := io.ReadFull(conn, data); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+
+		switch header[0] {
+		case shellIdStdout:
+			stdout.Write(data)
+		case shellIdStderr:
+			stderr.Write(data)
+		case shellIdExit:
+			code := 0
+			if len(data) > 0 {
+				code = int(data[0])
+			}
+			return &Result{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: code}, nil
+		}
+	}
+}
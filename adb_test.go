@@ -0,0 +1,495 @@
+package driver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAdbHandler answers a request sent to a fakeAdbServer, writing the whole
+// response to conn, which is closed when it returns
+type fakeAdbHandler func(t *testing.T, conn net.Conn, req string)
+
+// fakeAdbServer is a loopback server speaking the ADB server wire protocol.
+// Transport requests are accepted and the connection keeps serving the
+// following request, like the real server does.
+type fakeAdbServer struct {
+	t        *testing.T
+	listener net.Listener
+
+	mu       sync.Mutex
+	handlers map[string]fakeAdbHandler
+	requests []string
+}
+
+// newFakeAdbServer starts a fake server on a free loopback port, stopped with the test
+func newFakeAdbServer(t *testing.T) *fakeAdbServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeAdbServer{t: t, listener: l, handlers: make(map[string]fakeAdbHandler)}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+
+	return s
+}
+
+// client returns an adbClient connected to the fake server
+func (s *fakeAdbServer) client() *adbClient {
+	return newAdbClient(s.listener.Addr().String())
+}
+
+// on answers a request with a handler
+func (s *fakeAdbServer) on(req string, handler fakeAdbHandler) *fakeAdbServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[req] = handler
+	return s
+}
+
+// onString answers a request with OKAY and a length-prefixed payload
+func (s *fakeAdbServer) onString(req, payload string) *fakeAdbServer {
+	return s.on(req, func(t *testing.T, conn net.Conn, _ string) {
+		fmt.Fprintf(conn, "OKAY%04x%s", len(payload), payload)
+	})
+}
+
+// received returns the requests received so far, in order
+func (s *fakeAdbServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func (s *fakeAdbServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeAdbServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+		n, err := strconv.ParseUint(string(size), 16, 32)
+		if err != nil {
+			return
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		req := string(data)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		handler := s.handlers[req]
+		s.mu.Unlock()
+
+		if req == "host:transport-any" || strings.HasPrefix(req, "host:transport:") {
+			io.WriteString(conn, "OKAY")
+			continue
+		}
+
+		if handler == nil {
+			msg := "unknown request " + req
+			fmt.Fprintf(conn, "FAIL%04x%s", len(msg), msg)
+			return
+		}
+
+		handler(s.t, conn, req)
+		return
+	}
+}
+
+// writeShellPacket writes a shell v2 packet
+func writeShellPacket(conn net.Conn, id byte, data string) {
+	header := make([]byte, 5)
+	header[0] = id
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(data)))
+	conn.Write(append(header, data...))
+}
+
+func TestAdbHostRequests(t *testing.T) {
+	server := newFakeAdbServer(t).
+		onString("host:devices", "emulator-5554\tdevice\n").
+		onString("host:devices-l", "emulator-5554 device product:sdk model:Pixel\n")
+	c := server.client()
+
+	tests := []struct {
+		name string
+		long bool
+		want string
+	}{
+		{"short", false, "emulator-5554\tdevice\n"},
+		{"long", true, "emulator-5554 device product:sdk model:Pixel\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.devices(context.Background(), tt.long)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("devices() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdbFailResponse(t *testing.T) {
+	c := newFakeAdbServer(t).client()
+
+	_, err := c.host(context.Background(), "host:version")
+
+	var adbErr *AdbError
+	if !errors.As(err, &adbErr) {
+		t.Fatalf("host() error = %v, want *AdbError", err)
+	}
+	if adbErr.Request != "host:version" || adbErr.Message != "unknown request host:version" {
+		t.Errorf("host() error = %+v", adbErr)
+	}
+}
+
+func TestAdbTransport(t *testing.T) {
+	tests := []struct {
+		name   string
+		serial string
+		want   []string
+	}{
+		{"serial", "emulator-5554", []string{"host:transport:emulator-5554", "exec:getprop"}},
+		{"any", "", []string{"host:transport-any", "exec:getprop"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAdbServer(t).on("exec:getprop", func(t *testing.T, conn net.Conn, _ string) {
+				io.WriteString(conn, "OKAY[ro.product.model]: [Pixel]\n")
+			})
+
+			out, err := server.client().exec(context.Background(), tt.serial, "getprop")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != "[ro.product.model]: [Pixel]\n" {
+				t.Errorf("exec() = %q", out)
+			}
+			if got := server.received(); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("requests = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdbRunShellV2(t *testing.T) {
+	server := newFakeAdbServer(t).
+		onString("host-serial:emulator-5554:features", "cmd,shell_v2,stat_v2").
+		on("shell,v2,raw:ls /nope", func(t *testing.T, conn net.Conn, _ string) {
+			io.WriteString(conn, "OKAY")
+
+			// The client closes stdin first
+			closeStdin := make([]byte, 5)
+			if _, err := io.ReadFull(conn, closeStdin); err != nil || closeStdin[0] != shellIdCloseStdin {
+				t.Errorf("close stdin packet = %v, %v", closeStdin, err)
+			}
+
+			writeShellPacket(conn, shellIdStdout, "partial\n")
+			writeShellPacket(conn, shellIdStderr, "ls: /nope: No such file or directory\n")
+			writeShellPacket(conn, shellIdExit, "\x01")
+		})
+
+	res, err := server.client().run(context.Background(), "emulator-5554", "ls /nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Result{Stdout: "partial\n", Stderr: "ls: /nope: No such file or directory\n", ExitCode: 1}
+	if *res != want {
+		t.Errorf("run() = %+v, want %+v", *res, want)
+	}
+}
+
+func TestAdbRunLegacyShell(t *testing.T) {
+	cmdline := "echo hi; printf '\\n" + legacyExitMarker + "%d\\n' $?"
+	server := newFakeAdbServer(t).
+		onString("host:features", "cmd").
+		on("shell:"+cmdline, func(t *testing.T, conn net.Conn, _ string) {
+			io.WriteString(conn, "OKAYhi\r\n\r\n"+legacyExitMarker+"2\r\n")
+		})
+
+	res, err := server.client().run(context.Background(), "", "echo hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Stdout != "hi\n" || res.ExitCode != 2 {
+		t.Errorf("run() = %+v", *res)
+	}
+}
+
+func TestParseLegacyOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   Result
+	}{
+		{"success", "a\nb\n\n" + legacyExitMarker + "0\n", Result{Stdout: "a\nb\n"}},
+		{"failure", "\n" + legacyExitMarker + "127\n", Result{ExitCode: 127}},
+		{"crlf", "a\r\n\r\n" + legacyExitMarker + "1\r\n", Result{Stdout: "a\n", ExitCode: 1}},
+		{"no marker", "killed\n", Result{Stdout: "killed\n"}},
+		{"bad status", "a\n\n" + legacyExitMarker + "x\n", Result{Stdout: "a\n", ExitCode: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseLegacyOutput([]byte(tt.output)); *got != tt.want {
+				t.Errorf("parseLegacyOutput() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdbTrackDevices(t *testing.T) {
+	lists := []string{"", "emulator-5554 device\n", "emulator-5554 offline\n"}
+	server := newFakeAdbServer(t).on("host:track-devices-l", func(t *testing.T, conn net.Conn, _ string) {
+		io.WriteString(conn, "OKAY")
+		for _, list := range lists {
+			fmt.Fprintf(conn, "%04x%s", len(list), list)
+		}
+	})
+
+	var got []string
+	err := server.client().trackDevices(context.Background(), func(list string) {
+		got = append(got, list)
+	})
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("trackDevices() error = %v, want io.EOF once the server closes the stream", err)
+	}
+	if strings.Join(got, "|") != strings.Join(lists, "|") {
+		t.Errorf("lists = %q, want %q", got, lists)
+	}
+}
+
+func TestAdbCanceledRequest(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	server := newFakeAdbServer(t).on("shell:sleep 100", func(t *testing.T, conn net.Conn, _ string) {
+		io.WriteString(conn, "OKAY")
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := server.client().shell(ctx, "", "sleep 100"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shell() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestParseServerAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"127.0.0.1:5037", "127.0.0.1:5037"},
+		{"tcp:10.0.0.2:5037", "10.0.0.2:5037"},
+		{"tcp:5038", "127.0.0.1:5038"},
+		{"localhost:5037", "localhost:5037"},
+	}
+
+	for _, tt := range tests {
+		if got := parseServerAddr(tt.in); got != tt.want {
+			t.Errorf("parseServerAddr(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAdbClientIsLocal(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:5037", true},
+		{"localhost:5037", true},
+		{"[::1]:5037", true},
+		{"10.0.0.2:5037", false},
+		{"adb-host:5037", false},
+	}
+
+	for _, tt := range tests {
+		if got := newAdbClient(tt.addr).isLocal(); got != tt.want {
+			t.Errorf("isLocal(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+// fakeAdbBinary puts an adb script first in PATH, counting its runs in a file
+// and exiting with the given status once the file ready exists
+func fakeAdbBinary(t *testing.T, status int) (runs, ready string) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake adb binary is a shell script")
+	}
+
+	dir := t.TempDir()
+	runs = filepath.Join(dir, "runs")
+	ready = filepath.Join(dir, "ready")
+
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %q\nwhile [ ! -f %q ]; do sleep 0.01; done\nexit %d\n", runs, ready, status)
+	if err := os.WriteFile(filepath.Join(dir, "adb"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return runs, ready
+}
+
+// freeAddr returns a loopback address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	return addr
+}
+
+// countRuns returns the number of runs of the fake adb binary
+func countRuns(t *testing.T, runs string) int {
+	t.Helper()
+
+	data, err := os.ReadFile(runs)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Count(string(data), "start-server")
+}
+
+func TestAdbDialStartsServerOnce(t *testing.T) {
+	runs, ready := fakeAdbBinary(t, 0)
+	addr := freeAddr(t)
+	c := newAdbClient(addr)
+
+	// Start the server when the first adb run begins, then let adb exit
+	go func() {
+		for countRuns(t, runs) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		os.WriteFile(ready, nil, 0644)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Callers arriving during the start wait for it
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := c.dial(ctx)
+			if err == nil {
+				conn.Close()
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("dial() error = %v", err)
+		}
+	}
+	if n := countRuns(t, runs); n != 1 {
+		t.Errorf("adb start-server ran %d times, want 1", n)
+	}
+}
+
+func TestAdbDialRetriesFailedStart(t *testing.T) {
+	runs, ready := fakeAdbBinary(t, 1)
+	os.WriteFile(ready, nil, 0644)
+	c := newAdbClient(freeAddr(t))
+
+	for i := 1; i <= 2; i++ {
+		_, err := c.dial(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "adb start-server") {
+			t.Errorf("dial() #%d error = %v, want the start-server failure", i, err)
+		}
+		if n := countRuns(t, runs); n != i {
+			t.Errorf("adb start-server ran %d times after %d dials, want %d", n, i, i)
+		}
+	}
+}
+
+func TestAdbDialRemoteDoesNotStartServer(t *testing.T) {
+	runs, ready := fakeAdbBinary(t, 0)
+	os.WriteFile(ready, nil, 0644)
+
+	// 192.0.2.0/24 is reserved for documentation, the dial times out
+	c := newAdbClient("192.0.2.1:5037")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.dial(ctx); err == nil {
+		t.Fatal("dial() succeeded without a server")
+	}
+	if n := countRuns(t, runs); n != 0 {
+		t.Errorf("adb start-server ran %d times for a remote server, want 0", n)
+	}
+}
@@ -1,6 +1,9 @@
 package driver
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -12,16 +15,33 @@ import (
 // Returns:
 //   - bool: true if app successfully started within timeout, false otherwise
 func (d *Driver) StartApp(app string) bool {
-	d.StopApp(app)
+	return d.StartAppContext(context.Background(), app)
+}
 
-	activity := d.getMainActivity(app)
-	d.Run("am", "start", "-n", activity)
+// StartAppContext launches an Android application like StartApp, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the launch and the wait for the app
+//   - app: full package name of the application (e.g. "com.example.app/.MainActivity")
+//
+// Returns:
+//   - bool: true if app successfully started within timeout, false otherwise
+func (d *Driver) StartAppContext(ctx context.Context, app string) bool {
+	d.StopAppContext(ctx, app)
+
+	activity := d.getMainActivity(ctx, app)
+	d.RunContext(ctx, "am", "start", "-n", activity)
 
-	for i := 0; i < WAIT_TIMEOUT; i++ {
-		if d.isRunning(app) {
+	deadline := time.Now().Add(d.config.WaitTimeout)
+	for time.Now().Before(deadline) {
+		if d.isRunning(ctx, app) {
 			return true
 		}
-		time.Sleep(time.Second)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
 	}
 	return false
 }
@@ -30,44 +50,93 @@ func (d *Driver) StartApp(app string) bool {
 // Parameters:
 //   - app: package name of the application to stop
 func (d *Driver) StopApp(app string) {
-	d.Run("am", "force-stop", app)
+	d.StopAppContext(context.Background(), app)
+}
+
+// StopAppContext forcefully stops an application like StopApp, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the command lifetime
+//   - app: package name of the application to stop
+func (d *Driver) StopAppContext(ctx context.Context, app string) {
+	d.RunContext(ctx, "am", "force-stop", app)
 }
 
 // RestartApp restarts an Android application by stopping and starting it
 // Parameters:
 //   - app: full package name of the application to restart
 func (d *Driver) RestartApp(app string) {
-	d.StopApp(app)
-	d.StartApp(app)
+	d.RestartAppContext(context.Background(), app)
+}
+
+// RestartAppContext restarts an application like RestartApp, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the restart
+//   - app: full package name of the application to restart
+func (d *Driver) RestartAppContext(ctx context.Context, app string) {
+	d.StopAppContext(ctx, app)
+	d.StartAppContext(ctx, app)
 }
 
 // InstallApp installs an APK file on the Android device
 // Parameters:
 //   - app: path to the APK file to install
 //   - isDel: whether to delete the APK file after installation
-func (d *Driver) InstallApp(app string, isDel bool) {
-	d.Run("pm", "install", app)
+//
+// Returns:
+//   - error: nil if successful, ErrInstallFailed with the output of pm if the
+//     package manager rejected the APK, otherwise the command error
+func (d *Driver) InstallApp(app string, isDel bool) error {
+	return d.InstallAppContext(context.Background(), app, isDel)
+}
+
+// InstallAppContext installs an APK file like InstallApp, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the installation
+//   - app: path to the APK file to install
+//   - isDel: whether to delete the APK file after installation, even if it failed
+//
+// Returns:
+//   - error: same errors as InstallApp, or ctx.Err() if ctx is done
+func (d *Driver) InstallAppContext(ctx context.Context, app string, isDel bool) error {
+	output, err := d.RunContext(ctx, "pm", "install", app)
 
 	if isDel {
-		d.DeleteFile(app)
+		d.DeleteFileContext(ctx, app)
 	}
+
+	// Older versions of pm report failures with exit status 0
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) || (err == nil && strings.Contains(output, "Failure")) {
+		return fmt.Errorf("%w: %s: %s", ErrInstallFailed, app, output)
+	}
+
+	return err
 }
 
 // UninstallApp uninstalls an installed Android application
 // Parameters:
 //   - app: package name of the application to uninstall
 func (d *Driver) UninstallApp(app string) {
-	d.Run("pm", "uninstall", app)
+	d.UninstallAppContext(context.Background(), app)
+}
+
+// UninstallAppContext uninstalls an application like UninstallApp, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the command lifetime
+//   - app: package name of the application to uninstall
+func (d *Driver) UninstallAppContext(ctx context.Context, app string) {
+	d.RunContext(ctx, "pm", "uninstall", app)
 }
 
 // IsRunning checks if an application is currently running in the foreground
 // Parameters:
+//   - ctx: context controlling the command lifetime
 //   - app: package name of the application to check
 //
 // Returns:
 //   - bool: true if the app is running, false otherwise
-func (d *Driver) isRunning(app string) bool {
-	output, err := d.Run("dumpsys", "window", "|", "grep", "-E", "'mCurrentFocus'")
+func (d *Driver) isRunning(ctx context.Context, app string) bool {
+	output, err := d.PipeContext(ctx, Cmd("dumpsys", "window"), Cmd("grep", "-E", "mCurrentFocus"))
 	if err != nil {
 		return false
 	}
@@ -77,13 +146,17 @@ func (d *Driver) isRunning(app string) bool {
 
 // getMainActivity returns the main activity of an Android application
 // Parameters:
+//   - ctx: context controlling the command lifetime
 //   - app: full package name of the application (e.g. "com.example.app/.MainActivity")
 //
 // Returns:
 //   - string: main activity of the application
-func (d *Driver) getMainActivity(app string) string {
-	output, _ := d.Run("cmd", "package", "resolve-activity", "--brief", app)
-	activity := strings.Split(output, "\n")[1]
+func (d *Driver) getMainActivity(ctx context.Context, app string) string {
+	output, _ := d.RunContext(ctx, "cmd", "package", "resolve-activity", "--brief", app)
+	lines := strings.Split(output, "\n")
+	if len(lines) < 2 {
+		return app
+	}
 
-	return activity
+	return strings.TrimSpace(lines[1])
 }
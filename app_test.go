@@ -0,0 +1,84 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestIsRunning(t *testing.T) {
+	const focus = `^dumpsys window \| grep -E mCurrentFocus$`
+
+	tests := []struct {
+		name string
+		fake *fakeExecutor
+		app  string
+		want bool
+	}{
+		{
+			name: "focused",
+			fake: newFakeExecutor().On(focus, "  mCurrentFocus=Window{1a2b u0 com.example.app/com.example.app.MainActivity}\n"),
+			app:  "com.example.app",
+			want: true,
+		},
+		{
+			name: "other app focused",
+			fake: newFakeExecutor().On(focus, "  mCurrentFocus=Window{1a2b u0 com.android.launcher3/.Launcher}\n"),
+			app:  "com.example.app",
+			want: false,
+		},
+		{
+			name: "no focus",
+			fake: newFakeExecutor().OnResult(focus, Result{ExitCode: 1}),
+			app:  "com.example.app",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newFakeDriver(t, tt.fake).isRunning(context.Background(), tt.app); got != tt.want {
+				t.Errorf("isRunning(%q) = %v, want %v (calls %q)", tt.app, got, tt.want, tt.fake.Calls())
+			}
+		})
+	}
+}
+
+func TestInstallApp(t *testing.T) {
+	const install = `^pm install /data/local/tmp/app.apk$`
+
+	tests := []struct {
+		name    string
+		fake    *fakeExecutor
+		wantErr error
+	}{
+		{
+			name: "success",
+			fake: newFakeExecutor().On(install, "Success\n"),
+		},
+		{
+			name:    "failure status",
+			fake:    newFakeExecutor().OnResult(install, Result{Stderr: "Failure [INSTALL_FAILED_OLDER_SDK]\n", ExitCode: 1}),
+			wantErr: ErrInstallFailed,
+		},
+		{
+			name:    "failure output of old pm",
+			fake:    newFakeExecutor().On(install, "Failure [INSTALL_FAILED_INVALID_APK]\n"),
+			wantErr: ErrInstallFailed,
+		},
+		{
+			name:    "transport error",
+			fake:    newFakeExecutor().OnError(install, ErrDeviceOffline),
+			wantErr: ErrDeviceOffline,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newFakeDriver(t, tt.fake).InstallApp("/data/local/tmp/app.apk", false)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("InstallApp() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AssetSource provides the content of the files the driver installs on the device
+type AssetSource interface {
+	// Open returns the content of the named asset, client being the HTTP client of the driver
+	Open(ctx context.Context, name string, client *http.Client) (io.ReadCloser, error)
+}
+
+// Asset is a file the driver installs on the device, such as the UiAutomator server jar.
+// The version and checksum of the installed copy are recorded next to it on the device,
+// so that it is pushed again when outdated or corrupt.
+type Asset struct {
+	Name    string      // File name of the asset in its source
+	Version string      // Version of the asset, defaults to the download URL or the checksum
+	SHA256  string      // Expected hex SHA-256 of the content, empty to skip verification
+	Source  AssetSource // Where the content comes from, nil to download it from the default URL
+}
+
+// fsSource serves assets from a file system
+type fsSource struct {
+	fsys fs.FS
+}
+
+// FSSource serves assets from a file system, e.g. an embed.FS for air-gapped machines
+// Parameters:
+//   - fsys: file system containing the assets at its root, use fs.Sub for a subdirectory
+//
+// Returns:
+//   - AssetSource: the source
+func FSSource(fsys fs.FS) AssetSource {
+	return fsSource{fsys: fsys}
+}
+
+// Open opens the named file of the file system
+func (s fsSource) Open(ctx context.Context, name string, client *http.Client) (io.ReadCloser, error) {
+	return s.fsys.Open(name)
+}
+
+// DirSource serves assets from a local directory
+// Parameters:
+//   - dir: directory containing the assets
+//
+// Returns:
+//   - AssetSource: the source
+func DirSource(dir string) AssetSource {
+	return fsSource{fsys: os.DirFS(dir)}
+}
+
+// urlSource downloads an asset
+type urlSource struct {
+	url string
+}
+
+// URLSource downloads the asset from a URL
+// Parameters:
+//   - url: URL of the asset
+//
+// Returns:
+//   - AssetSource: the source
+func URLSource(url string) AssetSource {
+	return urlSource{url: url}
+}
+
+// Open downloads the asset, failing on truncated responses
+func (s urlSource) Open(ctx context.Context, name string, client *http.Client) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = defaultClient()
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %s: %s", ErrDownloadFailed, s.url, res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrDownloadFailed, s.url, err)
+	}
+
+	if res.ContentLength >= 0 && int64(len(data)) != res.ContentLength {
+		return nil, fmt.Errorf("%w: %s: got %d of %d bytes", ErrDownloadFailed, s.url, len(data), res.ContentLength)
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// u2Asset returns the UiAutomator server asset, downloaded from Config.U2URL by default
+func (d *Driver) u2Asset() Asset {
+	a := d.config.U2Asset
+	if a.Source == nil {
+		a.Source = URLSource(d.config.U2URL)
+		if a.Version == "" {
+			a.Version = d.config.U2URL
+		}
+	}
+	return a
+}
+
+// keyboardAsset returns the ADB keyboard asset, downloaded from Config.KeyboardURL by default
+func (d *Driver) keyboardAsset() Asset {
+	a := d.config.KeyboardAsset
+	if a.Source == nil {
+		a.Source = URLSource(d.config.KeyboardURL)
+		if a.Version == "" {
+			a.Version = d.config.KeyboardURL
+		}
+	}
+	return a
+}
+
+// Provision installs the UiAutomator server and the ADB keyboard on the device,
+// pushing them again when the installed copies are outdated or corrupt.
+// It is done on connection when Config.AutoInstall is set.
+// Returns:
+//   - error: nil if successful, otherwise error details, wrapping ErrChecksumMismatch
+//     or ErrDownloadFailed when an asset could not be obtained intact
+func (d *Driver) Provision() error {
+	return d.ProvisionContext(context.Background())
+}
+
+// ProvisionContext installs the assets like Provision, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the downloads, transfers and installation
+//
+// Returns:
+//   - error: same errors as Provision, or ctx.Err() if ctx is done
+func (d *Driver) ProvisionContext(ctx context.Context) error {
+	if _, err := d.provision(ctx, d.u2Asset(), d.config.U2Path); err != nil {
+		return err
+	}
+
+	apk := d.config.RootPath + "/" + d.keyboardAsset().Name
+	changed, err := d.provision(ctx, d.keyboardAsset(), apk)
+	if err != nil {
+		return err
+	}
+
+	imeList, _ := d.RunContext(ctx, "ime", "list", "-s")
+	if changed || !strings.Contains(imeList, d.config.Keyboard) {
+		if err := d.InstallAppContext(ctx, apk, false); err != nil {
+			return err
+		}
+		if _, err := d.RunContext(ctx, "ime", "enable", d.config.Keyboard); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// provision makes sure the device holds an intact copy of the asset at path
+// Parameters:
+//   - ctx: context controlling the transfer
+//   - a: the asset
+//   - path: device path of the asset
+//
+// Returns:
+//   - bool: true if the asset was pushed, false if the installed copy was up to date
+//   - error: nil if successful, otherwise error details
+func (d *Driver) provision(ctx context.Context, a Asset, path string) (bool, error) {
+	if a.Version != "" && d.assetInstalled(ctx, a, path, a.Version) {
+		return false, nil
+	}
+
+	data, sum, err := d.fetchAsset(ctx, a)
+	if err != nil {
+		return false, err
+	}
+
+	version := a.Version
+	if version == "" {
+		version = sum
+		if d.assetInstalled(ctx, a, path, version) {
+			return false, nil
+		}
+	}
+
+	if err := d.writeDeviceFile(ctx, path, data); err != nil {
+		return false, err
+	}
+
+	if got, ok := d.deviceChecksum(ctx, path); ok && !strings.EqualFold(got, sum) {
+		return false, fmt.Errorf("%w: %s on device is %s, pushed %s", ErrChecksumMismatch, path, got, sum)
+	}
+
+	if !d.CreateFileContext(ctx, version+" "+sum, path+".version") {
+		return false, fmt.Errorf("provision %s: cannot record version", a.Name)
+	}
+
+	return true, nil
+}
+
+// fetchAsset reads the content of an asset and verifies its checksum
+func (d *Driver) fetchAsset(ctx context.Context, a Asset) ([]byte, string, error) {
+	r, err := a.Source.Open(ctx, a.Name, d.http)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+
+	if a.SHA256 != "" && !strings.EqualFold(sum, a.SHA256) {
+		return nil, "", fmt.Errorf("%w: %s is %s, expected %s", ErrChecksumMismatch, a.Name, sum, a.SHA256)
+	}
+
+	return data, sum, nil
+}
+
+// assetInstalled reports whether the device holds the given version of the asset,
+// intact according to the checksum recorded when it was pushed
+func (d *Driver) assetInstalled(ctx context.Context, a Asset, path, version string) bool {
+	stamp, err := d.RunContext(ctx, "cat", path+".version")
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(stamp)
+	if len(fields) != 2 || fields[0] != version {
+		return false
+	}
+	if a.SHA256 != "" && !strings.EqualFold(fields[1], a.SHA256) {
+		return false
+	}
+
+	got, ok := d.deviceChecksum(ctx, path)
+	if !ok {
+		// Without sha256sum on the device, trust the recorded version if the file is there
+		return d.FileExistsContext(ctx, path)
+	}
+
+	return strings.EqualFold(got, fields[1])
+}
+
+// deviceChecksum computes the SHA-256 of a device file, ok is false when the
+// device has no sha256sum command or the file does not exist
+func (d *Driver) deviceChecksum(ctx context.Context, path string) (string, bool) {
+	out, err := d.RunContext(ctx, "sha256sum", path)
+	fields := strings.Fields(out)
+	if err != nil || len(fields) == 0 {
+		return "", false
+	}
+
+	return fields[0], true
+}
+
+// writeDeviceFile stores data in a device file, through a temporary local file on PC
+func (d *Driver) writeDeviceFile(ctx context.Context, path string, data []byte) error {
+	if d.os == "android" {
+		return os.WriteFile(path, data, 0644)
+	}
+
+	if !DirExists(d.config.TempPath) {
+		CreateDir(d.config.TempPath)
+	}
+
+	local := filepath.Join(d.config.TempPath, "asset-"+strconv.Itoa(os.Getpid())+"-"+filepath.Base(path))
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(local)
+
+	return d.Push(ctx, local, path, nil)
+}
@@ -0,0 +1,168 @@
+package driver
+
+import "time"
+
+// Config holds the settings of a Driver.
+// Start from DefaultConfig and pass the result to WithConfig.
+// Drivers read every setting from their Config; the constants of env.go are
+// only the defaults of DefaultConfig.
+type Config struct {
+	RootPath         string        // Device working directory for temporary files
+	DaemonLog        string        // Device path of the log file of Daemon
+	TempPath         string        // Host directory receiving files pulled from the device
+	U2Path           string        // Device path of the UiAutomator server jar
+	U2URL            string        // Download URL of the UiAutomator server jar
+	U2Port           int           // Port of the UiAutomator server on the device
+	Keyboard         string        // Input method id of the ADB keyboard
+	KeyboardURL      string        // Download URL of the ADB keyboard APK
+	U2Asset          Asset         // UiAutomator server jar, downloaded from U2URL if its Source is nil
+	KeyboardAsset    Asset         // ADB keyboard APK, downloaded from KeyboardURL if its Source is nil
+	WaitTimeout      time.Duration // Default timeout of WaitElement, StartApp and device waits
+	PollInterval     time.Duration // Interval between two device list polls
+	RPCTimeout       time.Duration // Timeout of a UiAutomator server call, added to the wait of waiting calls
+	U2HealthInterval time.Duration // Interval between two health checks of the UiAutomator server
+	Lookup           LookupBackend // How WaitElement finds elements, see WithLookup
+	DNSServer        string        // DNS server (host:port) used for downloads, empty for the system resolver
+	AutoInstall      bool          // Install the UiAutomator server and the ADB keyboard when missing
+	SwitchIME        bool          // Switch to the ADB keyboard on connection and back on Cleanup
+}
+
+// DefaultConfig returns the settings used when New is given no configuration
+// Returns:
+//   - Config: the default settings, taken from the constants of env.go
+func DefaultConfig() Config {
+	return Config{
+		RootPath:         ROOT_PATH,
+		DaemonLog:        DAEMON_PATH,
+		TempPath:         TEMP_PATH,
+		U2Path:           U2_PATH,
+		U2URL:            U2_URL,
+		U2Port:           U2_PORT,
+		Keyboard:         ADB_KEYBOARD,
+		KeyboardURL:      ADB_KEYBOARD_URL,
+		U2Asset:          Asset{Name: "u2.jar"},
+		KeyboardAsset:    Asset{Name: "star-ime.apk"},
+		WaitTimeout:      WAIT_TIMEOUT * time.Millisecond,
+		PollInterval:     POLL_INTERVAL * time.Millisecond,
+		RPCTimeout:       RPC_TIMEOUT * time.Millisecond,
+		U2HealthInterval: U2_HEALTH_INTERVAL * time.Millisecond,
+		Lookup:           LookupDump,
+		DNSServer:        DNS_SERVER,
+		AutoInstall:      true,
+		SwitchIME:        true,
+	}
+}
+
+// WithConfig replaces the settings of the driver. Fields left to their zero
+// value keep the current setting. AutoInstall, SwitchIME and DNSServer are
+// always taken from config since their zero value is a valid setting.
+// Options changing a single setting, such as WithLookup or WithAutoInstall,
+// are applied over it whatever their position.
+// Parameters:
+//   - config: the settings, usually DefaultConfig with some fields changed;
+//     zero durations and ports, and empty paths, keep their current value
+//
+// Returns:
+//   - Option: option to pass to New
+func WithConfig(config Config) Option {
+	return func(d *Driver) {
+		d.config = config.merge(d.config)
+	}
+}
+
+// withSetting returns an option changing a single setting, applied after
+// WithConfig so that it is not overridden by it
+func withSetting(set func(c *Config)) Option {
+	return func(d *Driver) {
+		d.settings = append(d.settings, set)
+	}
+}
+
+// merge returns c with its zero fields taken from base, the UiAutomator
+// server jar defaulting to the working directory of c if it has one
+func (c Config) merge(base Config) Config {
+	if c.U2Path == "" && c.RootPath != "" && c.RootPath != base.RootPath {
+		c.U2Path = c.RootPath + "/u2.jar"
+	}
+	if c.DaemonLog == "" && c.RootPath != "" && c.RootPath != base.RootPath {
+		c.DaemonLog = c.RootPath + "/driver-daemon.log"
+	}
+
+	if c.RootPath == "" {
+		c.RootPath = base.RootPath
+	}
+	if c.DaemonLog == "" {
+		c.DaemonLog = base.DaemonLog
+	}
+	if c.TempPath == "" {
+		c.TempPath = base.TempPath
+	}
+	if c.U2Path == "" {
+		c.U2Path = base.U2Path
+	}
+	if c.U2URL == "" {
+		c.U2URL = base.U2URL
+	}
+	if c.U2Port == 0 {
+		c.U2Port = base.U2Port
+	}
+	if c.Keyboard == "" {
+		c.Keyboard = base.Keyboard
+	}
+	if c.KeyboardURL == "" {
+		c.KeyboardURL = base.KeyboardURL
+	}
+	if c.U2Asset.Name == "" {
+		c.U2Asset.Name = base.U2Asset.Name
+	}
+	if c.KeyboardAsset.Name == "" {
+		c.KeyboardAsset.Name = base.KeyboardAsset.Name
+	}
+	if c.WaitTimeout <= 0 {
+		c.WaitTimeout = base.WaitTimeout
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = base.PollInterval
+	}
+	if c.RPCTimeout <= 0 {
+		c.RPCTimeout = base.RPCTimeout
+	}
+	if c.U2HealthInterval <= 0 {
+		c.U2HealthInterval = base.U2HealthInterval
+	}
+	if c.Lookup == "" {
+		c.Lookup = base.Lookup
+	}
+	return c
+}
+
+// WithAutoInstall sets whether missing software is installed on the device
+// Parameters:
+//   - install: false to never download nor install the UiAutomator server and the ADB keyboard
+//
+// Returns:
+//   - Option: option to pass to New
+func WithAutoInstall(install bool) Option {
+	return withSetting(func(c *Config) {
+		c.AutoInstall = install
+	})
+}
+
+// WithSwitchIME sets whether the driver switches the device to the ADB keyboard
+// Parameters:
+//   - switchIME: false to leave the input method of the device untouched
+//
+// Returns:
+//   - Option: option to pass to New
+func WithSwitchIME(switchIME bool) Option {
+	return withSetting(func(c *Config) {
+		c.SwitchIME = switchIME
+	})
+}
+
+// Config returns the settings of the driver
+// Returns:
+//   - Config: a copy of the settings
+func (d *Driver) Config() Config {
+	return d.config
+}
@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithConfig(t *testing.T) {
+	defaults := DefaultConfig()
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		check func(t *testing.T, c Config)
+	}{
+		{
+			name: "zero fields keep the defaults",
+			opts: []Option{WithConfig(Config{WaitTimeout: 3 * time.Second})},
+			check: func(t *testing.T, c Config) {
+				if c.WaitTimeout != 3*time.Second || c.RootPath != defaults.RootPath || c.RPCTimeout != defaults.RPCTimeout {
+					t.Errorf("config = %+v", c)
+				}
+			},
+		},
+		{
+			name: "earlier options are kept",
+			opts: []Option{WithLookup(LookupSelector), WithConfig(Config{WaitTimeout: 3 * time.Second})},
+			check: func(t *testing.T, c Config) {
+				if c.Lookup != LookupSelector {
+					t.Errorf("Lookup = %q, want %q", c.Lookup, LookupSelector)
+				}
+			},
+		},
+		{
+			name: "later options win",
+			opts: []Option{WithConfig(DefaultConfig()), WithAutoInstall(false), WithLookup(LookupSelector)},
+			check: func(t *testing.T, c Config) {
+				if c.AutoInstall || c.Lookup != LookupSelector {
+					t.Errorf("AutoInstall = %v, Lookup = %q", c.AutoInstall, c.Lookup)
+				}
+			},
+		},
+		{
+			name: "earlier single settings win over the config",
+			opts: []Option{WithAutoInstall(false), WithSwitchIME(false), WithConfig(DefaultConfig())},
+			check: func(t *testing.T, c Config) {
+				if c.AutoInstall || c.SwitchIME {
+					t.Errorf("AutoInstall = %v, SwitchIME = %v, want false", c.AutoInstall, c.SwitchIME)
+				}
+			},
+		},
+		{
+			name: "root path moves the device files",
+			opts: []Option{WithConfig(Config{RootPath: "/sdcard/driver"})},
+			check: func(t *testing.T, c Config) {
+				if c.U2Path != "/sdcard/driver/u2.jar" || c.DaemonLog != "/sdcard/driver/driver-daemon.log" {
+					t.Errorf("U2Path = %q, DaemonLog = %q", c.U2Path, c.DaemonLog)
+				}
+			},
+		},
+		{
+			name: "asset names default, sources are kept",
+			opts: []Option{WithConfig(Config{U2Asset: Asset{Version: "0.1.5", Source: DirSource("/opt/assets")}})},
+			check: func(t *testing.T, c Config) {
+				if c.U2Asset.Name != "u2.jar" || c.U2Asset.Source == nil || c.KeyboardAsset.Name != "star-ime.apk" {
+					t.Errorf("U2Asset = %+v, KeyboardAsset = %+v", c.U2Asset, c.KeyboardAsset)
+				}
+			},
+		},
+		{
+			name: "empty DNS server selects the system resolver",
+			opts: []Option{WithConfig(Config{})},
+			check: func(t *testing.T, c Config) {
+				if c.DNSServer != "" {
+					t.Errorf("DNSServer = %q, want empty", c.DNSServer)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(append([]Option{WithExecutor(newFakeExecutor())}, tt.opts...)...)
+			tt.check(t, d.Config())
+		})
+	}
+}
+
+func TestDriverRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	d := New(WithExecutor(newFakeExecutor()))
+	used := false
+	d.http = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		used = true
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	res, err := d.RequestContext(context.Background(), &Requester{Url: server.URL, Method: http.MethodGet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res["ok"] != true || !used {
+		t.Errorf("RequestContext() = %v, driver client used %v", res, used)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestNewU2ClientTimeout(t *testing.T) {
+	if got := NewU2Client("http://127.0.0.1:9008/jsonrpc/0").Timeout; got != DefaultConfig().RPCTimeout {
+		t.Errorf("Timeout = %s, want %s", got, DefaultConfig().RPCTimeout)
+	}
+}
@@ -1,52 +1,122 @@
 package driver
 
 import (
-	"bufio"
-	"os/exec"
+	"context"
+	"fmt"
 	"strings"
 )
 
 // Connect establishes a connection to an Android device
 // Parameters:
-//   - device: device serial number or identifier
+//   - device: device serial number or IP address, empty to use the only connected device
 //
 // Returns:
 //   - error: nil if successful, otherwise:
-//   - ErrMultipleDevices if multiple devices are connected
+//   - ErrDeviceNotFound if no device has this serial
+//   - ErrMultipleDevices if device is empty and several devices are connected
+//   - ErrDeviceUnauthorized if USB debugging has not been allowed on the device
 //   - ErrDeviceOffline if the device is offline
 //   - Other errors from adb command execution
 func (d *Driver) Connect(device string) error {
+	return d.ConnectContext(context.Background(), device)
+}
+
+// ConnectContext establishes a connection like Connect, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the device lookup and initialization
+//   - device: device serial number or IP address, empty to use the only connected device
+//
+// Returns:
+//   - error: same errors as Connect, or ctx.Err() if ctx is done
+func (d *Driver) ConnectContext(ctx context.Context, device string) error {
+	if device == "" {
+		return d.ConnectWhereContext(ctx, func(DeviceInfo) bool { return true })
+	}
+
+	// A wireless device may be given by its address without the port
+	return d.ConnectWhereContext(ctx, func(info DeviceInfo) bool {
+		return info.Serial == device || strings.HasPrefix(info.Serial, device+":")
+	})
+}
+
+// ConnectWhere establishes a connection to the device selected by match,
+// e.g. MatchModel("Pixel 7")
+// Parameters:
+//   - match: predicate selecting the device among those listed by Devices
+//
+// Returns:
+//   - error: nil if successful, otherwise:
+//   - ErrDeviceNotFound if no device matches
+//   - ErrMultipleDevices if several ready devices match
+//   - ErrDeviceUnauthorized if the matching device has not allowed USB debugging
+//   - ErrDeviceOffline if the matching device is offline
+//   - Errors of the initialization of the device, e.g. of Provision
+//   - Other errors from adb command execution
+func (d *Driver) ConnectWhere(match func(DeviceInfo) bool) error {
+	return d.ConnectWhereContext(context.Background(), match)
+}
+
+// ConnectWhereContext establishes a connection like ConnectWhere, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the device lookup and initialization
+//   - match: predicate selecting the device among those listed by Devices
+//
+// Returns:
+//   - error: same errors as ConnectWhere, or ctx.Err() if ctx is done
+func (d *Driver) ConnectWhereContext(ctx context.Context, match func(DeviceInfo) bool) error {
 	if d.os == "android" {
 		d.device = ""
 		return nil
 	}
 
-	cmd := exec.Command(d.shell, "adb", "devices")
-	output, err := cmd.CombinedOutput()
-
+	devices, err := d.DevicesContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	out := string(output)
-	if strings.Contains(out, "more than one device") {
-		return ErrMultipleDevices
+	info, err := selectDevice(devices, match)
+	if err != nil {
+		return err
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(out))
-	for scanner.Scan() {
-		line := scanner.Text()
+	d.device = info.Serial
+	d.watchDevice(info)
+
+	return d.initialize(ctx)
+}
 
-		if strings.Contains(line, device) {
-			if strings.Contains(line, "offline") {
-				return ErrDeviceOffline
-			}
-			d.device = strings.Fields(line)[0]
-			break
+// selectDevice picks the device matching the predicate.
+// Ready devices are preferred; when none is ready the state of the
+// first match is reported as an error.
+func selectDevice(devices []DeviceInfo, match func(DeviceInfo) bool) (DeviceInfo, error) {
+	var ready, matched []DeviceInfo
+	for _, info := range devices {
+		if !match(info) {
+			continue
+		}
+
+		matched = append(matched, info)
+		if info.State == StateDevice {
+			ready = append(ready, info)
 		}
 	}
 
-	d.initialize()
+	switch {
+	case len(ready) == 1:
+		return ready[0], nil
+	case len(ready) > 1:
+		return DeviceInfo{}, ErrMultipleDevices
+	case len(matched) == 0:
+		return DeviceInfo{}, ErrDeviceNotFound
+	}
 
-	return nil
+	info := matched[0]
+	switch info.State {
+	case StateUnauthorized:
+		return DeviceInfo{}, fmt.Errorf("%w: %s", ErrDeviceUnauthorized, info.Serial)
+	case StateOffline:
+		return DeviceInfo{}, fmt.Errorf("%w: %s", ErrDeviceOffline, info.Serial)
+	default:
+		return DeviceInfo{}, fmt.Errorf("device %s is in state %q", info.Serial, info.State)
+	}
 }
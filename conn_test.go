@@ -0,0 +1,45 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestConnectReportsInitializationError(t *testing.T) {
+	fake := newFakeExecutor().
+		On(`^adb devices -l$`, "List of devices attached\nemulator-5554 device product:sdk model:Pixel transport_id:1\n")
+
+	config := DefaultConfig()
+	config.U2Asset = Asset{Name: "u2.jar", Source: FSSource(fstest.MapFS{})}
+	d := New(WithExecutor(fake), WithConfig(config))
+
+	err := d.ConnectContext(context.Background(), "emulator-5554")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ConnectContext() error = %v, want the missing asset error (calls %q)", err, fake.Calls())
+	}
+	if d.device != "emulator-5554" {
+		t.Errorf("device = %q, want emulator-5554", d.device)
+	}
+}
+
+func TestConnectReportsUiAutomatorError(t *testing.T) {
+	fake := newFakeExecutor().
+		On(`^adb devices -l$`, "List of devices attached\nemulator-5554 device product:sdk model:Pixel transport_id:1\n").
+		OnError(`^adb forward `, errors.New("device offline"))
+
+	config := DefaultConfig()
+	config.AutoInstall = false
+	config.SwitchIME = false
+	d := New(WithExecutor(fake), WithConfig(config))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := d.ConnectContext(ctx, "emulator-5554"); err == nil {
+		t.Errorf("ConnectContext() = nil, want the UiAutomator start error (calls %q)", fake.Calls())
+	}
+}
@@ -7,19 +7,22 @@ import (
 )
 
 // runDaemon initializes and creates a new daemon context
+// Parameters:
+//   - config: settings giving the working directory and the log file
+//
 // Returns:
 //   - *daemon.Context: The daemon context if successful, nil if this is the parent process
-func runDaemon() (cntxt *daemon.Context) {
+func runDaemon(config Config) (cntxt *daemon.Context) {
 	cntxt = &daemon.Context{
 		PidFilePerm: 0644,
 		LogFilePerm: 0640,
-		WorkDir:     ROOT_PATH,
+		WorkDir:     config.RootPath,
 		Umask:       022,
 	}
 
-	if f, err := os.OpenFile(DAEMON_PATH, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err == nil {
+	if f, err := os.OpenFile(config.DaemonLog, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err == nil {
 		f.Close()
-		cntxt.LogFileName = DAEMON_PATH
+		cntxt.LogFileName = config.DaemonLog
 	}
 
 	child, _ := cntxt.Reborn()
@@ -34,8 +37,15 @@ func runDaemon() (cntxt *daemon.Context) {
 // Daemon runs the provided function as a daemon process
 // Parameters:
 //   - exec: The function to run in the daemon process
-func Daemon(exec func()) {
-	cntxt := runDaemon()
+//   - config: optional settings, the daemon runs in Config.RootPath and logs
+//     to Config.DaemonLog; zero fields take the value of DefaultConfig
+func Daemon(exec func(), config ...Config) {
+	settings := DefaultConfig()
+	if len(config) > 0 {
+		settings = config[0].merge(settings)
+	}
+
+	cntxt := runDaemon(settings)
 	if cntxt == nil {
 		return
 	}
@@ -0,0 +1,142 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// Device states reported by adb
+const (
+	StateDevice       = "device"       // device is ready
+	StateOffline      = "offline"      // device is not responding
+	StateUnauthorized = "unauthorized" // USB debugging has not been allowed on the device
+)
+
+// DeviceInfo describes a device listed by "adb devices -l"
+type DeviceInfo struct {
+	Serial      string `json:"serial"`       // device serial number
+	State       string `json:"state"`        // device state (device/offline/unauthorized/...)
+	Model       string `json:"model"`        // device model, e.g. "Pixel_7"
+	Product     string `json:"product"`      // product name
+	Device      string `json:"device"`       // device name
+	TransportID int    `json:"transport_id"` // adb transport id
+}
+
+// Devices lists the devices known to adb
+// Returns:
+//   - []DeviceInfo: the devices, in adb order
+//   - error: nil if successful, otherwise error details
+func (d *Driver) Devices() ([]DeviceInfo, error) {
+	return d.DevicesContext(context.Background())
+}
+
+// DevicesContext lists the devices like Devices, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the adb request
+//
+// Returns:
+//   - []DeviceInfo: the devices, in adb order
+//   - error: nil if successful, otherwise error details
+func (d *Driver) DevicesContext(ctx context.Context) ([]DeviceInfo, error) {
+	if d.os == "android" {
+		return []DeviceInfo{d.localDevice(ctx)}, ctx.Err()
+	}
+
+	res, err := d.executor.Host(ctx, "", "devices", "-l")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDevices(res.Stdout), nil
+}
+
+// MatchSerial selects the device with the given serial
+func MatchSerial(serial string) func(DeviceInfo) bool {
+	return func(info DeviceInfo) bool {
+		return info.Serial == serial
+	}
+}
+
+// MatchModel selects devices of the given model, as listed by adb ("Pixel_7")
+// or as reported by the device ("Pixel 7")
+func MatchModel(model string) func(DeviceInfo) bool {
+	model = strings.ReplaceAll(model, " ", "_")
+	return func(info DeviceInfo) bool {
+		return info.Model == model
+	}
+}
+
+// MatchTransportID selects the device with the given adb transport id
+func MatchTransportID(id int) func(DeviceInfo) bool {
+	return func(info DeviceInfo) bool {
+		return info.TransportID == id
+	}
+}
+
+// parseDevices parses the output of "adb devices -l", e.g.
+// "emulator-5554 device product:sdk_gphone64 model:Pixel_7 device:emu64 transport_id:1"
+func parseDevices(out string) []DeviceInfo {
+	var devices []DeviceInfo
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "*") || fields[0] == "List" {
+			continue
+		}
+
+		info := DeviceInfo{Serial: fields[0]}
+
+		// The state may span several words, e.g. "no permissions (...)",
+		// it ends at the first key:value attribute
+		var state []string
+		attributes := false
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, ":")
+			if !found {
+				key = ""
+			}
+
+			switch key {
+			case "product":
+				info.Product = value
+			case "model":
+				info.Model = value
+			case "device":
+				info.Device = value
+			case "transport_id":
+				info.TransportID, _ = strconv.Atoi(value)
+			case "usb":
+			default:
+				if !attributes {
+					state = append(state, field)
+				}
+				continue
+			}
+			attributes = true
+		}
+		info.State = strings.Join(state, " ")
+
+		devices = append(devices, info)
+	}
+
+	return devices
+}
+
+// localDevice describes the device the driver runs on, used on Android
+func (d *Driver) localDevice(ctx context.Context) DeviceInfo {
+	serial, _ := d.RunContext(ctx, "getprop", "ro.serialno")
+	model, _ := d.RunContext(ctx, "getprop", "ro.product.model")
+	product, _ := d.RunContext(ctx, "getprop", "ro.product.name")
+	device, _ := d.RunContext(ctx, "getprop", "ro.product.device")
+
+	return DeviceInfo{
+		Serial:  strings.TrimSpace(serial),
+		State:   StateDevice,
+		Model:   strings.ReplaceAll(strings.TrimSpace(model), " ", "_"),
+		Product: strings.TrimSpace(product),
+		Device:  strings.TrimSpace(device),
+	}
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"regexp"
@@ -10,12 +11,14 @@ import (
 	"github.com/beevik/etree"
 )
 
-// document represents the document structure in Android UI hierarchy
-type document struct {
-	d       *Driver        // driver instance
-	RawXML  string         // raw XML string
-	root    *etree.Element // root XML node
-	element *etree.Element // currently selected XML node
+// Document represents the document structure in Android UI hierarchy.
+// It is returned by Driver.Document, and is the root of the queries of Element.
+type Document struct {
+	d          *Driver        // driver instance
+	RawXML     string         // raw XML string
+	root       *etree.Element // root XML node
+	element    *etree.Element // currently selected XML node
+	attachment *attachment    // set for a node described by the UiAutomator server, see attach
 }
 
 // Bounds represents the coordinates of a UI element's bounding box
@@ -30,10 +33,19 @@ type Bounds struct {
 // It executes a UI dump command and parses the resulting XML.
 //
 // Returns:
-//   - *document: The parsed UI document structure
+//   - *Document: The parsed UI document structure
 //   - nil: If unable to get UI dump or parse the XML
-func (d *Driver) Document() *document {
-	xml, err := d.dump()
+func (d *Driver) Document() *Document {
+	return d.DocumentContext(context.Background())
+}
+
+// DocumentContext retrieves and parses the UI hierarchy like Document, stopping when ctx is done.
+//
+// Returns:
+//   - *Document: The parsed UI document structure
+//   - nil: If unable to get UI dump or parse the XML
+func (d *Driver) DocumentContext(ctx context.Context) *Document {
+	xml, err := d.dump(ctx)
 	if err != nil {
 		return nil
 	}
@@ -44,7 +56,7 @@ func (d *Driver) Document() *document {
 		return nil
 	}
 
-	return &document{
+	return &Document{
 		d:      d,
 		RawXML: xml,
 		root:   &doc.Element,
@@ -53,7 +65,7 @@ func (d *Driver) Document() *document {
 
 // Text returns the text attribute value of the element
 func (d *element) Text() string {
-	if d.element == nil {
+	if d.node() == nil {
 		return ""
 	}
 
@@ -62,7 +74,7 @@ func (d *element) Text() string {
 
 // ContentDesc returns the content-desc attribute value of the element
 func (d *element) ContentDesc() string {
-	if d.element == nil {
+	if d.node() == nil {
 		return ""
 	}
 
@@ -71,7 +83,7 @@ func (d *element) ContentDesc() string {
 
 // ClassName returns the class attribute value of the element
 func (d *element) ClassName() string {
-	if d.element == nil {
+	if d.node() == nil {
 		return ""
 	}
 
@@ -80,7 +92,7 @@ func (d *element) ClassName() string {
 
 // ResourceID returns the resource-id attribute value of the element
 func (d *element) ResourceID() string {
-	if d.element == nil {
+	if d.node() == nil {
 		return ""
 	}
 
@@ -89,7 +101,7 @@ func (d *element) ResourceID() string {
 
 // Checked returns whether the element is checked
 func (d *element) Checked() bool {
-	if d.element == nil {
+	if d.node() == nil {
 		return false
 	}
 
@@ -98,16 +110,16 @@ func (d *element) Checked() bool {
 
 // Selected returns whether the element is selected
 func (d *element) Selected() bool {
-	if d.element == nil {
+	if d.node() == nil {
 		return false
 	}
 
-	return d.GetAttribute("enabled") == "true"
+	return d.GetAttribute("selected") == "true"
 }
 
 // Index returns the index attribute value of the element as integer
 func (d *element) Index() int {
-	if d.element == nil {
+	if d.node() == nil {
 		return -1
 	}
 
@@ -119,18 +131,26 @@ func (d *element) Index() int {
 
 // GetBounds returns the element's bounding box coordinates
 func (d *element) GetBounds() *Bounds {
-	if d.element == nil {
+	node := d.node()
+	if node == nil {
 		return nil
 	}
 
-	bounds := d.GetAttribute("bounds")
+	return nodeBounds(node)
+}
+
+// nodeBounds parses the bounds attribute of a hierarchy node, e.g. "[0,0][1080,200]"
+func nodeBounds(node *etree.Element) *Bounds {
+	bounds := node.SelectAttrValue("bounds", "")
 
 	re := regexp.MustCompile(`\d+`)
 	matches := re.FindAllString(bounds, -1)
 
 	rect := make([]int, 4)
 	for i := range matches {
-		rect[i], _ = strconv.Atoi(matches[i])
+		if i < len(rect) {
+			rect[i], _ = strconv.Atoi(matches[i])
+		}
 	}
 
 	return &Bounds{
@@ -145,11 +165,12 @@ func (d *element) GetBounds() *Bounds {
 // Parameters:
 //   - name: attribute name
 func (d *element) GetAttribute(name string) string {
-	if d.element == nil {
+	node := d.node()
+	if node == nil {
 		return ""
 	}
 
-	return d.element.SelectAttr(name).Value
+	return node.SelectAttrValue(name, "")
 }
 
 // Tap performs a tap action at element's center point
@@ -157,18 +178,36 @@ func (d *element) Tap() {
 	d.d.Tap(d.x, d.y)
 }
 
+// TapContext performs a tap at element's center point, stopping when ctx is done
+func (d *element) TapContext(ctx context.Context) error {
+	return d.d.TapContext(ctx, d.x, d.y)
+}
+
 // LongTap performs a long tap action at element's center point
 func (d *element) LongTap() {
 	d.d.LongTap(d.x, d.y)
 }
 
+// LongTapContext performs a long tap at element's center point, stopping when ctx is done
+func (d *element) LongTapContext(ctx context.Context) error {
+	return d.d.LongTapContext(ctx, d.x, d.y)
+}
+
 // Swipe performs a swipe gesture within element's bounds
 // Parameters:
 //   - direction: swipe direction (SWIPE_UP/DOWN/LEFT/RIGHT)
 func (d *element) Swipe(direction Direction) {
+	d.SwipeContext(context.Background(), direction)
+}
+
+// SwipeContext performs a swipe within element's bounds, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the command lifetime
+//   - direction: swipe direction (SWIPE_UP/DOWN/LEFT/RIGHT)
+func (d *element) SwipeContext(ctx context.Context, direction Direction) error {
 	bounds := d.GetBounds()
 
-	d.d.swipeInRange(bounds, direction, 40, 0.8)
+	return d.d.swipeInRange(ctx, bounds, direction, 40, 0.8)
 }
 
 // Input enters text into the element by simulating keyboard input
@@ -178,48 +217,97 @@ func (d *element) Input(text string) {
 	d.d.Input(d.x, d.y, text)
 }
 
+// InputContext enters text into the element, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the command lifetime
+//   - text: the text string to input
+func (d *element) InputContext(ctx context.Context, text string) error {
+	return d.d.InputContext(ctx, d.x, d.y, text)
+}
+
 // Clear clears the text content of the current element.
 // It simulates clearing text at the element's coordinates.
 func (d *element) Clear() {
 	d.d.Clear(d.x, d.y)
 }
 
+// ClearContext clears the text content of the element, stopping when ctx is done
+func (d *element) ClearContext(ctx context.Context) error {
+	return d.d.ClearContext(ctx, d.x, d.y)
+}
+
+// editorAction broadcasts an IME editor action to the ADB keyboard
+func (d *element) editorAction(ctx context.Context, action EditorAction) error {
+	_, err := d.d.RunContext(ctx, "am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", action))
+	return err
+}
+
 // Search simulates pressing the search key on the element.
 // It broadcasts an intent to trigger the search action.
 // This is equivalent to pressing the search button on the keyboard.
 func (d *element) Search() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_SEARCH))
+	d.editorAction(context.Background(), IME_ACTION_SEARCH)
+}
+
+// SearchContext simulates pressing the search key, stopping when ctx is done
+func (d *element) SearchContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_SEARCH)
 }
 
 // Enter simulates pressing the enter key on the element.
 // It broadcasts an intent to trigger the done action.
 // This is equivalent to pressing the enter/done button on the keyboard.
 func (d *element) Enter() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_DONE))
+	d.editorAction(context.Background(), IME_ACTION_DONE)
+}
+
+// EnterContext simulates pressing the enter key, stopping when ctx is done
+func (d *element) EnterContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_DONE)
 }
 
 // Next simulates pressing the next key on the element
 // to move focus to the next input field
 func (d *element) Next() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_NEXT))
+	d.editorAction(context.Background(), IME_ACTION_NEXT)
+}
+
+// NextContext simulates pressing the next key, stopping when ctx is done
+func (d *element) NextContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_NEXT)
 }
 
 // Send simulates pressing the send key on the element
 // to submit the current input
 func (d *element) Send() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_SEND))
+	d.editorAction(context.Background(), IME_ACTION_SEND)
+}
+
+// SendContext simulates pressing the send key, stopping when ctx is done
+func (d *element) SendContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_SEND)
 }
 
 // Previous simulates pressing the previous key on the element
 // to move focus to the previous input field
 func (d *element) Previous() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_PREVIOUS))
+	d.editorAction(context.Background(), IME_ACTION_PREVIOUS)
+}
+
+// PreviousContext simulates pressing the previous key, stopping when ctx is done
+func (d *element) PreviousContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_PREVIOUS)
 }
 
 // Go simulates pressing the go key on the element
 // to trigger the default action
 func (d *element) Go() {
-	d.d.Run("am", "broadcast", "-a", "STAR_EDITOR_CODE", "--ei", "code", fmt.Sprintf("%d", IME_ACTION_GO))
+	d.editorAction(context.Background(), IME_ACTION_GO)
+}
+
+// GoContext simulates pressing the go key, stopping when ctx is done
+func (d *element) GoContext(ctx context.Context) error {
+	return d.editorAction(ctx, IME_ACTION_GO)
 }
 
 // Screenshot captures and crops a screenshot of the current element.
@@ -229,16 +317,29 @@ func (d *element) Go() {
 // Returns:
 //   - image.Image: The cropped screenshot of the element
 func (d *element) Screenshot() image.Image {
+	img, _ := d.ScreenshotContext(context.Background())
+	return img
+}
+
+// ScreenshotContext captures a screenshot of the element like Screenshot, stopping when ctx is done.
+//
+// Returns:
+//   - image.Image: The cropped screenshot of the element
+//   - error: Error if the device screenshot failed
+func (d *element) ScreenshotContext(ctx context.Context) (image.Image, error) {
 	bounds := d.GetBounds()
 
-	img := d.d.Screenshot()
+	img, err := d.d.ScreenshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	cropImage := CropImage(img, image.Rect(bounds.LTX, bounds.LTY, bounds.RBX, bounds.RBY))
 
-	tempfile := fmt.Sprintf("%s/%v.png", ROOT_PATH, time.Now().UnixMilli())
+	tempfile := fmt.Sprintf("%s/%v.png", d.d.config.RootPath, time.Now().UnixMilli())
 	d.d.SaveImage(cropImage, tempfile)
 
-	return cropImage
+	return cropImage, nil
 }
 
 // ScreenshotBase64 captures a screenshot of the current element and converts it to base64 string.
@@ -248,6 +349,18 @@ func (d *element) Screenshot() image.Image {
 //   - string: Base64 encoded string of the screenshot
 //   - error: Error if base64 encoding fails
 func (d *element) ScreenshotBase64() (string, error) {
-	img := d.Screenshot()
+	return d.ScreenshotBase64Context(context.Background())
+}
+
+// ScreenshotBase64Context captures the element as base64 like ScreenshotBase64, stopping when ctx is done.
+//
+// Returns:
+//   - string: Base64 encoded string of the screenshot
+//   - error: Error if the screenshot or the encoding fails
+func (d *element) ScreenshotBase64Context(ctx context.Context) (string, error) {
+	img, err := d.ScreenshotContext(ctx)
+	if err != nil {
+		return "", err
+	}
 	return Image2Base64(img)
 }
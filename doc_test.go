@@ -0,0 +1,37 @@
+package driver
+
+import "testing"
+
+func TestElementAttributes(t *testing.T) {
+	const xml = `<hierarchy>
+  <node index="2" text="Wi-Fi" resource-id="app:id/tab" class="android.widget.TextView" content-desc="Wi-Fi tab" checked="false" selected="true" enabled="false" bounds="[10,20][110,70]"/>
+</hierarchy>`
+	d := New(WithExecutor(newFakeExecutor()))
+	el, err := newTestDocument(t, d, xml).FindElement(HasResourceID(Eq("app:id/tab")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"Text", el.Text(), "Wi-Fi"},
+		{"ContentDesc", el.ContentDesc(), "Wi-Fi tab"},
+		{"ClassName", el.ClassName(), "android.widget.TextView"},
+		{"ResourceID", el.ResourceID(), "app:id/tab"},
+		{"Checked", el.Checked(), false},
+		{"Selected", el.Selected(), true},
+		{"Index", el.Index(), 2},
+		{"GetBounds", *el.GetBounds(), Bounds{LTX: 10, LTY: 20, RBX: 110, RBY: 70}},
+		{"GetAttribute", el.GetAttribute("enabled"), "false"},
+		{"missing attribute", el.GetAttribute("password"), ""},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -1,22 +1,98 @@
 package driver
 
-import "runtime"
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+)
 
 // Driver represents the core structure for Android UI automation
 type Driver struct {
-	os              string // Operating system name
-	shell           string // Shell type (powershell/bash/sh)
-	device          string // Connected device ID
-	defaultKeyboard string // Default keyboard on device
-	deviceInfo      string // Device information string
+	os              string                      // Operating system name
+	shell           string                      // Shell type (powershell/bash/sh)
+	device          string                      // Connected device ID
+	defaultKeyboard string                      // Default keyboard on device
+	deviceInfo      string                      // Device information string
+	adb             *adbClient                  // ADB server client used on PC
+	executor        Executor                    // Executor running device and host commands
+	recorder        *Recorder                   // Recorder wrapping the executor, if any
+	watch           atomic.Pointer[deviceWatch] // State of the connected device, followed after Connect
+	recovery        *recoveryState              // Recovery from device drops, enabled by WithRecovery
+	forwards        forwardSet                  // Port forwardings to remove on Cleanup
+	config          Config                      // Settings, see WithConfig
+	settings        []func(*Config)             // Single settings applied over config by New
+	http            *http.Client                // HTTP client used for downloads and JSON-RPC
+	u2              *U2Client                   // Client of the UiAutomator server
+	supervisor      *u2Supervisor               // Supervision of the UiAutomator server
+	watchers        watcherSet                  // Popup watchers, see Watch
 }
 
-// New creates and initializes a new driver instance
+// Option configures a Driver created by New
+type Option func(*Driver)
+
+// WithExecutor replaces the executor running device and host commands,
+// e.g. with a scripted executor to test code without a phone
+// Parameters:
+//   - executor: the executor to use
+//
+// Returns:
+//   - Option: option to pass to New
+func WithExecutor(executor Executor) Option {
+	return func(d *Driver) {
+		d.executor = executor
+	}
+}
+
+// WithAdbServer uses the ADB server at the given address instead of the local one,
+// e.g. a server started with "adb -a server" on a USB hub host. Device listing,
+// commands, file transfers and port forwards all go through this server.
+// Without this option, the ADB_SERVER_SOCKET environment variable is honored.
+// Parameters:
+//   - addr: server address, as "host:port" or "tcp:host:port"
+//
+// Returns:
+//   - Option: option to pass to New
+func WithAdbServer(addr string) Option {
+	return func(d *Driver) {
+		d.adb = newAdbClient(parseServerAddr(addr))
+	}
+}
+
+// New creates and initializes a new driver instance.
+// On Android, the device is initialized right away and a failed
+// initialization leaves the driver usable but not set up, use NewContext
+// to get the error.
+// Parameters:
+//   - opts: options applied to the driver, e.g. WithConfig, WithExecutor, WithRecorder or WithRecovery
+//
 // Returns:
 //   - *Driver: Configured driver object ready for automation
-func New() *Driver {
+func New(opts ...Option) *Driver {
+	d, _ := NewContext(context.Background(), opts...)
+	return d
+}
+
+// NewContext creates and initializes a new driver instance like New,
+// reporting a failed initialization on Android
+// Parameters:
+//   - ctx: context controlling the initialization of the device on Android
+//   - opts: options applied to the driver
+//
+// Returns:
+//   - *Driver: Configured driver object, also returned along with an error
+//   - error: nil if successful, otherwise the error of the initialization,
+//     e.g. of Provision, or ctx.Err() if ctx is done
+func NewContext(ctx context.Context, opts ...Option) (*Driver, error) {
 	var d = &Driver{
-		os: runtime.GOOS,
+		os:     runtime.GOOS,
+		adb:    newAdbClient(ADB_SERVER_ADDR),
+		config: DefaultConfig(),
+	}
+
+	if socket := os.Getenv("ADB_SERVER_SOCKET"); socket != "" {
+		d.adb = newAdbClient(parseServerAddr(socket))
 	}
 
 	// Set shell based on operating system
@@ -28,10 +104,43 @@ func New() *Driver {
 		d.shell = "bash" // For macOS and Linux
 	}
 
+	for _, opt := range opts {
+		opt(d)
+	}
+	for _, set := range d.settings {
+		set(&d.config)
+	}
+
+	d.http = &http.Client{Transport: newTransport(d.config.DNSServer)}
+	d.u2 = newDriverU2Client(d)
+	d.supervisor = newU2Supervisor()
+
+	if d.recovery != nil && d.recovery.policy.WaitTimeout <= 0 {
+		d.recovery.policy.WaitTimeout = d.config.WaitTimeout
+	}
+
+	if d.executor == nil {
+		if d.os == "android" {
+			d.executor = newLocalExecutor(d.shell, d.config.RootPath)
+		} else {
+			d.executor = newAdbExecutor(d.adb, d.shell, d.config.RootPath)
+		}
+	}
+
+	if d.recorder != nil {
+		if d.recorder.inner == nil {
+			d.recorder.inner = d.executor
+		}
+		if d.recorder.client == nil {
+			d.recorder.client = d.http
+		}
+		d.executor = d.recorder
+	}
+
 	// Initialize if running on Android
 	if d.os == "android" {
-		d.initialize()
+		return d, d.initialize(ctx)
 	}
 
-	return d
+	return d, nil
 }
@@ -0,0 +1,13 @@
+package driver
+
+import "testing"
+
+// newFakeDriver creates a driver running its commands with a fakeExecutor
+func newFakeDriver(t *testing.T, fake *fakeExecutor) *Driver {
+	t.Helper()
+
+	d := New(WithExecutor(fake))
+	d.device = "emulator-5554"
+
+	return d
+}
@@ -1,36 +1,26 @@
 package driver
 
 import (
-	"fmt"
+	"context"
 	"strings"
 )
 
 // Dump retrieves the current UI view hierarchy from the device
+// Parameters:
+//   - ctx: context controlling the server check and the request
+//
 // Returns:
 //   - string: XML representation of the UI hierarchy
 //   - error: nil if successful, otherwise error details
-func (d *Driver) dump() (string, error) {
-	if running, _ := d.checkUiAutomator(); !running {
-		d.startUiAutomator()
+func (d *Driver) dump(ctx context.Context) (string, error) {
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return "", err
 	}
 
-	ip := d.GetIP()
-	url := fmt.Sprintf("http://%s:9008/jsonrpc/0", ip)
-
-	res, err := Request(&Requester{
-		Url:    url,
-		Method: "POST",
-		Data: map[string]interface{}{
-			"jsonrpc": "2.0",
-			"id":      1,
-			"method":  "dumpWindowHierarchy",
-			"params":  []interface{}{false, 50},
-		},
-	})
-
+	res, err := d.u2.DumpWindowHierarchy(ctx, false, 50)
 	if err != nil {
 		return "", err
 	}
 
-	return strings.TrimSpace((res["result"].(string))), nil
+	return strings.TrimSpace(res), nil
 }
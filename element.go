@@ -1,14 +1,90 @@
 package driver
 
 import (
-	"fmt"
-	"strings"
+	"context"
+	"errors"
+	"image"
 	"time"
+
+	"github.com/beevik/etree"
 )
 
-// element represents a UI element in the Android UI hierarchy
+// Element is a UI element of the Android UI hierarchy, returned by the
+// lookups of Driver and Document.
+// Methods may be added to Element in later versions, so code outside this
+// package should not implement it: a mock should embed Element and override
+// the methods it needs, so that it keeps compiling.
+type Element interface {
+	// Attributes
+	Text() string                    // text attribute
+	ContentDesc() string             // content-desc attribute
+	ClassName() string               // class attribute
+	ResourceID() string              // resource-id attribute
+	Checked() bool                   // whether the element is checked
+	Selected() bool                  // whether the element is selected
+	Index() int                      // index among its siblings
+	GetBounds() *Bounds              // bounding box on the screen
+	GetAttribute(name string) string // any attribute, empty if missing
+
+	// Actions
+	Tap()
+	TapContext(ctx context.Context) error
+	LongTap()
+	LongTapContext(ctx context.Context) error
+	Swipe(direction Direction)
+	SwipeContext(ctx context.Context, direction Direction) error
+	Input(text string)
+	InputContext(ctx context.Context, text string) error
+	Clear()
+	ClearContext(ctx context.Context) error
+	Search()
+	SearchContext(ctx context.Context) error
+	Enter()
+	EnterContext(ctx context.Context) error
+	Next()
+	NextContext(ctx context.Context) error
+	Send()
+	SendContext(ctx context.Context) error
+	Previous()
+	PreviousContext(ctx context.Context) error
+	Go()
+	GoContext(ctx context.Context) error
+	Screenshot() image.Image
+	ScreenshotContext(ctx context.Context) (image.Image, error)
+	ScreenshotBase64() (string, error)
+	ScreenshotBase64Context(ctx context.Context) (string, error)
+
+	// Sub-queries, searching the descendants of the element only
+	FindElement(locator Locator) (Element, error)
+	FindElements(locator Locator) ([]Element, error)
+	SelectElement(xpath string) (Element, error)
+	SelectElements(xpath string) ([]Element, error)
+	ByText(text string) Element
+	ByContentDesc(contentDesc string) Element
+	ByClass(className string) Element
+	ByResourceID(resourceID string) Element
+	ByStartsWithText(text string) Element
+	ByEndsWithText(text string) Element
+	ByStartsWithContentDesc(contentDesc string) Element
+	ByEndsWithContentDesc(contentDesc string) Element
+	ByStartsWithClass(className string) Element
+	ByEndsWithClass(className string) Element
+	ByStartsWithResourceID(resourceID string) Element
+	ByEndsWithResourceID(resourceID string) Element
+
+	// Relatives, in the hierarchy or on the screen, searching the whole screen
+	Parent() Element
+	Children() []Element
+	Siblings() []Element
+	Child(locator Locator) Element
+	Below(locator Locator) Element
+	RightOf(locator Locator) Element
+	Near(locator Locator, radius int) Element
+}
+
+// element is the Element of a hierarchy node
 type element struct {
-	*document     // embedded document
+	*Document     // embedded document, selecting the node
 	x         int // x coordinate of element
 	y         int // y coordinate of element
 }
@@ -31,264 +107,273 @@ const (
 	EndsWithResourceID    Selector = "ends-with-resource-id"
 )
 
-// By represents a selector and its value
+// By represents a selector and its value, the simplest Locator
 type By struct {
 	Selector Selector
 	Value    string
 	Timeout  int
 }
 
-// FindElement finds the first UI element matching the XPath expression
+// FindElement finds the first UI element located by a Locator. The lookups
+// of a Document search the whole screen, those of an Element its descendants
+// only, an XPath such as //node included.
 // Parameters:
-//   - xpath: XPath expression to locate the element
+//   - locator: a By, a Query, e.g. And(HasClass(Eq("android.widget.Button")), IsEnabled(true)),
+//     or an XPath, e.g. XPath(`//node[@text="OK"]`), see SelectElement for errors
 //
 // Returns:
-//   - *element: Matching element or nil if not found
-func (d *document) FindElement(xpath string) *element {
-	el := d.root
-	if d.element != nil {
-		el = d.element
+//   - Element: Matching element or nil if not found
+//   - error: ErrSelectorEmpty if the locator is empty, ErrElementNotFound if
+//     nothing matches, or why the locator is invalid, e.g. a bad Regex or an
+//     *XPathError
+func (d *Document) FindElement(locator Locator) (Element, error) {
+	found, err := d.locate(locator, true)
+	if err != nil {
+		return nil, err
 	}
-
-	ele := el.FindElement(xpath)
-	if ele == nil {
-		return nil
-	}
-
-	doc := &document{
-		d:       d.d,
-		RawXML:  d.RawXML,
-		root:    el,
-		element: ele,
+	if len(found) == 0 {
+		return nil, ErrElementNotFound
 	}
 
-	e := &element{document: doc}
-
-	bounds := e.GetBounds()
-	// Calculate center point
-	x := (bounds.LTX + bounds.RBX) / 2
-	y := (bounds.LTY + bounds.RBY) / 2
-
-	e.x = x
-	e.y = y
-
-	return e
+	return found[0], nil
 }
 
-// FindElements finds all UI elements matching the XPath expression
+// FindElements finds all UI elements located by a Locator, in document order,
+// searching like FindElement
 // Parameters:
-//   - xpath: XPath expression to locate elements
+//   - locator: a By, a Query or an XPath
 //
 // Returns:
-//   - []*element: Slice of matching elements or nil if none found
-func (d *document) FindElements(xpath string) []*element {
-	el := d.root
-	if d.element != nil {
-		el = d.element
-	}
+//   - []Element: Slice of matching elements or nil if none found
+//   - error: ErrSelectorEmpty if the locator is empty, or why it is invalid,
+//     e.g. a bad Regex or an *XPathError
+func (d *Document) FindElements(locator Locator) ([]Element, error) {
+	return d.locate(locator, false)
+}
 
-	eles := el.FindElements(xpath)
-	if len(eles) == 0 {
-		return nil
+// locate walks the nodes below the current one and returns the located ones,
+// an XPath being evaluated once
+func (d *Document) locate(locator Locator, first bool) ([]Element, error) {
+	if isEmptyLocator(locator) {
+		return nil, ErrSelectorEmpty
 	}
+	if err := locatorError(locator); err != nil {
+		return nil, err
+	}
+
+	scope := d.scope()
 
-	es := make([]*element, 0, len(eles))
-	for _, ele := range eles {
-		doc := &document{
-			d:       d.d,
-			RawXML:  d.RawXML,
-			root:    el,
-			element: ele,
+	if x, ok := locator.(XPath); ok {
+		nodes, err := selectXPath(string(x), scope)
+		if err != nil {
+			return nil, err
 		}
+		if first && len(nodes) > 1 {
+			nodes = nodes[:1]
+		}
+
+		var found []Element
+		for _, node := range nodes {
+			found = append(found, d.newElement(scope, node))
+		}
+		return found, nil
+	}
 
-		e := &element{document: doc}
+	var found []Element
+	var cache matchCache
+	var walk func(parent *etree.Element) bool
+	walk = func(parent *etree.Element) bool {
+		for _, child := range parent.ChildElements() {
+			if isNode(child) && locator.match(child, &cache) {
+				found = append(found, d.newElement(scope, child))
+				if first {
+					return false
+				}
+			}
+			if !walk(child) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(scope)
 
-		bounds := e.GetBounds()
+	if cache.err != nil {
+		return nil, cache.err
+	}
+	return found, nil
+}
 
-		x := (bounds.LTX + bounds.RBX) / 2
-		y := (bounds.LTY + bounds.RBY) / 2
+// scope returns the node searched by the queries, the selected node or the root
+func (d *Document) scope() *etree.Element {
+	d.attach()
 
-		e.x = x
-		e.y = y
+	if d.element != nil {
+		return d.element
+	}
+	return d.root
+}
 
-		es = append(es, e)
+// newElement creates the element of a node found below scope
+func (d *Document) newElement(scope, node *etree.Element) *element {
+	doc := &Document{
+		d:       d.d,
+		RawXML:  d.RawXML,
+		root:    scope,
+		element: node,
 	}
 
-	return es
+	e := &element{Document: doc}
+
+	bounds := e.GetBounds()
+	// Calculate center point
+	e.x = (bounds.LTX + bounds.RBX) / 2
+	e.y = (bounds.LTY + bounds.RBY) / 2
+
+	return e
 }
 
 // ByText finds element by text attribute
-func (d *document) ByText(text string) *element {
-	return d.FindElement(fmt.Sprintf("//node[@text='%s']", text))
+func (d *Document) ByText(text string) Element {
+	el, _ := d.FindElement(By{Selector: Text, Value: text})
+	return el
 }
 
 // ByContentDesc finds element by content-desc attribute
-func (d *document) ByContentDesc(contentDesc string) *element {
-	return d.FindElement(fmt.Sprintf("//node[@content-desc='%s']", contentDesc))
+func (d *Document) ByContentDesc(contentDesc string) Element {
+	el, _ := d.FindElement(By{Selector: ContentDesc, Value: contentDesc})
+	return el
 }
 
 // ByClass finds element by class attribute
-func (d *document) ByClass(className string) *element {
-	return d.FindElement(fmt.Sprintf("//node[@class='%s']", className))
+func (d *Document) ByClass(className string) Element {
+	el, _ := d.FindElement(By{Selector: Class, Value: className})
+	return el
 }
 
 // ByResourceID finds element by resource-id attribute
-func (d *document) ByResourceID(resourceID string) *element {
-	return d.FindElement(fmt.Sprintf("//node[@resource-id='%s']", resourceID))
+func (d *Document) ByResourceID(resourceID string) Element {
+	el, _ := d.FindElement(By{Selector: ResourceID, Value: resourceID})
+	return el
 }
 
 // ByStartsWithText finds element by text attribute starting with given value
-func (d *document) ByStartsWithText(text string) *element {
-	elements := d.FindElements("//node[@text]")
-	for _, e := range elements {
-		_text := e.Text()
-		if _text != "" && strings.HasPrefix(_text, text) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByStartsWithText(text string) Element {
+	el, _ := d.FindElement(By{Selector: StartsWithText, Value: text})
+	return el
 }
 
 // ByEndsWithText finds element by text attribute ending with given value
-func (d *document) ByEndsWithText(text string) *element {
-	elements := d.FindElements("//node[@text]")
-	for _, e := range elements {
-		_text := e.Text()
-		if _text != "" && strings.HasSuffix(_text, text) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByEndsWithText(text string) Element {
+	el, _ := d.FindElement(By{Selector: EndsWithText, Value: text})
+	return el
 }
 
 // ByStartsWithContentDesc finds element by content-desc attribute starting with given value
-func (d *document) ByStartsWithContentDesc(contentDesc string) *element {
-	elements := d.FindElements("//node[@content-desc]")
-	for _, e := range elements {
-		_contentDesc := e.ContentDesc()
-		if _contentDesc != "" && strings.HasPrefix(_contentDesc, contentDesc) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByStartsWithContentDesc(contentDesc string) Element {
+	el, _ := d.FindElement(By{Selector: StartsWithContentDesc, Value: contentDesc})
+	return el
 }
 
 // ByEndsWithContentDesc finds element by content-desc attribute ending with given value
-func (d *document) ByEndsWithContentDesc(contentDesc string) *element {
-	elements := d.FindElements("//node[@content-desc]")
-	for _, e := range elements {
-		_contentDesc := e.ContentDesc()
-		if _contentDesc != "" && strings.HasSuffix(_contentDesc, contentDesc) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByEndsWithContentDesc(contentDesc string) Element {
+	el, _ := d.FindElement(By{Selector: EndsWithContentDesc, Value: contentDesc})
+	return el
 }
 
 // ByStartsWithClass finds element by class attribute starting with given value
-func (d *document) ByStartsWithClass(className string) *element {
-	elements := d.FindElements("//node[@class]")
-	for _, e := range elements {
-		_className := e.GetAttribute("class")
-		if _className != "" && strings.HasPrefix(_className, className) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByStartsWithClass(className string) Element {
+	el, _ := d.FindElement(By{Selector: StartsWithClass, Value: className})
+	return el
 }
 
 // ByEndsWithClass finds element by class attribute ending with given value
-func (d *document) ByEndsWithClass(className string) *element {
-	elements := d.FindElements("//node[@class]")
-	for _, e := range elements {
-		_className := e.GetAttribute("class")
-		if _className != "" && strings.HasSuffix(_className, className) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByEndsWithClass(className string) Element {
+	el, _ := d.FindElement(By{Selector: EndsWithClass, Value: className})
+	return el
 }
 
 // ByStartsWithResourceID finds element by resource-id attribute starting with given value
-func (d *document) ByStartsWithResourceID(resourceID string) *element {
-	elements := d.FindElements("//node[@resource-id]")
-	for _, e := range elements {
-		_resourceID := e.GetAttribute("resource-id")
-		if _resourceID != "" && strings.HasPrefix(_resourceID, resourceID) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByStartsWithResourceID(resourceID string) Element {
+	el, _ := d.FindElement(By{Selector: StartsWithResourceID, Value: resourceID})
+	return el
 }
 
 // ByEndsWithResourceID finds element by resource-id attribute ending with given value
-func (d *document) ByEndsWithResourceID(resourceID string) *element {
-	elements := d.FindElements("//node[@resource-id]")
-	for _, e := range elements {
-		_resourceID := e.GetAttribute("resource-id")
-		if _resourceID != "" && strings.HasSuffix(_resourceID, resourceID) {
-			return e
-		}
-	}
-	return nil
+func (d *Document) ByEndsWithResourceID(resourceID string) Element {
+	el, _ := d.FindElement(By{Selector: EndsWithResourceID, Value: resourceID})
+	return el
 }
 
 // WaitElement waits for an element to appear on the screen and returns it.
-// It polls periodically until the element is found or timeout is reached.
+// It polls periodically until the element is found or timeout is reached,
+// or lets the UiAutomator server wait when Config.Lookup is LookupSelector
+// and the locator is a By. A Query has no UiSelector equivalent, so it is
+// always searched in hierarchy dumps, whatever Config.Lookup.
+// The watchers registered with Watch run on every dump, before the search.
+//
+// Parameters:
+//   - locator: a By, holding the search criteria and timeout, a Query,
+//     whose timeout is set with Within, or an XPath, waited for Config.WaitTimeout
+//
+// Returns:
+//   - Element: The found UI element, or nil if not found within timeout
+//   - error: ErrSelectorEmpty if selector is empty, ErrElementNotFound if element not found,
+//     or why the locator is invalid, e.g. a bad Regex or an *XPathError, without waiting
+func (d *Driver) WaitElement(locator Locator) (Element, error) {
+	return d.WaitElementContext(context.Background(), locator)
+}
+
+// WaitElementContext waits for an element like WaitElement, giving up early when ctx is done.
 //
 // Parameters:
-//   - by: Selector configuration containing the search criteria and timeout
+//   - ctx: Context bounding the whole wait, in addition to the locator timeout
+//   - locator: a By, a Query or an XPath
 //
 // Returns:
-//   - *element: The found UI element, or nil if not found within timeout
-//   - error: ErrSelectorEmpty if selector is empty, ErrElementNotFound if element not found
-func (d *Driver) WaitElement(by By) (*element, error) {
-	if by.Timeout == 0 {
-		by.Timeout = WAIT_TIMEOUT
+//   - Element: The found UI element, or nil if not found
+//   - error: ErrSelectorEmpty, ErrElementNotFound, an invalid locator error,
+//     the server error with LookupSelector, or ctx.Err() if ctx is done first
+func (d *Driver) WaitElementContext(ctx context.Context, locator Locator) (Element, error) {
+	timeout := locatorTimeout(locator)
+	if timeout == 0 {
+		timeout = d.config.WaitTimeout
 	}
 
-	if by.Selector == "" {
+	if isEmptyLocator(locator) {
 		return nil, ErrSelectorEmpty
 	}
+	if err := locatorError(locator); err != nil {
+		return nil, err
+	}
 
-	deadline := time.Now().Add(time.Duration(by.Timeout) * time.Millisecond)
+	if by, ok := locator.(By); ok && d.config.Lookup == LookupSelector {
+		if sel, ok := u2Selector(by); ok {
+			return d.WaitU2ElementContext(ctx, sel, timeout)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
 
 	for time.Now().Before(deadline) {
-		doc := d.Document()
-
-		var el *element
-		switch by.Selector {
-		case Text:
-			el = doc.ByText(by.Value)
-		case ContentDesc:
-			el = doc.ByContentDesc(by.Value)
-		case Class:
-			el = doc.ByClass(by.Value)
-		case ResourceID:
-			el = doc.ByResourceID(by.Value)
-		case StartsWithText:
-			el = doc.ByStartsWithText(by.Value)
-		case EndsWithText:
-			el = doc.ByEndsWithText(by.Value)
-		case StartsWithContentDesc:
-			el = doc.ByStartsWithContentDesc(by.Value)
-		case EndsWithContentDesc:
-			el = doc.ByEndsWithContentDesc(by.Value)
-		case StartsWithClass:
-			el = doc.ByStartsWithClass(by.Value)
-		case EndsWithClass:
-			el = doc.ByEndsWithClass(by.Value)
-		case StartsWithResourceID:
-			el = doc.ByStartsWithResourceID(by.Value)
-		case EndsWithResourceID:
-			el = doc.ByEndsWithResourceID(by.Value)
+		doc := d.watchDocument(ctx, d.DocumentContext(ctx))
+
+		if doc != nil {
+			el, err := doc.FindElement(locator)
+			if err == nil {
+				return el, nil
+			}
+			// An expression failing on this screen, e.g. selecting texts, fails on every screen
+			if !errors.Is(err, ErrElementNotFound) {
+				return nil, err
+			}
 		}
 
-		if el != nil {
-			return el, nil
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
 		}
-
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	return nil, ErrElementNotFound
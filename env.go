@@ -1,13 +1,23 @@
 package driver
 
 const (
-	TEMP_PATH        = "temp"
-	ROOT_PATH        = "/data/local/tmp"
-	IMAGE_PATH       = ROOT_PATH + "/screen.png"
-	U2_URL           = "https://public.uiauto.devsleep.com/u2jar/0.1.5/u2.jar"
-	U2_PATH          = ROOT_PATH + "/u2.jar"
-	DAEMON_PATH      = ROOT_PATH + "/driver-daemon.log"
-	ADB_KEYBOARD     = "com.android.starime/.StarIME"
-	ADB_KEYBOARD_URL = "https://cf.ghproxy.cc/https://github.com/shi-yunsheng/star-ime/releases/download/v1.0.0/star-ime.apk"
-	WAIT_TIMEOUT     = 10000
+	TEMP_PATH          = "temp"
+	ROOT_PATH          = "/data/local/tmp"
+	U2_URL             = "https://public.uiauto.devsleep.com/u2jar/0.1.5/u2.jar"
+	U2_PATH            = ROOT_PATH + "/u2.jar"
+	U2_PORT            = 9008
+	DAEMON_PATH        = ROOT_PATH + "/driver-daemon.log"
+	ADB_KEYBOARD       = "com.android.starime/.StarIME"
+	ADB_KEYBOARD_URL   = "https://cf.ghproxy.cc/https://github.com/shi-yunsheng/star-ime/releases/download/v1.0.0/star-ime.apk"
+	WAIT_TIMEOUT       = 10000
+	ADB_SERVER_ADDR    = "127.0.0.1:5037"
+	POLL_INTERVAL      = 1000
+	DNS_SERVER         = "114.114.114.114:53"
+	RPC_TIMEOUT        = 30000
+	U2_HEALTH_INTERVAL = 5000
 )
+
+// IMAGE_PATH is the device path of screenshots with the default RootPath.
+//
+// Deprecated: screenshots are written to Config.RootPath + "/screen.png", use Config.RootPath.
+const IMAGE_PATH = ROOT_PATH + "/screen.png"
@@ -3,11 +3,21 @@ package driver
 import "fmt"
 
 var (
-	ErrDeviceNotFound  = fmt.Errorf("device not found")
-	ErrDeviceOffline   = fmt.Errorf("device offline")
-	ErrMultipleDevices = fmt.Errorf("multiple devices found")
-	ErrFileNotFound    = fmt.Errorf("file not found")
-	ErrDownloadFailed  = fmt.Errorf("download failed")
-	ErrSelectorEmpty   = fmt.Errorf("selector is empty")
-	ErrElementNotFound = fmt.Errorf("element not found")
+	ErrDeviceNotFound         = fmt.Errorf("device not found")
+	ErrDeviceOffline          = fmt.Errorf("device offline")
+	ErrDeviceUnauthorized     = fmt.Errorf("device unauthorized")
+	ErrMultipleDevices        = fmt.Errorf("multiple devices found")
+	ErrFileNotFound           = fmt.Errorf("file not found")
+	ErrDownloadFailed         = fmt.Errorf("download failed")
+	ErrChecksumMismatch       = fmt.Errorf("checksum mismatch")
+	ErrSelectorEmpty          = fmt.Errorf("selector is empty")
+	ErrElementNotFound        = fmt.Errorf("element not found")
+	ErrUnscripted             = fmt.Errorf("unscripted command")
+	ErrPairingFailed          = fmt.Errorf("pairing failed")
+	ErrConnectFailed          = fmt.Errorf("connection failed")
+	ErrTCPIPFailed            = fmt.Errorf("tcpip mode failed")
+	ErrNotRecorded            = fmt.Errorf("command not in transcript")
+	ErrUiAutomatorUnavailable = fmt.Errorf("uiautomator server unavailable")
+	ErrToastNotFound          = fmt.Errorf("toast not found")
+	ErrInstallFailed          = fmt.Errorf("install failed")
 )
@@ -0,0 +1,207 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Executor runs the commands issued by a Driver.
+// The default executor talks to the ADB server (or to the local shell when
+// running on Android); tests can inject another one with WithExecutor.
+type Executor interface {
+	// Shell runs a quoted command line in the shell of the device identified by serial.
+	// A non-zero exit status is reported in the result, not as an error.
+	Shell(ctx context.Context, serial, cmdline string) (*Result, error)
+
+	// Host runs an adb host command such as "devices" or "push" for the device
+	// identified by serial, which is empty for commands not bound to a device.
+	Host(ctx context.Context, serial string, args ...string) (*Result, error)
+}
+
+// oneshotKey marks contexts whose commands must not use the shell session
+type oneshotKey struct{}
+
+// withOneshot returns a context asking the executor to run the command in a
+// dedicated shell, for long-running commands that would block the session
+func withOneshot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oneshotKey{}, true)
+}
+
+// isOneshot reports whether ctx was created by withOneshot
+func isOneshot(ctx context.Context) bool {
+	oneshot, _ := ctx.Value(oneshotKey{}).(bool)
+	return oneshot
+}
+
+// sessionPool keeps one persistent shell session per device serial
+type sessionPool struct {
+	open func(serial string) func(ctx context.Context) (io.ReadWriteCloser, error)
+	root string // device working directory of the sessions
+
+	mu       sync.Mutex
+	sessions map[string]*shellSession
+}
+
+// get returns the session of the device, creating it on first use
+func (p *sessionPool) get(serial string) *shellSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sessions == nil {
+		p.sessions = make(map[string]*shellSession)
+	}
+
+	s, ok := p.sessions[serial]
+	if !ok {
+		s = newShellSession(p.open(serial), p.root)
+		p.sessions[serial] = s
+	}
+
+	return s
+}
+
+// Close closes every session of the pool
+func (p *sessionPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for serial, s := range p.sessions {
+		s.Close()
+		delete(p.sessions, serial)
+	}
+
+	return nil
+}
+
+// adbExecutor runs commands through the ADB server, used on PC
+type adbExecutor struct {
+	adb   *adbClient // ADB server client
+	shell string     // host shell running the adb binary (powershell/bash)
+	sessionPool
+}
+
+// newAdbExecutor creates the executor used on PC
+func newAdbExecutor(adb *adbClient, shell, root string) *adbExecutor {
+	e := &adbExecutor{adb: adb, shell: shell}
+	e.root = root
+	e.open = func(serial string) func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return func(ctx context.Context) (io.ReadWriteCloser, error) {
+			return adb.openShell(ctx, serial)
+		}
+	}
+	return e
+}
+
+// Shell runs the command line through the device session, falling back to a
+// dedicated shell when the session cannot be opened
+func (e *adbExecutor) Shell(ctx context.Context, serial, cmdline string) (*Result, error) {
+	if !isOneshot(ctx) {
+		res, err := e.get(serial).run(ctx, cmdline)
+		if !errors.Is(err, errSessionUnavailable) {
+			return res, err
+		}
+	}
+
+	return e.adb.run(ctx, serial, cmdline)
+}
+
+// Host answers "devices", "pair", "connect", "disconnect", "tcpip", "forward" and
+// "reverse" natively and runs other commands with the adb binary
+func (e *adbExecutor) Host(ctx context.Context, serial string, args ...string) (*Result, error) {
+	switch {
+	case len(args) == 1 && args[0] == "devices", len(args) == 2 && args[0] == "devices" && args[1] == "-l":
+		list, err := e.adb.devices(ctx, len(args) == 2)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Stdout: "List of devices attached\n" + list}, nil
+	case len(args) == 3 && args[0] == "pair":
+		return hostResult(e.adb.host(ctx, "host:pair:"+args[2]+":"+args[1]))
+	case len(args) == 2 && args[0] == "connect":
+		return hostResult(e.adb.host(ctx, "host:connect:"+args[1]))
+	case len(args) <= 2 && len(args) > 0 && args[0] == "disconnect":
+		return hostResult(e.adb.host(ctx, "host:disconnect:"+strings.Join(args[1:], "")))
+	case len(args) == 2 && args[0] == "tcpip":
+		output, err := e.adb.service(ctx, serial, "tcpip:"+args[1])
+		return hostResult(string(output), err)
+	case len(args) > 1 && (args[0] == "forward" || args[0] == "reverse"):
+		return e.adb.forward(ctx, serial, args)
+	}
+
+	argv := append([]string{"adb"}, e.adb.serverArgs()...)
+	if serial != "" {
+		argv = append(argv, "-s", serial)
+	}
+	argv = append(argv, args...)
+
+	return runLocal(ctx, e.shell, hostArgs(e.shell, argv)...)
+}
+
+// TrackDevices reports every change of the device list from the ADB server stream
+func (e *adbExecutor) TrackDevices(ctx context.Context, fn func([]DeviceInfo)) error {
+	return e.adb.trackDevices(ctx, func(list string) {
+		fn(parseDevices(list))
+	})
+}
+
+// OpenSync opens a session of the ADB sync protocol with the device
+func (e *adbExecutor) OpenSync(ctx context.Context, serial string) (syncSession, error) {
+	conn, err := e.adb.sync(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// hostResult turns the reply of a native host command into the result the adb
+// binary would give, a FAIL response becoming an error message and exit status 1
+func hostResult(reply string, err error) (*Result, error) {
+	var adbErr *AdbError
+	if errors.As(err, &adbErr) {
+		return &Result{Stderr: "error: " + adbErr.Message + "\n", ExitCode: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Stdout: strings.TrimRight(reply, "\n") + "\n"}, nil
+}
+
+// localExecutor runs commands with the local shell, used when running on Android
+type localExecutor struct {
+	shell string // local shell (sh)
+	sessionPool
+}
+
+// newLocalExecutor creates the executor used on Android
+func newLocalExecutor(shell, root string) *localExecutor {
+	e := &localExecutor{shell: shell}
+	e.root = root
+	e.open = func(string) func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return func(context.Context) (io.ReadWriteCloser, error) {
+			return openLocalShell(shell)
+		}
+	}
+	return e
+}
+
+// Shell runs the command line through the local session, falling back to a
+// dedicated shell when the session cannot be opened
+func (e *localExecutor) Shell(ctx context.Context, serial, cmdline string) (*Result, error) {
+	if !isOneshot(ctx) {
+		res, err := e.get(serial).run(ctx, cmdline)
+		if !errors.Is(err, errSessionUnavailable) {
+			return res, err
+		}
+	}
+
+	return runLocal(ctx, e.shell, "-c", cmdline)
+}
+
+// Host runs adb host commands with the local shell, on Android they are plain device commands
+func (e *localExecutor) Host(ctx context.Context, serial string, args ...string) (*Result, error) {
+	return runLocal(ctx, e.shell, "-c", ShellJoin(args))
+}
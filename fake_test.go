@@ -0,0 +1,346 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeRule is a scripted response of a fakeExecutor
+type fakeRule struct {
+	pattern *regexp.Regexp // pattern matched against the command line
+	result  Result         // canned result
+	err     error          // canned error, returned instead of result if set
+	times   int            // remaining uses, 0 means unlimited
+}
+
+// fakeExecutor is an Executor serving scripted results, used to test the
+// driver without a phone.
+// Shell command lines are matched as sent to the device shell (e.g. "wm size"),
+// host commands are matched prefixed with "adb " (e.g. "adb devices") and
+// JSON-RPC requests prefixed with "rpc " (e.g. "rpc dumpWindowHierarchy"),
+// the stdout of their rule being the JSON value of the response result
+// and an *RPCError given to OnError being sent as the response error.
+// Rules are tried in the order they were added.
+// Push and Pull transfer files to and from an in-memory file system,
+// seeded with OnFile and read with File, their requests being recorded as
+// "sync <request> <path>" (e.g. "sync RECV /sdcard/screen.png").
+type fakeExecutor struct {
+	mu    sync.Mutex
+	rules []*fakeRule
+	calls []string
+	files map[string]fakeFile
+}
+
+// fakeFile is a file of the device file system of a fakeExecutor
+type fakeFile struct {
+	data  []byte
+	mode  os.FileMode
+	mtime time.Time
+}
+
+// newFakeExecutor creates a fakeExecutor without rules
+// Returns:
+//   - *fakeExecutor: the executor, to be scripted with On, OnResult and OnError
+func newFakeExecutor() *fakeExecutor {
+	return &fakeExecutor{}
+}
+
+// On answers commands matching pattern with the given stdout and exit status 0
+// Parameters:
+//   - pattern: regular expression matched against the command line
+//   - stdout: output returned by matching commands
+//
+// Returns:
+//   - *fakeExecutor: the executor, for chaining
+func (f *fakeExecutor) On(pattern, stdout string) *fakeExecutor {
+	return f.OnResult(pattern, Result{Stdout: stdout})
+}
+
+// OnResult answers commands matching pattern with the given result
+// Parameters:
+//   - pattern: regular expression matched against the command line
+//   - result: result returned by matching commands, e.g. with a non-zero ExitCode
+//
+// Returns:
+//   - *fakeExecutor: the executor, for chaining
+func (f *fakeExecutor) OnResult(pattern string, result Result) *fakeExecutor {
+	f.add(&fakeRule{pattern: regexp.MustCompile(pattern), result: result})
+	return f
+}
+
+// OnError answers commands matching pattern with a transport error
+// Parameters:
+//   - pattern: regular expression matched against the command line
+//   - err: error returned by matching commands
+//
+// Returns:
+//   - *fakeExecutor: the executor, for chaining
+func (f *fakeExecutor) OnError(pattern string, err error) *fakeExecutor {
+	f.add(&fakeRule{pattern: regexp.MustCompile(pattern), err: err})
+	return f
+}
+
+// Once limits the last added rule to a single use, so a later rule matching
+// the same command can script the next answer
+// Returns:
+//   - *fakeExecutor: the executor, for chaining
+func (f *fakeExecutor) Once() *fakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.rules) > 0 {
+		f.rules[len(f.rules)-1].times = 1
+	}
+	return f
+}
+
+// OnFile creates a device file, read by Pull and by the methods pulling files
+// such as Screenshot
+// Parameters:
+//   - remote: absolute path of the file on the device
+//   - data: content of the file
+//
+// Returns:
+//   - *fakeExecutor: the executor, for chaining
+func (f *fakeExecutor) OnFile(remote string, data []byte) *fakeExecutor {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.putFile(remote, fakeFile{data: data, mode: 0644, mtime: time.Now()})
+	return f
+}
+
+// File returns a device file, e.g. one written by Push
+// Parameters:
+//   - remote: absolute path of the file on the device
+//
+// Returns:
+//   - []byte: content of the file
+//   - bool: false if the file does not exist
+func (f *fakeExecutor) File(remote string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, ok := f.files[path.Clean(remote)]
+	return file.data, ok
+}
+
+// putFile creates or replaces a device file, f.mu being held
+func (f *fakeExecutor) putFile(remote string, file fakeFile) {
+	if f.files == nil {
+		f.files = make(map[string]fakeFile)
+	}
+	f.files[path.Clean(remote)] = file
+}
+
+// Calls returns every command line received so far, in order
+func (f *fakeExecutor) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.calls...)
+}
+
+// add appends a rule
+func (f *fakeExecutor) add(rule *fakeRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.rules = append(f.rules, rule)
+}
+
+// Shell answers a device command line with the first matching rule
+func (f *fakeExecutor) Shell(ctx context.Context, serial, cmdline string) (*Result, error) {
+	return f.answer(ctx, cmdline)
+}
+
+// Host answers an adb host command with the first matching rule
+func (f *fakeExecutor) Host(ctx context.Context, serial string, args ...string) (*Result, error) {
+	return f.answer(ctx, "adb "+ShellJoin(args))
+}
+
+// CallRPC answers a JSON-RPC request with the first rule matching "rpc <method>"
+func (f *fakeExecutor) CallRPC(ctx context.Context, url string, request []byte) ([]byte, error) {
+	res, err := f.answer(ctx, "rpc "+rpcMethod(request))
+
+	var req struct {
+		ID json.RawMessage `json:"id"`
+	}
+	json.Unmarshal(request, &req)
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"error":   rpcErr,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      req.ID,
+		"result":  json.RawMessage(res.Stdout),
+	})
+}
+
+// answer records the command line and returns the result of the first matching rule
+func (f *fakeExecutor) answer(ctx context.Context, cmdline string) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, cmdline)
+
+	for i, rule := range f.rules {
+		if !rule.pattern.MatchString(cmdline) {
+			continue
+		}
+
+		if rule.times == 1 {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+		}
+
+		if rule.err != nil {
+			return nil, rule.err
+		}
+
+		res := rule.result
+		return &res, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnscripted, cmdline)
+}
+
+// OpenSync opens a transfer session with the in-memory file system
+func (f *fakeExecutor) OpenSync(ctx context.Context, serial string) (syncSession, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return &fakeSync{f: f}, nil
+}
+
+// fakeSync is a sync session of a fakeExecutor, directories being the
+// parents of its files
+type fakeSync struct {
+	f *fakeExecutor
+}
+
+// call records a sync request
+func (s *fakeSync) call(op, remote string) {
+	s.f.calls = append(s.f.calls, "sync "+op+" "+remote)
+}
+
+// lookup returns the information of a file or directory, Mode being 0 if it does not exist
+func (s *fakeSync) lookup(remote string) *syncStat {
+	remote = path.Clean(remote)
+	st := &syncStat{Name: path.Base(remote)}
+
+	if file, ok := s.f.files[remote]; ok {
+		st.Mode = uint32(file.mode.Perm()) | 0100000
+		st.Size = uint32(len(file.data))
+		st.Mtime = uint32(file.mtime.Unix())
+		return st
+	}
+
+	prefix := strings.TrimSuffix(remote, "/") + "/"
+	for name := range s.f.files {
+		if strings.HasPrefix(name, prefix) {
+			st.Mode = syncModeDir | 0755
+			break
+		}
+	}
+
+	return st
+}
+
+func (s *fakeSync) stat(remote string) (*syncStat, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+
+	s.call("STAT", remote)
+	return s.lookup(remote), nil
+}
+
+func (s *fakeSync) list(remote string) ([]*syncStat, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+
+	s.call("LIST", remote)
+
+	prefix := strings.TrimSuffix(path.Clean(remote), "/") + "/"
+	names := make(map[string]bool)
+	for name := range s.f.files {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			child, _, _ := strings.Cut(rest, "/")
+			names[child] = true
+		}
+	}
+
+	var entries []*syncStat
+	for name := range names {
+		entries = append(entries, s.lookup(prefix+name))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	return entries, nil
+}
+
+func (s *fakeSync) sendFile(r io.Reader, remote string, mode os.FileMode, mtime time.Time, total int64, progress func(SyncProgress)) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	s.f.mu.Lock()
+	s.call("SEND", remote)
+	s.f.putFile(remote, fakeFile{data: data, mode: mode, mtime: mtime})
+	s.f.mu.Unlock()
+
+	if progress != nil {
+		progress(SyncProgress{Path: remote, Bytes: int64(len(data)), Total: total})
+	}
+	return nil
+}
+
+func (s *fakeSync) recvFile(w io.Writer, remote string, total int64, progress func(SyncProgress)) error {
+	s.f.mu.Lock()
+	s.call("RECV", remote)
+	file, ok := s.f.files[path.Clean(remote)]
+	s.f.mu.Unlock()
+
+	if !ok {
+		return &SyncError{Op: "RECV", Path: remote, Message: "No such file or directory"}
+	}
+
+	if _, err := io.Copy(w, bytes.NewReader(file.data)); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(SyncProgress{Path: remote, Bytes: int64(len(file.data)), Total: total})
+	}
+	return nil
+}
+
+func (s *fakeSync) Close() error {
+	return nil
+}
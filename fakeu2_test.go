@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// fakeU2Handler answers a call of a fakeU2Server, returning the result or
+// an error, an *RPCError being sent as is and any other error as code -32000
+type fakeU2Handler func(params []json.RawMessage) (any, error)
+
+// fakeU2Server is an http.Handler speaking the JSON-RPC protocol of the
+// UiAutomator server, used to test U2Client without a phone:
+//
+//	fake := newFakeU2Server().On("click", true)
+//	srv := httptest.NewServer(fake)
+//	client := NewU2Client(srv.URL + "/jsonrpc/0")
+//
+// Methods without a handler are answered with a "method not found" error.
+type fakeU2Server struct {
+	mu       sync.Mutex
+	handlers map[string]fakeU2Handler
+	calls    []string
+}
+
+// newFakeU2Server creates a fakeU2Server without handlers
+// Returns:
+//   - *fakeU2Server: the server, to be scripted with On, OnError and Handle
+func newFakeU2Server() *fakeU2Server {
+	return &fakeU2Server{handlers: make(map[string]fakeU2Handler)}
+}
+
+// Handle answers a method with a function of its parameters
+// Parameters:
+//   - method: method name, e.g. "objInfo"
+//   - handler: function computing the answer
+//
+// Returns:
+//   - *fakeU2Server: the server, for chaining
+func (s *fakeU2Server) Handle(method string, handler fakeU2Handler) *fakeU2Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[method] = handler
+	return s
+}
+
+// On answers a method with a fixed result
+// Parameters:
+//   - method: method name, e.g. "dumpWindowHierarchy"
+//   - result: result, encoded to JSON
+//
+// Returns:
+//   - *fakeU2Server: the server, for chaining
+func (s *fakeU2Server) On(method string, result any) *fakeU2Server {
+	return s.Handle(method, func([]json.RawMessage) (any, error) {
+		return result, nil
+	})
+}
+
+// OnError answers a method with an error response
+// Parameters:
+//   - method: method name
+//   - code: JSON-RPC error code
+//   - message: error message, e.g. "UiObjectNotFoundException"
+//
+// Returns:
+//   - *fakeU2Server: the server, for chaining
+func (s *fakeU2Server) OnError(method string, code int, message string) *fakeU2Server {
+	return s.Handle(method, func([]json.RawMessage) (any, error) {
+		return nil, &RPCError{Code: code, Message: message}
+	})
+}
+
+// Calls returns the methods called so far, in order
+func (s *fakeU2Server) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.calls...)
+}
+
+// ServeHTTP answers a JSON-RPC request
+func (s *fakeU2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, req.Method)
+	handler := s.handlers[req.Method]
+	s.mu.Unlock()
+
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+
+	if handler == nil {
+		resp["error"] = &RPCError{Code: -32601, Message: "Method not found: " + req.Method}
+	} else if result, err := handler(req.Params); err == nil {
+		resp["result"] = result
+	} else if rpcErr, ok := err.(*RPCError); ok {
+		resp["error"] = rpcErr
+	} else {
+		resp["error"] = &RPCError{Code: -32000, Message: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -1,6 +1,9 @@
 package driver
 
-import "os"
+import (
+	"context"
+	"os"
+)
 
 // FileExists checks if a file exists at the given path
 // Parameters:
@@ -8,8 +11,18 @@ import "os"
 // Returns:
 //   - bool: true if file exists, false otherwise
 func (d *Driver) FileExists(path string) bool {
-	output, err := d.Run("test", "-e", path)
-	return err == nil && output == ""
+	return d.FileExistsContext(context.Background(), path)
+}
+
+// FileExistsContext checks if a file exists like FileExists, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - path: Path to check
+// Returns:
+//   - bool: true if file exists, false otherwise
+func (d *Driver) FileExistsContext(ctx context.Context, path string) bool {
+	_, err := d.RunResult(ctx, "test", "-e", path)
+	return err == nil
 }
 
 // DirExists checks if a directory exists at the given path
@@ -18,8 +31,18 @@ func (d *Driver) FileExists(path string) bool {
 // Returns:
 //   - bool: true if directory exists, false otherwise
 func (d *Driver) DirExists(path string) bool {
-	output, err := d.Run("test", "-d", path)
-	return err == nil && output == ""
+	return d.DirExistsContext(context.Background(), path)
+}
+
+// DirExistsContext checks if a directory exists like DirExists, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - path: Path to check
+// Returns:
+//   - bool: true if directory exists, false otherwise
+func (d *Driver) DirExistsContext(ctx context.Context, path string) bool {
+	_, err := d.RunResult(ctx, "test", "-d", path)
+	return err == nil
 }
 
 // CreateDir creates a directory and any necessary parent directories
@@ -28,7 +51,17 @@ func (d *Driver) DirExists(path string) bool {
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) CreateDir(path string) bool {
-	_, err := d.Run("mkdir", "-p", path)
+	return d.CreateDirContext(context.Background(), path)
+}
+
+// CreateDirContext creates a directory like CreateDir, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - path: Path where to create directory
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) CreateDirContext(ctx context.Context, path string) bool {
+	_, err := d.RunContext(ctx, "mkdir", "-p", path)
 	return err == nil
 }
 
@@ -39,7 +72,18 @@ func (d *Driver) CreateDir(path string) bool {
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) CreateFile(text, path string) bool {
-	_, err := d.Run("echo", text, ">", path)
+	return d.CreateFileContext(context.Background(), text, path)
+}
+
+// CreateFileContext creates a file like CreateFile, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - text: Content to write to file
+//   - path: Path where to create file
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) CreateFileContext(ctx context.Context, text, path string) bool {
+	_, err := d.RunContext(ctx, "sh", "-c", `echo "$1" > "$2"`, "sh", text, path)
 	return err == nil
 }
 
@@ -49,7 +93,17 @@ func (d *Driver) CreateFile(text, path string) bool {
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) DeleteFile(path string) bool {
-	_, err := d.Run("rm", "-rf", path)
+	return d.DeleteFileContext(context.Background(), path)
+}
+
+// DeleteFileContext deletes a file or directory like DeleteFile, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - path: Path to delete
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) DeleteFileContext(ctx context.Context, path string) bool {
+	_, err := d.RunContext(ctx, "rm", "-rf", path)
 	return err == nil
 }
 
@@ -60,7 +114,18 @@ func (d *Driver) DeleteFile(path string) bool {
 //   - string: Content of the file
 //   - error: nil if successful, otherwise error details
 func (d *Driver) ReadFile(path string) (string, error) {
-	text, err := d.Run("cat", path)
+	return d.ReadFileContext(context.Background(), path)
+}
+
+// ReadFileContext reads a file like ReadFile, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - path: Path of file to read
+// Returns:
+//   - string: Content of the file
+//   - error: nil if successful, otherwise error details
+func (d *Driver) ReadFileContext(ctx context.Context, path string) (string, error) {
+	text, err := d.RunContext(ctx, "cat", path)
 	if err != nil {
 		return "", err
 	}
@@ -74,7 +139,18 @@ func (d *Driver) ReadFile(path string) (string, error) {
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) CopyFile(src, dest string) bool {
-	_, err := d.Run("cp", src, dest)
+	return d.CopyFileContext(context.Background(), src, dest)
+}
+
+// CopyFileContext copies a file like CopyFile, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - src: Source path of file to copy
+//   - dest: Destination path of file to copy
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) CopyFileContext(ctx context.Context, src, dest string) bool {
+	_, err := d.RunContext(ctx, "cp", src, dest)
 	return err == nil
 }
 
@@ -85,7 +161,18 @@ func (d *Driver) CopyFile(src, dest string) bool {
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) MoveFile(src, dest string) bool {
-	_, err := d.Run("mv", src, dest)
+	return d.MoveFileContext(context.Background(), src, dest)
+}
+
+// MoveFileContext moves a file like MoveFile, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - src: Source path of file to move
+//   - dest: Destination path of file to move
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) MoveFileContext(ctx context.Context, src, dest string) bool {
+	_, err := d.RunContext(ctx, "mv", src, dest)
 	return err == nil
 }
 
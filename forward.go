@@ -0,0 +1,330 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PortForward is a port forwarding between the host and a device.
+// Endpoints use the adb syntax, e.g. "tcp:9008" or "localabstract:name".
+type PortForward struct {
+	Serial  string // device serial
+	Local   string // host side endpoint
+	Remote  string // device side endpoint
+	Reverse bool   // true if the device connects to the host (adb reverse)
+}
+
+// TCP returns the adb endpoint of a TCP port
+// Parameters:
+//   - port: TCP port, 0 to let adb pick a free port when forwarding
+//
+// Returns:
+//   - string: the endpoint, e.g. "tcp:9008"
+func TCP(port int) string {
+	return "tcp:" + strconv.Itoa(port)
+}
+
+// forwardSet remembers the forwardings created by a driver so that Cleanup removes them
+type forwardSet struct {
+	mu       sync.Mutex
+	forwards []PortForward
+	u2       PortForward // forwarding to the UiAutomator server
+}
+
+// u2Forward returns the forwarding to the UiAutomator server, if any
+func (s *forwardSet) u2Forward() PortForward {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.u2
+}
+
+// setU2Forward remembers the forwarding to the UiAutomator server
+func (s *forwardSet) setU2Forward(f PortForward) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.u2 = f
+}
+
+// add remembers a forwarding
+func (s *forwardSet) add(f PortForward) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forwards = append(s.forwards, f)
+}
+
+// remove forgets a forwarding
+func (s *forwardSet) remove(f PortForward) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.u2 == f {
+		s.u2 = PortForward{}
+	}
+
+	for i, known := range s.forwards {
+		if known == f {
+			s.forwards = append(s.forwards[:i], s.forwards[i+1:]...)
+			return
+		}
+	}
+}
+
+// take forgets and returns every forwarding
+func (s *forwardSet) take() []PortForward {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	forwards := s.forwards
+	s.forwards = nil
+	s.u2 = PortForward{}
+	return forwards
+}
+
+// Forward forwards connections to a host endpoint to a device endpoint.
+// The forwarding is removed by Cleanup, or earlier with RemoveForward.
+// Parameters:
+//   - local: host endpoint, TCP(0) to let adb pick a free port
+//   - remote: device endpoint, e.g. TCP(9008)
+//
+// Returns:
+//   - PortForward: the forwarding, with the port picked by adb if local was TCP(0)
+//   - error: nil if successful, otherwise error details
+func (d *Driver) Forward(local, remote string) (PortForward, error) {
+	return d.ForwardContext(context.Background(), local, remote)
+}
+
+// ForwardContext creates a forwarding like Forward, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//   - local: host endpoint, TCP(0) to let adb pick a free port
+//   - remote: device endpoint, e.g. TCP(9008)
+//
+// Returns:
+//   - PortForward: the forwarding, with the port picked by adb if local was TCP(0)
+//   - error: nil if successful, otherwise error details
+func (d *Driver) ForwardContext(ctx context.Context, local, remote string) (PortForward, error) {
+	res, err := d.RunResult(ctx, "forward", local, remote)
+	if err != nil {
+		return PortForward{}, err
+	}
+
+	if local == TCP(0) {
+		port, err := strconv.Atoi(strings.TrimSpace(res.Stdout))
+		if err != nil {
+			return PortForward{}, fmt.Errorf("forward: unexpected port %q", res.Stdout)
+		}
+		local = TCP(port)
+	}
+
+	f := PortForward{Serial: d.device, Local: local, Remote: remote}
+	d.forwards.add(f)
+
+	return f, nil
+}
+
+// Reverse forwards connections to a device endpoint to a host endpoint,
+// e.g. to let an app on the device reach a server on the host.
+// The forwarding is removed by Cleanup, or earlier with RemoveForward.
+// Parameters:
+//   - remote: device endpoint, TCP(0) to let adb pick a free port
+//   - local: host endpoint, e.g. TCP(8080)
+//
+// Returns:
+//   - PortForward: the forwarding, with the port picked by adb if remote was TCP(0)
+//   - error: nil if successful, otherwise error details
+func (d *Driver) Reverse(remote, local string) (PortForward, error) {
+	return d.ReverseContext(context.Background(), remote, local)
+}
+
+// ReverseContext creates a reverse forwarding like Reverse, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//   - remote: device endpoint, TCP(0) to let adb pick a free port
+//   - local: host endpoint, e.g. TCP(8080)
+//
+// Returns:
+//   - PortForward: the forwarding, with the port picked by adb if remote was TCP(0)
+//   - error: nil if successful, otherwise error details
+func (d *Driver) ReverseContext(ctx context.Context, remote, local string) (PortForward, error) {
+	res, err := d.RunResult(ctx, "reverse", remote, local)
+	if err != nil {
+		return PortForward{}, err
+	}
+
+	if remote == TCP(0) {
+		port, err := strconv.Atoi(strings.TrimSpace(res.Stdout))
+		if err != nil {
+			return PortForward{}, fmt.Errorf("reverse: unexpected port %q", res.Stdout)
+		}
+		remote = TCP(port)
+	}
+
+	f := PortForward{Serial: d.device, Local: local, Remote: remote, Reverse: true}
+	d.forwards.add(f)
+
+	return f, nil
+}
+
+// ListForwards lists the forwardings of the connected device, reverse ones included
+// Returns:
+//   - []PortForward: the forwardings
+//   - error: nil if successful, otherwise error details
+func (d *Driver) ListForwards() ([]PortForward, error) {
+	return d.ListForwardsContext(context.Background())
+}
+
+// ListForwardsContext lists the forwardings like ListForwards, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the requests
+//
+// Returns:
+//   - []PortForward: the forwardings
+//   - error: nil if successful, otherwise error details
+func (d *Driver) ListForwardsContext(ctx context.Context) ([]PortForward, error) {
+	var forwards []PortForward
+
+	out, err := d.RunContext(ctx, "forward", "--list")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range parseForwards(out) {
+		// The server lists the forwardings of every device
+		if d.device == "" || f.Serial == d.device {
+			forwards = append(forwards, f)
+		}
+	}
+
+	out, err = d.RunContext(ctx, "reverse", "--list")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range parseForwards(out) {
+		// The device lists its reverse forwardings as "remote local"
+		forwards = append(forwards, PortForward{Serial: d.device, Local: f.Remote, Remote: f.Local, Reverse: true})
+	}
+
+	return forwards, nil
+}
+
+// RemoveForward removes a forwarding created by Forward or Reverse
+// Parameters:
+//   - f: the forwarding
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (d *Driver) RemoveForward(f PortForward) error {
+	return d.RemoveForwardContext(context.Background(), f)
+}
+
+// RemoveForwardContext removes a forwarding like RemoveForward, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//   - f: the forwarding
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (d *Driver) RemoveForwardContext(ctx context.Context, f PortForward) error {
+	d.forwards.remove(f)
+
+	if f.Reverse {
+		_, err := d.RunContext(ctx, "reverse", "--remove", f.Remote)
+		return err
+	}
+
+	_, err := d.RunContext(ctx, "forward", "--remove", f.Local)
+	return err
+}
+
+// removeForwards removes every forwarding created by the driver
+func (d *Driver) removeForwards(ctx context.Context) {
+	for _, f := range d.forwards.take() {
+		d.RemoveForwardContext(ctx, f)
+	}
+}
+
+// parseForwards parses forwarding lists made of "serial local remote" lines
+func parseForwards(out string) []PortForward {
+	var forwards []PortForward
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		forwards = append(forwards, PortForward{Serial: fields[0], Local: fields[1], Remote: fields[2]})
+	}
+
+	return forwards
+}
+
+// forward runs a forward or reverse host command through the ADB server,
+// mirroring the arguments and output of the adb binary
+// Parameters:
+//   - ctx: context controlling the request
+//   - serial: device serial, empty for the only device
+//   - args: "forward"/"reverse" followed by "--list", "--remove <endpoint>" or two endpoints
+//
+// Returns:
+//   - *Result: output of the command
+//   - error: nil unless the server could not be reached
+func (c *adbClient) forward(ctx context.Context, serial string, args []string) (*Result, error) {
+	reverse := args[0] == "reverse"
+
+	var req string
+	switch {
+	case len(args) == 2 && args[1] == "--list":
+		req = "list-forward"
+	case len(args) == 3 && args[1] == "--remove":
+		req = "killforward:" + args[2]
+	case len(args) == 3:
+		req = "forward:" + args[1] + ";" + args[2]
+	default:
+		return &Result{Stderr: "error: invalid " + args[0] + " arguments\n", ExitCode: 1}, nil
+	}
+
+	var conn *adbConn
+	var err error
+	if reverse {
+		conn, err = c.transport(ctx, serial)
+		req = "reverse:" + req
+	} else {
+		conn, err = c.dial(ctx)
+		if serial != "" {
+			req = "host-serial:" + serial + ":" + req
+		} else {
+			req = "host:" + req
+		}
+	}
+	if err != nil {
+		return hostResult("", err)
+	}
+	defer conn.Close()
+
+	if err := conn.send(req); err != nil {
+		return hostResult("", err)
+	}
+
+	if args[1] == "--list" {
+		return hostResult(conn.readString())
+	}
+
+	// Forward requests get a second status once the forwarding is installed,
+	// followed by the port picked by adb for a tcp:0 endpoint
+	if err := conn.readStatus(req); err != nil {
+		return hostResult("", err)
+	}
+
+	if args[1] != TCP(0) {
+		return &Result{}, nil
+	}
+
+	return hostResult(conn.readString())
+}
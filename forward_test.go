@@ -0,0 +1,174 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// onForward answers a forward request with the two OKAY statuses of the ADB
+// server, followed by the port picked for tcp:0 if not empty
+func (s *fakeAdbServer) onForward(req, port string) *fakeAdbServer {
+	return s.on(req, func(t *testing.T, conn net.Conn, _ string) {
+		io.WriteString(conn, "OKAYOKAY")
+		if port != "" {
+			io.WriteString(conn, "0005"+port)
+		}
+	})
+}
+
+func TestForward(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(d *Driver) (PortForward, error)
+		req    string
+		port   string
+		want   PortForward
+	}{
+		{
+			name:   "free port",
+			create: func(d *Driver) (PortForward, error) { return d.Forward(TCP(0), TCP(9008)) },
+			req:    "host-serial:emulator-5554:forward:tcp:0;tcp:9008",
+			port:   "40123",
+			want:   PortForward{Serial: "emulator-5554", Local: "tcp:40123", Remote: "tcp:9008"},
+		},
+		{
+			name:   "fixed port",
+			create: func(d *Driver) (PortForward, error) { return d.Forward(TCP(8000), "localabstract:u2") },
+			req:    "host-serial:emulator-5554:forward:tcp:8000;localabstract:u2",
+			want:   PortForward{Serial: "emulator-5554", Local: "tcp:8000", Remote: "localabstract:u2"},
+		},
+		{
+			name:   "reverse free port",
+			create: func(d *Driver) (PortForward, error) { return d.Reverse(TCP(0), TCP(8080)) },
+			req:    "reverse:forward:tcp:0;tcp:8080",
+			port:   "38123",
+			want:   PortForward{Serial: "emulator-5554", Local: "tcp:8080", Remote: "tcp:38123", Reverse: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAdbServer(t).onForward(tt.req, tt.port)
+			d := newAdbDriver(t, server)
+
+			f, err := tt.create(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f != tt.want {
+				t.Errorf("forwarding = %+v, want %+v", f, tt.want)
+			}
+			if !slices.Contains(server.received(), tt.req) {
+				t.Errorf("requests = %q, want %q", server.received(), tt.req)
+			}
+		})
+	}
+}
+
+func TestForwardFailed(t *testing.T) {
+	server := newFakeAdbServer(t).on("host-serial:emulator-5554:forward:tcp:0;tcp:9008", func(t *testing.T, conn net.Conn, _ string) {
+		io.WriteString(conn, "OKAYFAIL000bcannot bind")
+	})
+	d := newAdbDriver(t, server)
+
+	var exitErr *ExitError
+	if _, err := d.Forward(TCP(0), TCP(9008)); !errors.As(err, &exitErr) {
+		t.Fatalf("Forward() error = %v, want *ExitError", err)
+	}
+	if f := d.forwards.take(); len(f) != 0 {
+		t.Errorf("failed forwarding remembered: %+v", f)
+	}
+}
+
+func TestRemoveForward(t *testing.T) {
+	server := newFakeAdbServer(t).
+		onForward("host-serial:emulator-5554:forward:tcp:0;tcp:9008", "40123").
+		onForward("host-serial:emulator-5554:forward:tcp:0;tcp:9009", "40124").
+		onForward("reverse:forward:tcp:0;tcp:8080", "38123").
+		onForward("host-serial:emulator-5554:killforward:tcp:40123", "").
+		onForward("host-serial:emulator-5554:killforward:tcp:40124", "").
+		onForward("reverse:killforward:tcp:38123", "")
+	d := newAdbDriver(t, server)
+
+	first, _ := d.Forward(TCP(0), TCP(9008))
+	d.Forward(TCP(0), TCP(9009))
+	d.Reverse(TCP(0), TCP(8080))
+
+	if err := d.RemoveForward(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleanup removes the remaining ones
+	d.removeForwards(context.Background())
+
+	var removed []string
+	for _, req := range server.received() {
+		if req == "host-serial:emulator-5554:killforward:tcp:40123" ||
+			req == "host-serial:emulator-5554:killforward:tcp:40124" ||
+			req == "reverse:killforward:tcp:38123" {
+			removed = append(removed, req)
+		}
+	}
+	want := []string{
+		"host-serial:emulator-5554:killforward:tcp:40123",
+		"host-serial:emulator-5554:killforward:tcp:40124",
+		"reverse:killforward:tcp:38123",
+	}
+	if !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed %q, want %q", removed, want)
+	}
+	if f := d.forwards.take(); len(f) != 0 {
+		t.Errorf("forwardings left after cleanup: %+v", f)
+	}
+}
+
+func TestListForwards(t *testing.T) {
+	server := newFakeAdbServer(t).
+		onString("host-serial:emulator-5554:list-forward", "emulator-5554 tcp:40123 tcp:9008\nemulator-5556 tcp:40200 tcp:9008\n").
+		onString("reverse:list-forward", "UsbFfs tcp:38123 tcp:8080\n")
+	d := newAdbDriver(t, server)
+
+	got, err := d.ListForwards()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PortForward{
+		{Serial: "emulator-5554", Local: "tcp:40123", Remote: "tcp:9008"},
+		{Serial: "emulator-5554", Local: "tcp:8080", Remote: "tcp:38123", Reverse: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListForwards() = %+v, want %+v", got, want)
+	}
+}
+
+func TestU2URLForward(t *testing.T) {
+	server := newFakeAdbServer(t).onForward("host-serial:emulator-5554:forward:tcp:0;tcp:9008", "40123")
+	d := newAdbDriver(t, server)
+
+	for range 2 {
+		url, err := d.u2URL(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != "http://127.0.0.1:40123/jsonrpc/0" {
+			t.Errorf("u2URL() = %q", url)
+		}
+	}
+
+	// The forwarding is created once
+	n := 0
+	for _, req := range server.received() {
+		if req == "host-serial:emulator-5554:forward:tcp:0;tcp:9008" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("forwarded %d times, want once", n)
+	}
+}
@@ -2,6 +2,7 @@ package driver
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"image"
 	"image/draw"
@@ -75,11 +76,11 @@ func (d *Driver) SaveImage(img image.Image, path string) error {
 		filepathParts := strings.Split(path, "/")
 		filepath := strings.Join(filepathParts[:len(filepathParts)-1], "/")
 		filename := filepathParts[len(filepathParts)-1]
-		if !FileExists(TEMP_PATH + filepath) {
-			CreateDir(TEMP_PATH + filepath)
+		if !FileExists(d.config.TempPath + filepath) {
+			CreateDir(d.config.TempPath + filepath)
 		}
 
-		path = TEMP_PATH + filepath + "/" + filename
+		path = d.config.TempPath + filepath + "/" + filename
 	}
 
 	file, err := os.Create(path)
@@ -103,6 +104,17 @@ func (d *Driver) SaveImage(img image.Image, path string) error {
 // Returns:
 //   - The loaded image and any error encountered
 func (d *Driver) LoadImage(path string) (image.Image, error) {
+	return d.LoadImageContext(context.Background(), path)
+}
+
+// LoadImageContext loads an image like LoadImage, stopping the pull when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the pull from device
+//   - path: Path to the image file
+//
+// Returns:
+//   - The loaded image and any error encountered
+func (d *Driver) LoadImageContext(ctx context.Context, path string) (image.Image, error) {
 	if d.os != "android" {
 		if path[0] != '/' {
 			path = "/" + path
@@ -111,12 +123,14 @@ func (d *Driver) LoadImage(path string) (image.Image, error) {
 		filepathParts := strings.Split(path, "/")
 		filepath := strings.Join(filepathParts[:len(filepathParts)-1], "/")
 		filename := filepathParts[len(filepathParts)-1]
-		if !FileExists(TEMP_PATH + filepath) {
-			CreateDir(TEMP_PATH + filepath)
+		if !FileExists(d.config.TempPath + filepath) {
+			CreateDir(d.config.TempPath + filepath)
 		}
 
-		d.Run("pull", path, TEMP_PATH+filepath)
-		path = TEMP_PATH + filepath + "/" + filename
+		if err := d.Pull(ctx, path, d.config.TempPath+filepath, nil); err != nil {
+			return nil, err
+		}
+		path = d.config.TempPath + filepath + "/" + filename
 	}
 
 	return LoadImage(path)
@@ -128,16 +142,28 @@ func (d *Driver) LoadImage(path string) (image.Image, error) {
 // Returns:
 //   - The captured screenshot as an image
 func (d *Driver) Screenshot() image.Image {
-	if d.FileExists(IMAGE_PATH) {
-		d.DeleteFile(IMAGE_PATH)
-		DeleteAll(IMAGE_PATH)
-	}
+	img, _ := d.ScreenshotContext(context.Background())
+	return img
+}
+
+// ScreenshotContext captures the current screen like Screenshot, stopping when ctx is done.
+//
+// Returns:
+//   - The captured screenshot as an image
+//   - Any error encountered, ctx.Err() if ctx is done
+func (d *Driver) ScreenshotContext(ctx context.Context) (image.Image, error) {
+	imagePath := d.config.RootPath + "/screen.png"
 
-	d.Run("screencap", "-p", IMAGE_PATH)
+	if d.FileExistsContext(ctx, imagePath) {
+		d.DeleteFileContext(ctx, imagePath)
+		DeleteAll(imagePath)
+	}
 
-	img, _ := d.LoadImage(IMAGE_PATH)
+	if _, err := d.RunContext(ctx, "screencap", "-p", imagePath); err != nil {
+		return nil, err
+	}
 
-	return img
+	return d.LoadImageContext(ctx, imagePath)
 }
 
 // ScreenshotBase64 captures the current screen and returns it as a base64 encoded string.
@@ -147,7 +173,20 @@ func (d *Driver) Screenshot() image.Image {
 //   - string: The base64 encoded screenshot image
 //   - error: Any error that occurred during the process
 func (d *Driver) ScreenshotBase64() (string, error) {
-	img := d.Screenshot()
+	return d.ScreenshotBase64Context(context.Background())
+}
+
+// ScreenshotBase64Context captures the current screen as base64 like ScreenshotBase64,
+// stopping when ctx is done.
+//
+// Returns:
+//   - string: The base64 encoded screenshot image
+//   - error: Any error that occurred during the process
+func (d *Driver) ScreenshotBase64Context(ctx context.Context) (string, error) {
+	img, err := d.ScreenshotContext(ctx)
+	if err != nil {
+		return "", err
+	}
 	return Image2Base64(img)
 }
 
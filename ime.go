@@ -1,18 +1,21 @@
 package driver
 
+import "context"
+
 // getCurrentKeyboard retrieves the current keyboard input method
-func (d *Driver) getCurrentKeyboard() string {
-	ime, _ := d.Run("settings", "get", "secure", "default_input_method")
+func (d *Driver) getCurrentKeyboard(ctx context.Context) string {
+	ime, _ := d.RunContext(ctx, "settings", "get", "secure", "default_input_method")
 	return ime
 }
 
 // SwitchKeyBoard switches the keyboard input method to the specified IME
 // Parameters:
+//   - ctx: The context controlling the command lifetime
 //   - ime: The input method to switch to
 // Returns:
 //   - bool: true if the switch was successful, false otherwise
-func (d *Driver) switchKeyboard(ime string) bool {
-	_, err := d.Run("ime", "set", ime)
+func (d *Driver) switchKeyboard(ctx context.Context, ime string) bool {
+	_, err := d.RunContext(ctx, "ime", "set", ime)
 	return err == nil
 }
 
@@ -20,12 +23,26 @@ func (d *Driver) switchKeyboard(ime string) bool {
 // Returns:
 //   - bool: true if the switch was successful, false otherwise
 func (d *Driver) SwitchAdbKeyboard() bool {
-	return d.switchKeyboard(ADB_KEYBOARD)
+	return d.SwitchAdbKeyboardContext(context.Background())
+}
+
+// SwitchAdbKeyboardContext switches to the ADB keyboard like SwitchAdbKeyboard, stopping when ctx is done
+// Returns:
+//   - bool: true if the switch was successful, false otherwise
+func (d *Driver) SwitchAdbKeyboardContext(ctx context.Context) bool {
+	return d.switchKeyboard(ctx, d.config.Keyboard)
 }
 
 // SwitchDefaultKeyboard switches the keyboard input method to the default keyboard
 // Returns:
 //   - bool: true if the switch was successful, false otherwise
 func (d *Driver) SwitchDefaultKeyboard() bool {
-	return d.switchKeyboard(d.defaultKeyboard)
+	return d.SwitchDefaultKeyboardContext(context.Background())
+}
+
+// SwitchDefaultKeyboardContext switches to the default keyboard like SwitchDefaultKeyboard, stopping when ctx is done
+// Returns:
+//   - bool: true if the switch was successful, false otherwise
+func (d *Driver) SwitchDefaultKeyboardContext(ctx context.Context) bool {
+	return d.switchKeyboard(ctx, d.defaultKeyboard)
 }
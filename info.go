@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"encoding/json"
 	"regexp"
 	"strconv"
@@ -12,31 +13,38 @@ import (
 // Returns:
 //   - string: JSON formatted device information
 func (d *Driver) Info() string {
+	return d.InfoContext(context.Background())
+}
+
+// InfoContext retrieves device information like Info, stopping when ctx is done.
+// Returns:
+//   - string: JSON formatted device information
+func (d *Driver) InfoContext(ctx context.Context) string {
 	if d.deviceInfo != "" {
 		return d.deviceInfo
 	}
 
 	deviceInfo := make(map[string]string, 0)
 
-	deviceInfo["model"], _ = d.Run("getprop", "ro.product.model")
-	deviceInfo["brand"], _ = d.Run("getprop", "ro.product.brand")
-	deviceInfo["market_name"], _ = d.Run("getprop", "ro.product.marketname")
-	deviceInfo["android_version"], _ = d.Run("getprop", "ro.build.version.release")
-	deviceInfo["sdk_version"], _ = d.Run("getprop", "ro.build.version.sdk")
-	deviceInfo["device_id"], _ = d.Run("getprop", "ro.serialno")
-	deviceInfo["cpu_platform"], _ = d.Run("getprop", "ro.board.platform")
-	deviceInfo["system_device_name"], _ = d.Run("getprop", "persist.sys.device_name")
-	deviceInfo["operator_name"], _ = d.Run("getprop", "gsm.sim.operator.alpha")
-	deviceInfo["phone_number"], _ = d.Run("getprop", "gsm.sim.operator.numeric")
-	deviceInfo["meid"], _ = d.Run("getprop", "ro.ril.oem.meid")
-	deviceInfo["system_version"], _ = d.Run("getprop", "ro.build.version.incremental")
-	deviceInfo["system_arch"], _ = d.Run("getprop", "ro.product.cpu.abi")
-	screen_size, _ := d.Run("wm", "size")
-	deviceInfo["screen_size"] = strings.Split(screen_size, ":")[1]
-	screen_density, _ := d.Run("wm", "density")
-	deviceInfo["screen_density"] = strings.Split(screen_density, ":")[1]
-	deviceInfo["imei"] = d.GetIMEI()
-	deviceInfo["ip"] = d.GetIP()
+	deviceInfo["model"], _ = d.RunContext(ctx, "getprop", "ro.product.model")
+	deviceInfo["brand"], _ = d.RunContext(ctx, "getprop", "ro.product.brand")
+	deviceInfo["market_name"], _ = d.RunContext(ctx, "getprop", "ro.product.marketname")
+	deviceInfo["android_version"], _ = d.RunContext(ctx, "getprop", "ro.build.version.release")
+	deviceInfo["sdk_version"], _ = d.RunContext(ctx, "getprop", "ro.build.version.sdk")
+	deviceInfo["device_id"], _ = d.RunContext(ctx, "getprop", "ro.serialno")
+	deviceInfo["cpu_platform"], _ = d.RunContext(ctx, "getprop", "ro.board.platform")
+	deviceInfo["system_device_name"], _ = d.RunContext(ctx, "getprop", "persist.sys.device_name")
+	deviceInfo["operator_name"], _ = d.RunContext(ctx, "getprop", "gsm.sim.operator.alpha")
+	deviceInfo["phone_number"], _ = d.RunContext(ctx, "getprop", "gsm.sim.operator.numeric")
+	deviceInfo["meid"], _ = d.RunContext(ctx, "getprop", "ro.ril.oem.meid")
+	deviceInfo["system_version"], _ = d.RunContext(ctx, "getprop", "ro.build.version.incremental")
+	deviceInfo["system_arch"], _ = d.RunContext(ctx, "getprop", "ro.product.cpu.abi")
+	screen_size, _ := d.RunContext(ctx, "wm", "size")
+	deviceInfo["screen_size"] = afterColon(screen_size)
+	screen_density, _ := d.RunContext(ctx, "wm", "density")
+	deviceInfo["screen_density"] = afterColon(screen_density)
+	deviceInfo["imei"] = d.GetIMEIContext(ctx)
+	deviceInfo["ip"] = d.GetIPContext(ctx)
 
 	for k, v := range deviceInfo {
 		deviceInfo[k] = strings.TrimSpace(v)
@@ -44,6 +52,10 @@ func (d *Driver) Info() string {
 
 	jsonBytes, _ := json.MarshalIndent(deviceInfo, "", " ")
 
+	if ctx.Err() != nil {
+		return string(jsonBytes)
+	}
+
 	d.deviceInfo = string(jsonBytes)
 
 	return d.deviceInfo
@@ -53,7 +65,14 @@ func (d *Driver) Info() string {
 // Returns:
 //   - string: Raw memory information output from dumpsys meminfo
 func (d *Driver) MemoryInfo() string {
-	output, _ := d.Run("dumpsys", "meminfo")
+	return d.MemoryInfoContext(context.Background())
+}
+
+// MemoryInfoContext retrieves memory information like MemoryInfo, stopping when ctx is done.
+// Returns:
+//   - string: Raw memory information output from dumpsys meminfo
+func (d *Driver) MemoryInfoContext(ctx context.Context) string {
+	output, _ := d.RunContext(ctx, "dumpsys", "meminfo")
 	return output
 }
 
@@ -61,7 +80,14 @@ func (d *Driver) MemoryInfo() string {
 // Returns:
 //   - string: Storage usage percentage of /sdcard partition
 func (d *Driver) StorageInfo() string {
-	output, _ := d.Run("df", "/sdcard", "|", "grep", "'/dev'", "|", "awk", "'{print $5}'")
+	return d.StorageInfoContext(context.Background())
+}
+
+// StorageInfoContext retrieves storage usage like StorageInfo, stopping when ctx is done.
+// Returns:
+//   - string: Storage usage percentage of /sdcard partition
+func (d *Driver) StorageInfoContext(ctx context.Context) string {
+	output, _ := d.PipeContext(ctx, Cmd("df", "/sdcard"), Cmd("grep", "/dev"), Cmd("awk", "{print $5}"))
 	return output
 }
 
@@ -69,7 +95,14 @@ func (d *Driver) StorageInfo() string {
 // Returns:
 //   - string: IP address if found, "localhost" if not found, "unknown" on error
 func (d *Driver) GetIP() string {
-	output, err := d.Run("ip", "-4", "addr", "show", "wlan0")
+	return d.GetIPContext(context.Background())
+}
+
+// GetIPContext retrieves the WLAN IP address like GetIP, stopping when ctx is done.
+// Returns:
+//   - string: IP address if found, "localhost" if not found, "unknown" on error
+func (d *Driver) GetIPContext(ctx context.Context) string {
+	output, err := d.RunContext(ctx, "ip", "-4", "addr", "show", "wlan0")
 	if err != nil {
 		return "unknown"
 	}
@@ -90,14 +123,21 @@ func (d *Driver) GetIP() string {
 // Returns:
 //   - string: Device IMEI if found, empty string if not found
 func (d *Driver) GetIMEI() string {
-	version, _ := d.Run("getprop", "ro.build.version.release")
+	return d.GetIMEIContext(context.Background())
+}
+
+// GetIMEIContext retrieves the IMEI like GetIMEI, stopping when ctx is done.
+// Returns:
+//   - string: Device IMEI if found, empty string if not found
+func (d *Driver) GetIMEIContext(ctx context.Context) string {
+	version, _ := d.RunContext(ctx, "getprop", "ro.build.version.release")
 	v, _ := strconv.Atoi(strings.TrimSpace(version))
 
 	var imei string
 	if v >= 12 {
-		imei, _ = d.Run("getprop", "ro.ril.oem.imei")
+		imei, _ = d.RunContext(ctx, "getprop", "ro.ril.oem.imei")
 	} else {
-		timei, _ := d.Run("service call iphonesubinfo 4 i32 2")
+		timei, _ := d.RunContext(ctx, "service", "call", "iphonesubinfo", "4", "i32", "2")
 		imei = func(i string) string {
 			re := regexp.MustCompile(`'([^']*)'`)
 			matches := re.FindAllStringSubmatch(i, -1)
@@ -126,12 +166,32 @@ func (d *Driver) GetIMEI() string {
 //   - int: Screen width in pixels
 //   - int: Screen height in pixels
 func (d *Driver) GetResolution() (int, int) {
-	screen_size, _ := d.Run("wm", "size")
-	screen_size = strings.TrimSpace(strings.Split(screen_size, ":")[1])
+	return d.GetResolutionContext(context.Background())
+}
+
+// GetResolutionContext retrieves the screen resolution like GetResolution, stopping when ctx is done.
+// Returns:
+//   - int: Screen width in pixels
+//   - int: Screen height in pixels
+func (d *Driver) GetResolutionContext(ctx context.Context) (int, int) {
+	screen_size, _ := d.RunContext(ctx, "wm", "size")
+	screen_size = strings.TrimSpace(afterColon(screen_size))
 	temp := strings.Split(screen_size, "x")
+	if len(temp) != 2 {
+		return 0, 0
+	}
 
 	w, _ := strconv.Atoi(temp[0])
 	h, _ := strconv.Atoi(temp[1])
 
 	return w, h
 }
+
+// afterColon returns the text following the first colon of s, or an empty string
+// if s has none, e.g. when the command producing it was cancelled
+func afterColon(s string) string {
+	if _, after, found := strings.Cut(s, ":"); found {
+		return after
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGetResolution(t *testing.T) {
+	tests := []struct {
+		name          string
+		fake          *fakeExecutor
+		width, height int
+	}{
+		{
+			name:  "physical size",
+			fake:  newFakeExecutor().On(`^wm size$`, "Physical size: 1080x2400\n"),
+			width: 1080, height: 2400,
+		},
+		{
+			name: "no colon",
+			fake: newFakeExecutor().On(`^wm size$`, "1080x2400\n"),
+		},
+		{
+			name: "command failed",
+			fake: newFakeExecutor().OnResult(`^wm size$`, Result{Stderr: "wm: not found", ExitCode: 127}),
+		},
+		{
+			name: "transport error",
+			fake: newFakeExecutor().OnError(`^wm size$`, errors.New("device offline")),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := newFakeDriver(t, tt.fake).GetResolutionContext(withoutRecovery(context.Background()))
+			if w != tt.width || h != tt.height {
+				t.Errorf("GetResolution() = %d, %d, want %d, %d (calls %q)", w, h, tt.width, tt.height, tt.fake.Calls())
+			}
+		})
+	}
+}
+
+func TestGetIMEI(t *testing.T) {
+	tests := []struct {
+		name string
+		fake *fakeExecutor
+		want string
+	}{
+		{
+			name: "android 12 property",
+			fake: newFakeExecutor().
+				On(`^getprop ro.build.version.release$`, "13\n").
+				On(`^getprop ro.ril.oem.imei$`, "356938035643809\n"),
+			want: "356938035643809",
+		},
+		{
+			name: "android 11 service call",
+			fake: newFakeExecutor().
+				On(`^getprop ro.build.version.release$`, "11\n").
+				On(`^service call iphonesubinfo 4 i32 2$`, "Result: Parcel(\n"+
+					"  0x00000000: 00000000 0000000f 00350033 00390036 '........3.5.6.9.'\n"+
+					"  0x00000010: 00380033 00330030 00360035 00330034 '3.8.0.3.5.6.4.3.'\n"+
+					"  0x00000020: 00300038 00000039                   '8.0.9...        ')\n"),
+			want: "356938035643809",
+		},
+		{
+			name: "android 11 no quoted output",
+			fake: newFakeExecutor().
+				On(`^getprop ro.build.version.release$`, "11\n").
+				On(`^service call iphonesubinfo 4 i32 2$`, "Result: Parcel(00000000 ffffffff)\n"),
+			want: "",
+		},
+		{
+			name: "unknown version",
+			fake: newFakeExecutor().
+				On(`^getprop ro.build.version.release$`, "\n").
+				On(`^service call iphonesubinfo`, ""),
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newFakeDriver(t, tt.fake).GetIMEI(); got != tt.want {
+				t.Errorf("GetIMEI() = %q, want %q (calls %q)", got, tt.want, tt.fake.Calls())
+			}
+		})
+	}
+}
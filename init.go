@@ -1,42 +1,67 @@
 package driver
 
-import "strings"
+import (
+	"context"
+	"io"
+)
 
 // initialize performs initial setup for the driver:
-//  - Downloading and installing UiAutomator service if needed
-//  - Installing and enabling ADB keyboard if needed
+//  - Provisioning UiAutomator service and ADB keyboard if Config.AutoInstall is set
 //  - Starting UiAutomator service
-//  - Storing current keyboard as default
-//  - Switching to ADB keyboard
+//  - Storing current keyboard as default if Config.SwitchIME is set
+//  - Switching to ADB keyboard if Config.SwitchIME is set
 //  - Creating temp directory if needed
-func (d *Driver) initialize() {
-	if !d.FileExists(U2_PATH) {
-		d.DownloadFile(U2_URL, U2_PATH)
+//
+// It stops at the first failure, returning it.
+func (d *Driver) initialize(ctx context.Context) error {
+	if d.config.AutoInstall {
+		if err := d.ProvisionContext(ctx); err != nil {
+			return err
+		}
 	}
 
-	imeList, _ := d.Run("ime", "list", "-s")
-	if !strings.Contains(imeList, ADB_KEYBOARD) {
-		d.DownloadFile(ADB_KEYBOARD_URL, ROOT_PATH+"/star-ime.apk")
-		d.InstallApp(ROOT_PATH+"/star-ime.apk", true)
-		d.Run("ime", "enable", ADB_KEYBOARD)
+	if err := d.restartUiAutomator(ctx); err != nil {
+		return err
 	}
 
-	d.startUiAutomator()
+	if d.config.SwitchIME {
+		d.defaultKeyboard = d.getCurrentKeyboard(ctx)
 
-	d.defaultKeyboard = d.getCurrentKeyboard()
-
-	d.SwitchAdbKeyboard()
+		d.SwitchAdbKeyboardContext(ctx)
+	}
 
-	if d.os != "android" && !DirExists(TEMP_PATH) {
-		CreateDir(TEMP_PATH)
+	if d.os != "android" && !DirExists(d.config.TempPath) {
+		CreateDir(d.config.TempPath)
 	}
+
+	return ctx.Err()
 }
 
 // Cleanup performs cleanup after the driver:
+//  - Stopping the background watchers
 //  - Stopping UiAutomator service
-//  - Restoring default keyboard
+//  - Restoring default keyboard if Config.SwitchIME is set
+//  - Removing the port forwardings created by the driver
+//  - Stopping the device state watch
 func (d *Driver) Cleanup() {
-	d.stopUiAutomator()
+	d.CleanupContext(context.Background())
+}
+
+// CleanupContext performs cleanup like Cleanup, stopping when ctx is done
+func (d *Driver) CleanupContext(ctx context.Context) {
+	d.StopWatchers()
+
+	d.stopUiAutomator(ctx)
 
-	d.SwitchDefaultKeyboard()
+	if d.config.SwitchIME {
+		d.SwitchDefaultKeyboardContext(ctx)
+	}
+
+	d.removeForwards(ctx)
+
+	d.unwatchDevice()
+
+	if closer, ok := d.executor.(io.Closer); ok {
+		closer.Close()
+	}
 }
@@ -1,15 +1,37 @@
 package driver
 
+import "context"
+
 // Input types the specified text at the given coordinates
 // Parameters:
 //   - x: The x-coordinate to tap
 //   - y: The y-coordinate to tap
 //   - text: The text to input
 func (d *Driver) Input(x, y int, text string) {
-	d.Tap(x, y)
-	d.Clear(x, y)
-	d.Run("am", "broadcast", "-a", "STAR_INPUT_TEXT", "--es", "text", text)
-	d.Back()
+	d.InputContext(context.Background(), x, y, text)
+}
+
+// InputContext types the specified text like Input, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - x: The x-coordinate to tap
+//   - y: The y-coordinate to tap
+//   - text: The text to input
+//
+// Returns:
+//   - error: The first error encountered while typing
+func (d *Driver) InputContext(ctx context.Context, x, y int, text string) error {
+	if err := d.TapContext(ctx, x, y); err != nil {
+		return err
+	}
+	if err := d.ClearContext(ctx, x, y); err != nil {
+		return err
+	}
+	if _, err := d.RunContext(ctx, "am", "broadcast", "-a", "STAR_INPUT_TEXT", "--es", "text", text); err != nil {
+		return err
+	}
+	d.BackContext(ctx)
+	return ctx.Err()
 }
 
 // Clear clears the text at the given coordinates
@@ -17,5 +39,18 @@ func (d *Driver) Input(x, y int, text string) {
 //   - x: The x-coordinate to clear
 //   - y: The y-coordinate to clear
 func (d *Driver) Clear(x, y int) {
-	d.Run("am", "broadcast", "-a", "STAR_CLEAR_TEXT")
+	d.ClearContext(context.Background(), x, y)
+}
+
+// ClearContext clears the text like Clear, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - x: The x-coordinate to clear
+//   - y: The y-coordinate to clear
+//
+// Returns:
+//   - error: An error object if the command could not be sent
+func (d *Driver) ClearContext(ctx context.Context, x, y int) error {
+	_, err := d.RunContext(ctx, "am", "broadcast", "-a", "STAR_CLEAR_TEXT")
+	return err
 }
@@ -1,6 +1,9 @@
 package driver
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // KeyEvent sends a key event with the specified keycode
 // Parameters:
@@ -8,10 +11,18 @@ import "fmt"
 // Returns:
 //   - bool: true if successful, false otherwise
 func (d *Driver) KeyEvent(keyCode KeyCode) bool {
-	if output, err := d.Run("input", "keyevent", fmt.Sprintf("%d", keyCode)); err != nil || output != "" {
-		return false
-	}
-	return true
+	return d.KeyEventContext(context.Background(), keyCode)
+}
+
+// KeyEventContext sends a key event like KeyEvent, stopping when ctx is done
+// Parameters:
+//   - ctx: Context controlling the command lifetime
+//   - keyCode: The Android key code to send
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) KeyEventContext(ctx context.Context, keyCode KeyCode) bool {
+	_, err := d.RunResult(ctx, "input", "keyevent", fmt.Sprintf("%d", keyCode))
+	return err == nil
 }
 
 // Home simulates pressing the home button
@@ -21,6 +32,13 @@ func (d *Driver) Home() bool {
 	return d.KeyEvent(KEYCODE_HOME)
 }
 
+// HomeContext simulates pressing the home button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) HomeContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_HOME)
+}
+
 // Back simulates pressing the back button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -28,6 +46,13 @@ func (d *Driver) Back() bool {
 	return d.KeyEvent(KEYCODE_BACK)
 }
 
+// BackContext simulates pressing the back button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) BackContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_BACK)
+}
+
 // Enter simulates pressing the enter key
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -35,6 +60,13 @@ func (d *Driver) Enter() bool {
 	return d.KeyEvent(KEYCODE_ENTER)
 }
 
+// EnterContext simulates pressing the enter key, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) EnterContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_ENTER)
+}
+
 // Search simulates pressing the search button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -42,6 +74,13 @@ func (d *Driver) Search() bool {
 	return d.KeyEvent(KEYCODE_SEARCH)
 }
 
+// SearchContext simulates pressing the search button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) SearchContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_SEARCH)
+}
+
 // Menu simulates pressing the menu button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -49,6 +88,13 @@ func (d *Driver) Menu() bool {
 	return d.KeyEvent(KEYCODE_MENU)
 }
 
+// MenuContext simulates pressing the menu button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) MenuContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_MENU)
+}
+
 // VolumeUp simulates pressing the volume up button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -56,6 +102,13 @@ func (d *Driver) VolumeUp() bool {
 	return d.KeyEvent(KEYCODE_VOLUME_UP)
 }
 
+// VolumeUpContext simulates pressing the volume up button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) VolumeUpContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_VOLUME_UP)
+}
+
 // VolumeDown simulates pressing the volume down button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -63,6 +116,13 @@ func (d *Driver) VolumeDown() bool {
 	return d.KeyEvent(KEYCODE_VOLUME_DOWN)
 }
 
+// VolumeDownContext simulates pressing the volume down button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) VolumeDownContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_VOLUME_DOWN)
+}
+
 // Power simulates pressing the power button
 // Returns:
 //   - bool: true if successful, false otherwise
@@ -70,14 +130,31 @@ func (d *Driver) Power() bool {
 	return d.KeyEvent(KEYCODE_POWER)
 }
 
+// PowerContext simulates pressing the power button, stopping when ctx is done
+// Returns:
+//   - bool: true if successful, false otherwise
+func (d *Driver) PowerContext(ctx context.Context) bool {
+	return d.KeyEventContext(ctx, KEYCODE_POWER)
+}
+
 // Reboot simulates a device reboot command
 // This will restart the entire device
 func (d *Driver) Reboot() {
-	d.Run("reboot")
+	d.RebootContext(context.Background())
+}
+
+// RebootContext reboots the device like Reboot, stopping when ctx is done
+func (d *Driver) RebootContext(ctx context.Context) {
+	d.RunContext(ctx, "reboot")
 }
 
 // PowerOff simulates powering off the device
 // This will shut down the entire device
 func (d *Driver) PowerOff() {
-	d.Run("poweroff")
+	d.PowerOffContext(context.Background())
+}
+
+// PowerOffContext powers off the device like PowerOff, stopping when ctx is done
+func (d *Driver) PowerOffContext(ctx context.Context) {
+	d.RunContext(ctx, "poweroff")
 }
@@ -0,0 +1,281 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// LookupBackend tells how WaitElement finds elements
+type LookupBackend string
+
+const (
+	// LookupDump dumps the whole hierarchy and searches it on the host
+	LookupDump LookupBackend = "dump"
+	// LookupSelector sends a UiSelector query to the UiAutomator server,
+	// a single call returning the matching node only. It applies to By
+	// locators, a Query being searched in dumps like with LookupDump.
+	LookupSelector LookupBackend = "selector"
+)
+
+// WithLookup sets how WaitElement finds By locators, Query locators
+// always being searched in hierarchy dumps
+// Parameters:
+//   - backend: LookupDump (default) or LookupSelector
+//
+// Returns:
+//   - Option: option to pass to New
+func WithLookup(backend LookupBackend) Option {
+	return withSetting(func(c *Config) {
+		c.Lookup = backend
+	})
+}
+
+// FindU2Element finds the first element matching a UiSelector query on the
+// UiAutomator server, without dumping the hierarchy. The element only knows
+// its own attributes at first: the hierarchy is dumped once, on the first
+// use of its relatives (Parent, Children, Below, FindElement...), to find its node.
+// If the screen changed meanwhile and the node is gone, the element stays
+// alone, without relatives.
+// The dump is bound to the context of the lookup: with FindU2ElementContext
+// or WaitU2ElementContext, the element stays alone if ctx is done by then.
+// Parameters:
+//   - sel: the query, e.g. U2Selector{TextContains: "Save"}
+//
+// Returns:
+//   - Element: the matching element
+//   - error: ErrElementNotFound if nothing matches, otherwise the server error
+func (d *Driver) FindU2Element(sel U2Selector) (Element, error) {
+	return d.FindU2ElementContext(context.Background(), sel)
+}
+
+// FindU2ElementContext finds an element like FindU2Element, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the query
+//   - sel: the query
+//
+// Returns:
+//   - Element: the matching element
+//   - error: same errors as FindU2Element, or ctx.Err() if ctx is done
+func (d *Driver) FindU2ElementContext(ctx context.Context, sel U2Selector) (Element, error) {
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return nil, err
+	}
+
+	info, err := d.u2.ObjInfo(ctx, sel)
+	if err != nil {
+		var rpcErr *RPCError
+		if errors.As(err, &rpcErr) && strings.Contains(rpcErr.Message, "UiObjectNotFound") {
+			return nil, ErrElementNotFound
+		}
+		return nil, err
+	}
+
+	return d.u2Element(ctx, info), nil
+}
+
+// WaitU2Element waits for an element matching a UiSelector query, the server
+// watching the screen so that no hierarchy is dumped
+// Parameters:
+//   - sel: the query
+//   - timeout: maximum time to wait, Config.WaitTimeout if zero
+//
+// Returns:
+//   - Element: the matching element
+//   - error: ErrElementNotFound if nothing matched in time, otherwise the server error
+func (d *Driver) WaitU2Element(sel U2Selector, timeout time.Duration) (Element, error) {
+	return d.WaitU2ElementContext(context.Background(), sel, timeout)
+}
+
+// WaitU2ElementContext waits for an element like WaitU2Element, stopping when ctx is done
+// Parameters:
+//   - ctx: context bounding the whole wait, in addition to timeout
+//   - sel: the query
+//   - timeout: maximum time to wait, Config.WaitTimeout if zero
+//
+// Returns:
+//   - Element: the matching element
+//   - error: same errors as WaitU2Element, or ctx.Err() if ctx is done
+func (d *Driver) WaitU2ElementContext(ctx context.Context, sel U2Selector, timeout time.Duration) (Element, error) {
+	if timeout <= 0 {
+		timeout = d.config.WaitTimeout
+	}
+
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return nil, err
+	}
+
+	exists, err := d.u2.WaitForExists(ctx, sel, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrElementNotFound
+	}
+
+	// The object may vanish between both calls
+	return d.FindU2ElementContext(ctx, sel)
+}
+
+// u2Element turns the description of an object into an element, holding a
+// synthetic node with the attributes of a hierarchy dump, ctx bounding the
+// dump of its relatives
+func (d *Driver) u2Element(ctx context.Context, info U2ObjInfo) *element {
+	node := etree.NewElement("node")
+	node.CreateAttr("text", info.Text)
+	node.CreateAttr("resource-id", info.ResourceName)
+	node.CreateAttr("class", info.ClassName)
+	node.CreateAttr("package", info.PackageName)
+	node.CreateAttr("content-desc", info.ContentDescription)
+	node.CreateAttr("checkable", strconv.FormatBool(info.Checkable))
+	node.CreateAttr("checked", strconv.FormatBool(info.Checked))
+	node.CreateAttr("clickable", strconv.FormatBool(info.Clickable))
+	node.CreateAttr("enabled", strconv.FormatBool(info.Enabled))
+	node.CreateAttr("focusable", strconv.FormatBool(info.Focusable))
+	node.CreateAttr("focused", strconv.FormatBool(info.Focused))
+	node.CreateAttr("scrollable", strconv.FormatBool(info.Scrollable))
+	node.CreateAttr("long-clickable", strconv.FormatBool(info.LongClickable))
+	node.CreateAttr("selected", strconv.FormatBool(info.Selected))
+	node.CreateAttr("bounds", fmt.Sprintf("[%d,%d][%d,%d]", info.Bounds.Left, info.Bounds.Top, info.Bounds.Right, info.Bounds.Bottom))
+
+	return &element{
+		Document: &Document{d: d, root: node, element: node, attachment: &attachment{ctx: ctx}},
+		x:        (info.Bounds.Left + info.Bounds.Right) / 2,
+		y:        (info.Bounds.Top + info.Bounds.Bottom) / 2,
+	}
+}
+
+// attachment is the pending dump of a document built by u2Element
+type attachment struct {
+	ctx  context.Context // context of the lookup that found the node
+	once sync.Once
+	mu   sync.Mutex // guards the nodes of the document replaced by attach
+}
+
+// attach replaces the synthetic node of a document built by u2Element with the
+// same node of a hierarchy dump, once, so that its relatives can be reached.
+// The node is the first one with the same bounds, class, resource id, text and
+// content description; the synthetic node is kept if none matches.
+// The nodes may be read without locking once attach returned, readers not
+// calling it use node.
+func (d *Document) attach() {
+	a := d.attachment
+	if a == nil {
+		return
+	}
+
+	a.once.Do(func() {
+		doc := d.d.DocumentContext(a.ctx)
+		if doc == nil {
+			return
+		}
+
+		self := d.element
+		same := func(node *etree.Element) bool {
+			for _, name := range []string{"bounds", "class", "resource-id", "text", "content-desc"} {
+				if node.SelectAttrValue(name, "") != self.SelectAttrValue(name, "") {
+					return false
+				}
+			}
+			return true
+		}
+
+		var found *etree.Element
+		var walk func(parent *etree.Element)
+		walk = func(parent *etree.Element) {
+			for _, child := range parent.ChildElements() {
+				if found != nil {
+					return
+				}
+				if isNode(child) && same(child) {
+					found = child
+					return
+				}
+				walk(child)
+			}
+		}
+		walk(doc.root)
+
+		if found != nil {
+			a.mu.Lock()
+			d.RawXML, d.root, d.element = doc.RawXML, doc.root, found
+			a.mu.Unlock()
+		}
+	})
+}
+
+// node returns the selected node without attaching it, attach may replace it
+// concurrently
+func (d *Document) node() *etree.Element {
+	if d.attachment == nil {
+		return d.element
+	}
+
+	d.attachment.mu.Lock()
+	defer d.attachment.mu.Unlock()
+
+	return d.element
+}
+
+// u2Selector translates a By into the equivalent UiSelector query
+func u2Selector(by By) (U2Selector, bool) {
+	var sel U2Selector
+
+	// U2Selector leaves empty strings out, the query would match any object:
+	// such a By is searched in dumps, matching empty attributes
+	if by.Value == "" {
+		return sel, false
+	}
+
+	switch by.Selector {
+	case Text:
+		sel.Text = by.Value
+	case ContentDesc:
+		sel.Description = by.Value
+	case Class:
+		sel.ClassName = by.Value
+	case ResourceID:
+		sel.ResourceID = by.Value
+	case StartsWithText:
+		sel.TextStartsWith = by.Value
+	case EndsWithText:
+		sel.TextMatches = endsWithPattern(by.Value)
+	case StartsWithContentDesc:
+		sel.DescriptionStartsWith = by.Value
+	case EndsWithContentDesc:
+		sel.DescriptionMatches = endsWithPattern(by.Value)
+	case StartsWithClass:
+		sel.ClassNameMatches = startsWithPattern(by.Value)
+	case EndsWithClass:
+		sel.ClassNameMatches = endsWithPattern(by.Value)
+	case StartsWithResourceID:
+		sel.ResourceIDMatches = startsWithPattern(by.Value)
+	case EndsWithResourceID:
+		sel.ResourceIDMatches = endsWithPattern(by.Value)
+	default:
+		return sel, false
+	}
+
+	return sel, true
+}
+
+// javaQuote quotes a string for a Java regular expression, like Pattern.quote
+func javaQuote(s string) string {
+	return `\Q` + strings.ReplaceAll(s, `\E`, `\E\\E\Q`) + `\E`
+}
+
+// startsWithPattern returns a Java regular expression matching strings starting with s
+func startsWithPattern(s string) string {
+	return "(?s)" + javaQuote(s) + ".*"
+}
+
+// endsWithPattern returns a Java regular expression matching strings ending with s
+func endsWithPattern(s string) string {
+	return "(?s).*" + javaQuote(s)
+}
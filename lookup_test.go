@@ -0,0 +1,187 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lookupHierarchy is a dump holding a label and an input under it
+const lookupHierarchy = `<?xml version="1.0" encoding="UTF-8"?>
+<hierarchy rotation="0">
+  <node index="0" text="" resource-id="app:id/form" class="android.widget.LinearLayout" content-desc="" bounds="[0,0][1080,400]">
+    <node index="0" text="Name" resource-id="app:id/label" class="android.widget.TextView" content-desc="" bounds="[0,0][1080,100]"/>
+    <node index="1" text="" resource-id="app:id/name" class="android.widget.EditText" content-desc="" bounds="[0,120][1080,220]"/>
+  </node>
+</hierarchy>`
+
+// labelInfo is the objInfo answer describing the label of lookupHierarchy
+const labelInfo = `{"bounds":{"left":0,"top":0,"right":1080,"bottom":100},"className":"android.widget.TextView","resourceName":"app:id/label","text":"Name","enabled":true}`
+
+// newLookupDriver creates a driver with a running UiAutomator server answering
+// objInfo with labelInfo and dumps with the given hierarchy
+func newLookupDriver(t *testing.T, hierarchy string) (*Driver, *fakeExecutor) {
+	t.Helper()
+
+	dump, _ := json.Marshal(hierarchy)
+	fake := newFakeExecutor().
+		On(`^adb forward tcp:0 tcp:\d+$`, "40123\n").
+		On(`^rpc objInfo$`, labelInfo).
+		On(`^rpc dumpWindowHierarchy$`, string(dump))
+
+	d := newFakeDriver(t, fake)
+	d.supervisor.setState(U2Running, nil)
+
+	return d, fake
+}
+
+// countCalls returns how many calls of the fake are the given one
+func countCalls(fake *fakeExecutor, call string) int {
+	n := 0
+	for _, c := range fake.Calls() {
+		if c == call {
+			n++
+		}
+	}
+	return n
+}
+
+func TestU2ElementRelatives(t *testing.T) {
+	d, fake := newLookupDriver(t, lookupHierarchy)
+
+	el, err := d.FindU2Element(U2Selector{Text: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if el.Text() != "Name" || el.ResourceID() != "app:id/label" {
+		t.Errorf("element = %q %q", el.Text(), el.ResourceID())
+	}
+	if n := countCalls(fake, "rpc dumpWindowHierarchy"); n != 0 {
+		t.Fatalf("FindU2Element() dumped the hierarchy %d times", n)
+	}
+
+	if parent := el.Parent(); parent == nil || parent.ResourceID() != "app:id/form" {
+		t.Errorf("Parent() = %v, want the form", parent)
+	}
+	if below := el.Below(HasClass(Eq("android.widget.EditText"))); below == nil || below.ResourceID() != "app:id/name" {
+		t.Errorf("Below() = %v, want the input", below)
+	}
+	if siblings := el.Siblings(); len(siblings) != 1 {
+		t.Errorf("Siblings() = %v, want the input", siblings)
+	}
+
+	if n := countCalls(fake, "rpc dumpWindowHierarchy"); n != 1 {
+		t.Errorf("relatives dumped the hierarchy %d times, want once", n)
+	}
+}
+
+func TestU2ElementScreenChanged(t *testing.T) {
+	d, fake := newLookupDriver(t, strings.Replace(lookupHierarchy, `text="Name"`, `text="Email"`, 1))
+
+	el, err := d.FindU2Element(U2Selector{Text: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parent := el.Parent(); parent != nil {
+		t.Errorf("Parent() = %v, want nil once the node is gone", parent)
+	}
+	if children := el.Children(); children != nil {
+		t.Errorf("Children() = %v, want nil", children)
+	}
+	if el.Text() != "Name" {
+		t.Errorf("Text() = %q, want the attributes of the server", el.Text())
+	}
+
+	if n := countCalls(fake, "rpc dumpWindowHierarchy"); n != 1 {
+		t.Errorf("dumped the hierarchy %d times, want once", n)
+	}
+}
+
+func TestU2ElementContext(t *testing.T) {
+	d, fake := newLookupDriver(t, lookupHierarchy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	el, err := d.FindU2ElementContext(ctx, U2Selector{Text: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// The dump is bound to the context of the lookup
+	if parent := el.Parent(); parent != nil {
+		t.Errorf("Parent() = %v, want nil once the lookup is canceled", parent)
+	}
+	if n := countCalls(fake, "rpc dumpWindowHierarchy"); n != 0 {
+		t.Errorf("dumped the hierarchy %d times after the lookup was canceled", n)
+	}
+}
+
+func TestU2ElementConcurrent(t *testing.T) {
+	d, _ := newLookupDriver(t, lookupHierarchy)
+
+	el, err := d.FindU2Element(U2Selector{Text: "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attributes may be read while the relatives attach the node
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if el.Text() != "Name" || el.GetBounds() == nil {
+				t.Errorf("element = %q %v", el.Text(), el.GetBounds())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if el.Parent() == nil {
+				t.Error("Parent() = nil, want the form")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestWaitElementLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		locator  Locator
+		wantCall string
+		wantID   string
+	}{
+		{"by", By{Selector: Text, Value: "Name"}, "rpc waitForExists", "app:id/label"},
+		{"query", HasText(Eq("Name")).Inside(HasResourceID(Eq("app:id/form"))), "rpc dumpWindowHierarchy", "app:id/label"},
+		// An empty value would be left out of the UiSelector, matching any object
+		{"empty value", By{Selector: Text, Value: ""}, "rpc dumpWindowHierarchy", "app:id/form"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, fake := newLookupDriver(t, lookupHierarchy)
+			fake.On(`^rpc waitForExists$`, "true")
+			d.config.Lookup = LookupSelector
+
+			el, err := d.WaitElement(tt.locator)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if el.ResourceID() != tt.wantID {
+				t.Errorf("WaitElement() = %q, want %q", el.ResourceID(), tt.wantID)
+			}
+			if countCalls(fake, tt.wantCall) == 0 {
+				t.Errorf("calls = %q, want %q", fake.Calls(), tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestU2SelectorEmptyValue(t *testing.T) {
+	if sel, ok := u2Selector(By{Selector: Text, Value: ""}); ok {
+		t.Errorf("u2Selector() = %+v, want the dump backend", sel)
+	}
+}
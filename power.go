@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"regexp"
 	"strconv"
 )
@@ -10,7 +11,15 @@ import (
 //   - An integer representing the battery level (0-100)
 //   - If the battery level cannot be retrieved, it returns 0
 func (d *Driver) Battery() int {
-	output, _ := d.Run("dumpsys", "battery", "|", "grep", "level")
+	return d.BatteryContext(context.Background())
+}
+
+// BatteryContext retrieves the battery level like Battery, stopping when ctx is done
+// Returns:
+//   - An integer representing the battery level (0-100)
+//   - If the battery level cannot be retrieved, it returns 0
+func (d *Driver) BatteryContext(ctx context.Context) int {
+	output, _ := d.PipeContext(ctx, Cmd("dumpsys", "battery"), Cmd("grep", "level"))
 
 	// Regular expression to match the battery level (number)
 	re := regexp.MustCompile(`\d+`)
@@ -31,13 +40,23 @@ func (d *Driver) Battery() int {
 // StopCharging disables all charging sources (AC, USB, Wireless)
 // This will prevent the device from charging
 func (d *Driver) StopCharging() {
-	d.Run("dumpsys", "battery", "set", "ac", "0")
-	d.Run("dumpsys", "battery", "set", "usb", "0")
-	d.Run("dumpsys", "battery", "set", "wireless", "0")
+	d.StopChargingContext(context.Background())
+}
+
+// StopChargingContext disables all charging sources like StopCharging, stopping when ctx is done
+func (d *Driver) StopChargingContext(ctx context.Context) {
+	d.RunContext(ctx, "dumpsys", "battery", "set", "ac", "0")
+	d.RunContext(ctx, "dumpsys", "battery", "set", "usb", "0")
+	d.RunContext(ctx, "dumpsys", "battery", "set", "wireless", "0")
 }
 
 // StartCharging resets the battery system, enabling charging again
 // This restores all charging sources and allows the device to charge
 func (d *Driver) StartCharging() {
-	d.Run("dumpsys", "battery", "reset")
+	d.StartChargingContext(context.Background())
+}
+
+// StartChargingContext resets the battery system like StartCharging, stopping when ctx is done
+func (d *Driver) StartChargingContext(ctx context.Context) {
+	d.RunContext(ctx, "dumpsys", "battery", "reset")
 }
@@ -0,0 +1,35 @@
+package driver
+
+import "testing"
+
+func TestBattery(t *testing.T) {
+	tests := []struct {
+		name string
+		fake *fakeExecutor
+		want int
+	}{
+		{
+			name: "level",
+			fake: newFakeExecutor().On(`^dumpsys battery \| grep level$`, "  level: 87\n"),
+			want: 87,
+		},
+		{
+			name: "full",
+			fake: newFakeExecutor().On(`^dumpsys battery \| grep level$`, "  level: 100\n"),
+			want: 100,
+		},
+		{
+			name: "no match",
+			fake: newFakeExecutor().OnResult(`^dumpsys battery \| grep level$`, Result{ExitCode: 1}),
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newFakeDriver(t, tt.fake).Battery(); got != tt.want {
+				t.Errorf("Battery() = %d, want %d (calls %q)", got, tt.want, tt.fake.Calls())
+			}
+		})
+	}
+}
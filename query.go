@@ -0,0 +1,438 @@
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Locator finds elements in the hierarchy. By, Query and XPath are locators.
+// A nil or empty locator, such as By{} or Query{}, locates nothing on its own
+// and is ignored when combined: And and Or leave it out, Inside does not
+// restrict the query to its descendants, and Not of it is empty as well.
+type Locator interface {
+	// match reports whether a hierarchy node is located, c keeping what is
+	// computed once per hierarchy during a search
+	match(node *etree.Element, c *matchCache) bool
+}
+
+// matchCache holds what a search computes once per hierarchy: the nodes
+// selected by the XPath expressions of its locator, and the first error of
+// their evaluation. The zero value is ready to use.
+type matchCache struct {
+	selected map[xpathKey]map[*etree.Element]bool // selected nodes, by expression and hierarchy
+	err      error                                // first evaluation error, e.g. an expression selecting texts
+}
+
+// xpathKey identifies the evaluation of an expression on a hierarchy
+type xpathKey struct {
+	expr string
+	root *etree.Element
+}
+
+// xpath returns the nodes selected by an expression evaluated from root,
+// evaluating it on first use only
+func (c *matchCache) xpath(expr string, root *etree.Element) map[*etree.Element]bool {
+	key := xpathKey{expr: expr, root: root}
+	if nodes, ok := c.selected[key]; ok {
+		return nodes
+	}
+
+	selected, err := evalXPath(expr, root)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+
+	nodes := make(map[*etree.Element]bool, len(selected))
+	for _, node := range selected {
+		nodes[node] = true
+	}
+
+	if c.selected == nil {
+		c.selected = make(map[xpathKey]map[*etree.Element]bool)
+	}
+	c.selected[key] = nodes
+
+	return nodes
+}
+
+// Matcher tests an attribute value, e.g. Eq("OK") or Prefix("Pay")
+type Matcher struct {
+	test func(value string) bool // the test, nil if err is set
+	desc string                  // description, e.g. `="OK"`
+	err  error                   // why the matcher is invalid, e.g. a bad regular expression
+}
+
+// MatchFunc creates a Matcher from a function, for tests not covered by the other matchers
+// Parameters:
+//   - desc: description of the test, used by Query.String
+//   - test: the test
+//
+// Returns:
+//   - Matcher: the matcher
+func MatchFunc(desc string, test func(value string) bool) Matcher {
+	return Matcher{test: test, desc: " " + desc}
+}
+
+// Eq matches values equal to s
+func Eq(s string) Matcher {
+	return Matcher{test: func(value string) bool { return value == s }, desc: "=" + strconv.Quote(s)}
+}
+
+// Contains matches values containing s
+func Contains(s string) Matcher {
+	return Matcher{test: func(value string) bool { return strings.Contains(value, s) }, desc: " contains " + strconv.Quote(s)}
+}
+
+// Prefix matches values starting with s
+func Prefix(s string) Matcher {
+	return Matcher{test: func(value string) bool { return strings.HasPrefix(value, s) }, desc: " starts with " + strconv.Quote(s)}
+}
+
+// Suffix matches values ending with s
+func Suffix(s string) Matcher {
+	return Matcher{test: func(value string) bool { return strings.HasSuffix(value, s) }, desc: " ends with " + strconv.Quote(s)}
+}
+
+// Regex matches values containing a match of a regular expression, anchor it
+// with ^ and $ to match whole values. An invalid expression matches nothing,
+// the lookups of a query using it return the compile error.
+func Regex(pattern string) Matcher {
+	desc := " matches " + strconv.Quote(pattern)
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Matcher{desc: desc, err: err}
+	}
+	return Matcher{test: re.MatchString, desc: desc}
+}
+
+// Query is a composable Locator, built from attribute conditions combined
+// with And, Or, Not and Inside, e.g. a button whose text starts with "Pay"
+// inside the "checkout" view:
+//
+//	driver.And(
+//		driver.HasClass(driver.Eq("android.widget.Button")),
+//		driver.HasText(driver.Prefix("Pay")),
+//	).Inside(driver.HasResourceID(driver.Suffix(":id/checkout")))
+type Query struct {
+	pred    func(node *etree.Element, c *matchCache) bool // condition on a node, nil for the empty query
+	desc    string                                        // description, for String
+	timeout time.Duration                                 // how long WaitElement waits, see Within
+	err     error                                         // first invalid matcher of the query, returned by the lookups
+}
+
+// match reports whether the node fulfills the query
+func (q Query) match(node *etree.Element, c *matchCache) bool {
+	return q.pred != nil && q.pred(node, c)
+}
+
+// String describes the query
+func (q Query) String() string {
+	return q.desc
+}
+
+// Within sets how long WaitElement waits for the query
+// Parameters:
+//   - timeout: maximum time to wait, Config.WaitTimeout if zero
+//
+// Returns:
+//   - Query: the query with the timeout
+func (q Query) Within(timeout time.Duration) Query {
+	q.timeout = timeout
+	return q
+}
+
+// Inside restricts the query to descendants of a node located by ancestor
+// Parameters:
+//   - ancestor: locator of an ancestor, e.g. HasResourceID(Eq("app:id/checkout")),
+//     the query being left as it is if empty
+//
+// Returns:
+//   - Query: the restricted query
+func (q Query) Inside(ancestor Locator) Query {
+	if isEmptyLocator(ancestor) || isEmptyLocator(q) {
+		return q
+	}
+
+	return Query{
+		pred: func(node *etree.Element, c *matchCache) bool {
+			if !q.match(node, c) {
+				return false
+			}
+			for parent := node.Parent(); parent != nil; parent = parent.Parent() {
+				if isNode(parent) && ancestor.match(parent, c) {
+					return true
+				}
+			}
+			return false
+		},
+		desc:    fmt.Sprintf("%s inside %s", q, describe(ancestor)),
+		timeout: q.timeout,
+		err:     firstError(q, ancestor),
+	}
+}
+
+// Attr locates nodes whose attribute exists and matches m
+// Parameters:
+//   - name: attribute name as in the hierarchy dump, e.g. "text" or "resource-id"
+//   - m: the matcher
+//
+// Returns:
+//   - Query: the query
+func Attr(name string, m Matcher) Query {
+	return Query{
+		pred: func(node *etree.Element, c *matchCache) bool {
+			attr := node.SelectAttr(name)
+			return attr != nil && m.test != nil && m.test(attr.Value)
+		},
+		desc: "@" + name + m.desc,
+		err:  m.err,
+	}
+}
+
+// HasText locates nodes by text
+func HasText(m Matcher) Query {
+	return Attr("text", m)
+}
+
+// HasDesc locates nodes by content description
+func HasDesc(m Matcher) Query {
+	return Attr("content-desc", m)
+}
+
+// HasClass locates nodes by class name
+func HasClass(m Matcher) Query {
+	return Attr("class", m)
+}
+
+// HasResourceID locates nodes by resource id
+func HasResourceID(m Matcher) Query {
+	return Attr("resource-id", m)
+}
+
+// HasPackage locates nodes by package name
+func HasPackage(m Matcher) Query {
+	return Attr("package", m)
+}
+
+// HasIndex locates nodes by index among their siblings
+func HasIndex(index int) Query {
+	return flag("index", strconv.Itoa(index))
+}
+
+// IsClickable locates nodes that are clickable, or not
+func IsClickable(clickable bool) Query {
+	return flag("clickable", strconv.FormatBool(clickable))
+}
+
+// IsEnabled locates nodes that are enabled, or not
+func IsEnabled(enabled bool) Query {
+	return flag("enabled", strconv.FormatBool(enabled))
+}
+
+// IsChecked locates nodes that are checked, or not
+func IsChecked(checked bool) Query {
+	return flag("checked", strconv.FormatBool(checked))
+}
+
+// IsScrollable locates nodes that are scrollable, or not
+func IsScrollable(scrollable bool) Query {
+	return flag("scrollable", strconv.FormatBool(scrollable))
+}
+
+// flag locates nodes whose attribute has the given value
+func flag(name, value string) Query {
+	q := Attr(name, Eq(value))
+	q.desc = "@" + name + "=" + value
+	return q
+}
+
+// And locates nodes located by every locator, empty locators being left out
+func And(locators ...Locator) Query {
+	locators = nonEmpty(locators)
+	if len(locators) == 0 {
+		return Query{}
+	}
+
+	return Query{
+		pred: func(node *etree.Element, c *matchCache) bool {
+			for _, l := range locators {
+				if !l.match(node, c) {
+					return false
+				}
+			}
+			return true
+		},
+		desc: combine(" and ", locators),
+		err:  firstError(locators...),
+	}
+}
+
+// Or locates nodes located by any locator, empty locators being left out
+func Or(locators ...Locator) Query {
+	locators = nonEmpty(locators)
+	if len(locators) == 0 {
+		return Query{}
+	}
+
+	return Query{
+		pred: func(node *etree.Element, c *matchCache) bool {
+			for _, l := range locators {
+				if l.match(node, c) {
+					return true
+				}
+			}
+			return false
+		},
+		desc: combine(" or ", locators),
+		err:  firstError(locators...),
+	}
+}
+
+// Not locates nodes not located by l, the empty query if l is empty
+func Not(l Locator) Query {
+	if isEmptyLocator(l) {
+		return Query{}
+	}
+
+	return Query{
+		pred: func(node *etree.Element, c *matchCache) bool { return !l.match(node, c) },
+		desc: "not " + describe(l),
+		err:  firstError(l),
+	}
+}
+
+// nonEmpty returns the locators that are not empty
+func nonEmpty(locators []Locator) []Locator {
+	var valid []Locator
+	for _, l := range locators {
+		if !isEmptyLocator(l) {
+			valid = append(valid, l)
+		}
+	}
+	return valid
+}
+
+// firstError returns the error of the first invalid locator, nil if all are valid
+func firstError(locators ...Locator) error {
+	for _, l := range locators {
+		if err := locatorError(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// combine describes locators joined by an operator
+func combine(op string, locators []Locator) string {
+	descs := make([]string, len(locators))
+	for i, l := range locators {
+		descs[i] = describe(l)
+	}
+	return "(" + strings.Join(descs, op) + ")"
+}
+
+// describe describes a locator
+func describe(l Locator) string {
+	if s, ok := l.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprint(l)
+}
+
+// String describes the selector
+func (by By) String() string {
+	return fmt.Sprintf("%s=%q", by.Selector, by.Value)
+}
+
+// match reports whether the node fulfills the selector, like the By* lookups of Document
+func (by By) match(node *etree.Element, _ *matchCache) bool {
+	attr := func(name string) (string, bool) {
+		a := node.SelectAttr(name)
+		if a == nil {
+			return "", false
+		}
+		return a.Value, true
+	}
+
+	switch by.Selector {
+	case Text, ContentDesc, Class, ResourceID:
+		value, ok := attr(string(by.Selector))
+		return ok && value == by.Value
+	case StartsWithText:
+		value, _ := attr("text")
+		return value != "" && strings.HasPrefix(value, by.Value)
+	case EndsWithText:
+		value, _ := attr("text")
+		return value != "" && strings.HasSuffix(value, by.Value)
+	case StartsWithContentDesc:
+		value, _ := attr("content-desc")
+		return value != "" && strings.HasPrefix(value, by.Value)
+	case EndsWithContentDesc:
+		value, _ := attr("content-desc")
+		return value != "" && strings.HasSuffix(value, by.Value)
+	case StartsWithClass:
+		value, _ := attr("class")
+		return value != "" && strings.HasPrefix(value, by.Value)
+	case EndsWithClass:
+		value, _ := attr("class")
+		return value != "" && strings.HasSuffix(value, by.Value)
+	case StartsWithResourceID:
+		value, _ := attr("resource-id")
+		return value != "" && strings.HasPrefix(value, by.Value)
+	case EndsWithResourceID:
+		value, _ := attr("resource-id")
+		return value != "" && strings.HasSuffix(value, by.Value)
+	}
+
+	return false
+}
+
+// isNode reports whether an XML element is a node of the hierarchy
+func isNode(el *etree.Element) bool {
+	return el.Tag == "node"
+}
+
+// isEmptyLocator reports whether a locator locates nothing by construction
+func isEmptyLocator(l Locator) bool {
+	switch l := l.(type) {
+	case nil:
+		return true
+	case By:
+		return l.Selector == ""
+	case Query:
+		return l.pred == nil
+	case XPath:
+		return l == ""
+	}
+	return false
+}
+
+// locatorError returns why a locator is invalid, e.g. the compile error of a
+// Regex or of an XPath, nil if it is valid
+func locatorError(l Locator) error {
+	switch l := l.(type) {
+	case Query:
+		return l.err
+	case XPath:
+		_, err := compileXPath(string(l))
+		return err
+	}
+	return nil
+}
+
+// locatorTimeout returns how long WaitElement waits for a locator, 0 for the default
+func locatorTimeout(l Locator) time.Duration {
+	switch l := l.(type) {
+	case By:
+		return time.Duration(l.Timeout) * time.Millisecond
+	case Query:
+		return l.timeout
+	}
+	return 0
+}
@@ -0,0 +1,239 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"regexp/syntax"
+	"testing"
+	"time"
+)
+
+func TestLookupScope(t *testing.T) {
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, lookupHierarchy)
+
+	form, err := doc.FindElement(XPath(`//node[@resource-id="app:id/form"]`))
+	if err != nil {
+		t.Fatalf("FindElement(XPath) on the document: %v", err)
+	}
+	label, err := form.FindElement(HasText(Eq("Name")))
+	if err != nil {
+		t.Fatalf("FindElement(Query) on the form: %v", err)
+	}
+
+	// count returns how many elements a lookup found
+	count := func(es []Element, err error) int {
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(es)
+	}
+
+	tests := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"form absolute xpath", count(form.FindElements(XPath("//node"))), 2},
+		{"form relative xpath", count(form.FindElements(XPath("./node"))), 2},
+		{"form by", count(form.FindElements(By{Selector: Text, Value: "Name"})), 1},
+		{"label absolute xpath", count(label.FindElements(XPath("//node"))), 0},
+		{"label parent axis", count(label.FindElements(XPath(".."))), 0},
+		{"label query", count(label.FindElements(HasText(Eq("Name")))), 0},
+		{"document xpath", count(doc.FindElements(XPath("//node"))), 3},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: found %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if _, err := label.FindElement(HasText(Eq("Name"))); !errors.Is(err, ErrElementNotFound) {
+		t.Errorf("FindElement() on the label error = %v, want ErrElementNotFound", err)
+	}
+	if el := label.ByText("Name"); el != nil {
+		t.Error("ByText() on the label found the label itself")
+	}
+	if el := form.ByText("Name"); el == nil {
+		t.Error("ByText() on the form = nil")
+	}
+	if _, err := label.SelectElement("//node"); !errors.Is(err, ErrElementNotFound) {
+		t.Errorf("SelectElement() on the label error = %v, want ErrElementNotFound", err)
+	}
+
+	// Relatives still search the whole screen
+	if parent := label.Parent(); parent == nil || parent.ResourceID() != "app:id/form" {
+		t.Errorf("Parent() = %v, want the form", parent)
+	}
+}
+
+func TestXPathLocator(t *testing.T) {
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, lookupHierarchy)
+
+	tests := []struct {
+		name    string
+		locator Locator
+		want    string
+		wantErr error
+	}{
+		{name: "built", locator: NewXPath().Descendant("node").AttrEq("text", "Name"), want: "app:id/label"},
+		{name: "following sibling", locator: XPath(`//node[@text="Name"]/following-sibling::node`), want: "app:id/name"},
+		{name: "combined", locator: And(XPath("//node[@index=1]"), HasClass(Suffix("EditText"))), want: "app:id/name"},
+		{name: "no match", locator: XPath(`//node[@text="Email"]`), wantErr: ErrElementNotFound},
+		{name: "invalid", locator: XPath("//node["), wantErr: &XPathError{}},
+		{name: "invalid combined", locator: Or(XPath("//node["), HasText(Eq("Name"))), wantErr: &XPathError{}},
+		{name: "selecting attributes", locator: XPath("//node/@text"), wantErr: &XPathError{}},
+		{name: "selecting attributes combined", locator: And(HasText(Eq("Name")), XPath("//node/@text")), wantErr: &XPathError{}},
+		{name: "empty", locator: XPath(""), wantErr: ErrSelectorEmpty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			el, err := doc.FindElement(tt.locator)
+
+			var xerr *XPathError
+			switch tt.wantErr.(type) {
+			case nil:
+				if err != nil || el.ResourceID() != tt.want {
+					t.Errorf("FindElement() = %v, %v, want %s", el, err, tt.want)
+				}
+			case *XPathError:
+				if !errors.As(err, &xerr) {
+					t.Errorf("FindElement() error = %v, want *XPathError", err)
+				}
+				if _, err := doc.FindElements(tt.locator); !errors.As(err, &xerr) {
+					t.Errorf("FindElements() error = %v, want *XPathError", err)
+				}
+			default:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("FindElement() error = %v, want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestXPathWaitErrors(t *testing.T) {
+	d, _ := newLookupDriver(t, lookupHierarchy)
+
+	tests := []struct {
+		name    string
+		locator Locator
+	}{
+		{"invalid", XPath("//node[")},
+		{"invalid combined", And(HasText(Eq("Name")), XPath("//node["))},
+		{"selecting attributes", XPath("//node/@text")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reported at once rather than once Config.WaitTimeout is over
+			start := time.Now()
+			var xerr *XPathError
+			if _, err := d.WaitElement(tt.locator); !errors.As(err, &xerr) {
+				t.Errorf("WaitElement() error = %v, want *XPathError", err)
+			}
+			if elapsed := time.Since(start); elapsed > d.config.WaitTimeout/2 {
+				t.Errorf("WaitElement() returned after %s", elapsed)
+			}
+		})
+	}
+
+	var xerr *XPathError
+	if err := d.Watch("invalid", XPath("//node["), WatchBack); !errors.As(err, &xerr) {
+		t.Errorf("Watch() error = %v, want *XPathError", err)
+	}
+	if _, ok := d.WatcherCounts()["invalid"]; ok {
+		t.Error("Watch() registered an invalid expression")
+	}
+
+	// An expression failing on a screen is reported by WatcherErrors
+	if err := d.Watch("texts", XPath("//node/@text"), WatchBack); err != nil {
+		t.Fatal(err)
+	}
+	d.runWatchers(withWatching(context.Background()), newTestDocument(t, d, lookupHierarchy))
+	if err := d.WatcherErrors()["texts"]; !errors.As(err, &xerr) {
+		t.Errorf("WatcherErrors() = %v, want *XPathError", err)
+	}
+}
+
+func TestEmptyLocators(t *testing.T) {
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, lookupHierarchy)
+	label := HasText(Eq("Name"))
+
+	tests := []struct {
+		name    string
+		locator Locator
+		want    int
+	}{
+		{"inside nil", label.Inside(nil), 1},
+		{"inside empty", label.Inside(Query{}), 1},
+		{"empty inside", Query{}.Inside(HasResourceID(Eq("app:id/form"))), -1},
+		{"not nil", Not(nil), -1},
+		{"not empty by", Not(By{}), -1},
+		{"and with nil", And(label, nil), 1},
+		{"and with an empty not", And(label, Not(nil)), 1},
+		{"and of nils", And(nil, Query{}), -1},
+		{"or with nil", Or(nil, label), 1},
+		{"or of nils", Or(nil, XPath("")), -1},
+		{"nil", nil, -1},
+		{"empty query", Query{}, -1},
+	}
+
+	// Empty locators are ignored when combined, and locate nothing on their own
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := doc.FindElements(tt.locator)
+			if tt.want < 0 {
+				if !errors.Is(err, ErrSelectorEmpty) {
+					t.Errorf("FindElements() = %d, %v, want ErrSelectorEmpty", len(found), err)
+				}
+				return
+			}
+			if err != nil || len(found) != tt.want {
+				t.Errorf("FindElements() = %d, %v, want %d", len(found), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidRegex(t *testing.T) {
+	d, _ := newLookupDriver(t, lookupHierarchy)
+	doc := newTestDocument(t, d, lookupHierarchy)
+
+	bad := HasText(Regex("Na(me"))
+	tests := []struct {
+		name    string
+		locator Locator
+	}{
+		{"query", bad},
+		{"and", And(HasClass(Suffix("TextView")), bad)},
+		{"or", Or(bad, HasText(Eq("Name")))},
+		{"not", Not(bad)},
+		{"inside", HasText(Eq("Name")).Inside(bad)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var syntaxErr *syntax.Error
+			if _, err := doc.FindElement(tt.locator); !errors.As(err, &syntaxErr) {
+				t.Errorf("FindElement() error = %v, want the compile error", err)
+			}
+			if _, err := doc.FindElements(tt.locator); !errors.As(err, &syntaxErr) {
+				t.Errorf("FindElements() error = %v, want the compile error", err)
+			}
+			if _, err := d.WaitElement(tt.locator); !errors.As(err, &syntaxErr) {
+				t.Errorf("WaitElement() error = %v, want the compile error", err)
+			}
+			if err := d.Watch("bad", tt.locator, WatchBack); !errors.As(err, &syntaxErr) {
+				t.Errorf("Watch() error = %v, want the compile error", err)
+			}
+		})
+	}
+
+	if el, err := doc.FindElement(HasText(Regex("^Na"))); err != nil || el.ResourceID() != "app:id/label" {
+		t.Errorf("FindElement() of a valid Regex = %v, %v, want the label", el, err)
+	}
+}
@@ -0,0 +1,112 @@
+package driver
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// safeArg matches arguments that need no quoting in a POSIX shell
+	safeArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+	// safePowerShellArg matches arguments that need no quoting in PowerShell,
+	// where "@" splats and "," builds arrays
+	safePowerShellArg = regexp.MustCompile(`^[A-Za-z0-9_+=:./-]+$`)
+)
+
+// Command represents a single device command and its arguments.
+// Arguments are always passed literally, they are never interpreted by a shell.
+type Command struct {
+	Name string   // program to execute
+	Args []string // arguments passed to the program
+}
+
+// Cmd creates a Command
+// Parameters:
+//   - name: program to execute
+//   - args: arguments passed to the program
+//
+// Returns:
+//   - Command: the command, ready to be used with Pipe
+func Cmd(name string, args ...string) Command {
+	return Command{Name: name, Args: args}
+}
+
+// String returns the command quoted for the device shell
+func (c Command) String() string {
+	return ShellJoin(append([]string{c.Name}, c.Args...))
+}
+
+// ShellQuote quotes a string for a POSIX shell such as the Android device shell.
+// Parameters:
+//   - s: the string to quote
+//
+// Returns:
+//   - string: s unchanged if it only contains safe characters, otherwise s
+//     wrapped in single quotes with embedded single quotes escaped
+func ShellQuote(s string) string {
+	if safeArg.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ShellJoin quotes each argument with ShellQuote and joins them with spaces
+// Parameters:
+//   - args: the arguments to join
+//
+// Returns:
+//   - string: a command line the device shell splits back into args
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = ShellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// PowerShellQuote quotes a string for PowerShell.
+// Parameters:
+//   - s: the string to quote
+//
+// Returns:
+//   - string: s unchanged if it only contains safe characters, otherwise s
+//     wrapped in single quotes with embedded single quotes doubled
+func PowerShellQuote(s string) string {
+	if safePowerShellArg.MatchString(s) {
+		return s
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// hostArgs builds the arguments that make the host shell run argv literally
+// Parameters:
+//   - shell: host shell (powershell/bash/sh)
+//   - argv: program and arguments to run
+//
+// Returns:
+//   - []string: arguments to pass to the shell executable
+func hostArgs(shell string, argv []string) []string {
+	if shell == "powershell" {
+		quoted := make([]string, len(argv))
+		for i, arg := range argv {
+			quoted[i] = PowerShellQuote(arg)
+		}
+		// The call operator runs the quoted program name as a command
+		return []string{"-NoProfile", "-NonInteractive", "-Command", "& " + strings.Join(quoted, " ")}
+	}
+
+	return []string{"-c", ShellJoin(argv)}
+}
+
+// pipeline joins commands into a device shell pipeline
+func pipeline(cmds []Command) string {
+	parts := make([]string, len(cmds))
+	for i, c := range cmds {
+		parts[i] = c.String()
+	}
+
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,488 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transcript entry kinds
+const (
+	TranscriptShell = "shell" // device shell command
+	TranscriptHost  = "host"  // adb host command
+	TranscriptRPC   = "rpc"   // JSON-RPC request to the UiAutomator server
+	TranscriptSync  = "sync"  // file transfer request of Push or Pull
+)
+
+// TranscriptEntry is a single recorded invocation
+type TranscriptEntry struct {
+	Kind     string          `json:"kind"`               // one of TranscriptShell/TranscriptHost/TranscriptRPC/TranscriptSync
+	Serial   string          `json:"serial,omitempty"`   // device serial the command was sent to
+	Command  string          `json:"command"`            // shell command line, adb host command, RPC method or sync request and path
+	Request  json.RawMessage `json:"request,omitempty"`  // JSON-RPC request body
+	Response json.RawMessage `json:"response,omitempty"` // JSON-RPC response body, or file information of a sync request
+	Data     []byte          `json:"data,omitempty"`     // content of a pulled file
+	Stdout   string          `json:"stdout,omitempty"`   // command stdout
+	Stderr   string          `json:"stderr,omitempty"`   // command stderr
+	ExitCode int             `json:"exit_code"`          // command exit status
+	Error    string          `json:"error,omitempty"`    // transport error, if any
+	Start    time.Duration   `json:"start"`              // offset from the beginning of the recording
+	Duration time.Duration   `json:"duration"`           // time spent by the invocation
+}
+
+// Transcript is a recorded device session
+type Transcript struct {
+	Entries []TranscriptEntry `json:"entries"`
+}
+
+// LoadTranscript reads a transcript saved by Recorder.Save
+// Parameters:
+//   - path: path of the JSON transcript file
+//
+// Returns:
+//   - *Transcript: the loaded transcript
+//   - error: nil if successful, otherwise error details
+func LoadTranscript(path string) (*Transcript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Recorder is an Executor capturing every invocation of the executor it wraps,
+// JSON-RPC requests and file transfers included, into a Transcript.
+// Device lists followed by WatchDevices are passed through without being recorded.
+type Recorder struct {
+	inner  Executor
+	client *http.Client // HTTP client of JSON-RPC requests the inner executor does not carry
+
+	mu         sync.Mutex
+	start      time.Time
+	transcript Transcript
+}
+
+// NewRecorder creates a Recorder
+// Parameters:
+//   - inner: executor doing the real work, nil to wrap the default executor
+//     of the driver the recorder is passed to with WithRecorder
+//
+// Returns:
+//   - *Recorder: the recorder
+func NewRecorder(inner Executor) *Recorder {
+	return &Recorder{inner: inner, start: time.Now()}
+}
+
+// WithRecorder records every invocation of the driver executor into rec
+// Parameters:
+//   - rec: the recorder, its inner executor is set to the driver executor if nil
+//
+// Returns:
+//   - Option: option to pass to New
+func WithRecorder(rec *Recorder) Option {
+	return func(d *Driver) {
+		d.recorder = rec
+	}
+}
+
+// Transcript returns a copy of what has been recorded so far
+func (r *Recorder) Transcript() *Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Transcript{Entries: append([]TranscriptEntry(nil), r.transcript.Entries...)}
+}
+
+// Save writes the transcript to a JSON file
+// Parameters:
+//   - path: destination file path
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Transcript(), "", " ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Shell runs the command with the inner executor and records it
+func (r *Recorder) Shell(ctx context.Context, serial, cmdline string) (*Result, error) {
+	start := time.Now()
+	res, err := r.inner.Shell(ctx, serial, cmdline)
+	r.record(TranscriptEntry{Kind: TranscriptShell, Serial: serial, Command: cmdline}, start, res, err)
+	return res, err
+}
+
+// Host runs the command with the inner executor and records it
+func (r *Recorder) Host(ctx context.Context, serial string, args ...string) (*Result, error) {
+	start := time.Now()
+	res, err := r.inner.Host(ctx, serial, args...)
+	r.record(TranscriptEntry{Kind: TranscriptHost, Serial: serial, Command: ShellJoin(args)}, start, res, err)
+	return res, err
+}
+
+// CallRPC sends the request with the inner executor, or over HTTP, and records it
+func (r *Recorder) CallRPC(ctx context.Context, url string, request []byte) ([]byte, error) {
+	start := time.Now()
+
+	var body []byte
+	var err error
+	if caller, ok := r.inner.(RPCCaller); ok {
+		body, err = caller.CallRPC(ctx, url, request)
+	} else {
+		body, err = httpRPC(ctx, r.client, url, request)
+	}
+
+	entry := TranscriptEntry{Kind: TranscriptRPC, Command: rpcMethod(request), Request: compactJSON(request)}
+	if err == nil {
+		entry.Response = compactJSON(body)
+	}
+	r.record(entry, start, nil, err)
+
+	return body, err
+}
+
+// TrackDevices follows the device list with the inner executor
+func (r *Recorder) TrackDevices(ctx context.Context, fn func([]DeviceInfo)) error {
+	tracker, ok := r.inner.(deviceTracker)
+	if !ok {
+		return errTrackingUnsupported
+	}
+	return tracker.TrackDevices(ctx, fn)
+}
+
+// OpenSync opens a transfer session with the inner executor, recording its requests
+func (r *Recorder) OpenSync(ctx context.Context, serial string) (syncSession, error) {
+	s, ok := r.inner.(syncer)
+	if !ok {
+		return nil, errSyncUnsupported
+	}
+
+	start := time.Now()
+	conn, err := s.OpenSync(ctx, serial)
+	r.record(TranscriptEntry{Kind: TranscriptSync, Serial: serial, Command: "OPEN"}, start, nil, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordedSync{r: r, serial: serial, inner: conn}, nil
+}
+
+// recordedSync is a sync session recording its requests
+type recordedSync struct {
+	r      *Recorder
+	serial string
+	inner  syncSession
+}
+
+// record appends the entry of a sync request, with the file information it returned
+func (s *recordedSync) record(op, remote string, start time.Time, info any, data []byte, err error) {
+	entry := TranscriptEntry{Kind: TranscriptSync, Serial: s.serial, Command: op + " " + remote, Data: data}
+	if err == nil && info != nil {
+		entry.Response, _ = json.Marshal(info)
+	}
+	s.r.record(entry, start, nil, err)
+}
+
+func (s *recordedSync) stat(remote string) (*syncStat, error) {
+	start := time.Now()
+	st, err := s.inner.stat(remote)
+	s.record("STAT", remote, start, st, nil, err)
+	return st, err
+}
+
+func (s *recordedSync) list(remote string) ([]*syncStat, error) {
+	start := time.Now()
+	entries, err := s.inner.list(remote)
+	s.record("LIST", remote, start, entries, nil, err)
+	return entries, err
+}
+
+func (s *recordedSync) sendFile(r io.Reader, remote string, mode os.FileMode, mtime time.Time, total int64, progress func(SyncProgress)) error {
+	start := time.Now()
+	err := s.inner.sendFile(r, remote, mode, mtime, total, progress)
+	s.record("SEND", remote, start, nil, nil, err)
+	return err
+}
+
+func (s *recordedSync) recvFile(w io.Writer, remote string, total int64, progress func(SyncProgress)) error {
+	start := time.Now()
+	var data bytes.Buffer
+	err := s.inner.recvFile(io.MultiWriter(w, &data), remote, total, progress)
+	s.record("RECV", remote, start, nil, data.Bytes(), err)
+	return err
+}
+
+func (s *recordedSync) Close() error {
+	return s.inner.Close()
+}
+
+// Close closes the inner executor if it holds resources
+func (r *Recorder) Close() error {
+	if closer, ok := r.inner.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// record appends an entry with the outcome and timing of an invocation
+func (r *Recorder) record(entry TranscriptEntry, start time.Time, res *Result, err error) {
+	if res != nil {
+		entry.Stdout = res.Stdout
+		entry.Stderr = res.Stderr
+		entry.ExitCode = res.ExitCode
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.Start = start.Sub(r.start)
+	entry.Duration = time.Since(start)
+	r.transcript.Entries = append(r.transcript.Entries, entry)
+}
+
+// ReplayedError is a transport error recorded in a Transcript and returned
+// again by a Replayer. Unlike the original error, it never triggers a recovery.
+type ReplayedError struct {
+	Message string // message of the recorded error
+}
+
+// Error implements the error interface
+func (e *ReplayedError) Error() string {
+	return e.Message
+}
+
+// Replayer is an Executor serving the responses of a Transcript.
+// Invocations are matched by kind and command (RPC requests by method and
+// params), and identical invocations are answered in the recorded order.
+// Recorded errors are returned as *ReplayedError.
+// Once the recorded answers of an invocation are used up, the last one is
+// repeated, so polling loops may run longer than during the recording.
+type Replayer struct {
+	Realtime bool // sleep for the recorded duration of every invocation
+
+	mu      sync.Mutex
+	entries map[string][]TranscriptEntry
+}
+
+// NewReplayer creates a Replayer serving the given transcript
+// Parameters:
+//   - t: the transcript to replay
+//
+// Returns:
+//   - *Replayer: executor to pass to WithExecutor
+func NewReplayer(t *Transcript) *Replayer {
+	r := &Replayer{entries: make(map[string][]TranscriptEntry)}
+
+	for _, entry := range t.Entries {
+		key := replayKey(entry.Kind, entry.Command, entry.Request)
+		r.entries[key] = append(r.entries[key], entry)
+	}
+
+	return r
+}
+
+// Shell answers a device command with its recorded result
+func (r *Replayer) Shell(ctx context.Context, serial, cmdline string) (*Result, error) {
+	entry, err := r.next(ctx, replayKey(TranscriptShell, cmdline, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.result()
+}
+
+// Host answers an adb host command with its recorded result
+func (r *Replayer) Host(ctx context.Context, serial string, args ...string) (*Result, error) {
+	entry, err := r.next(ctx, replayKey(TranscriptHost, ShellJoin(args), nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return entry.result()
+}
+
+// CallRPC answers a JSON-RPC request with its recorded response
+func (r *Replayer) CallRPC(ctx context.Context, url string, request []byte) ([]byte, error) {
+	entry, err := r.next(ctx, replayKey(TranscriptRPC, rpcMethod(request), request))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := entry.err(); err != nil {
+		return nil, err
+	}
+
+	// Answer with the id of this request rather than the recorded one
+	var req, resp map[string]json.RawMessage
+	if json.Unmarshal(request, &req) != nil || json.Unmarshal(entry.Response, &resp) != nil {
+		return entry.Response, nil
+	}
+	resp["id"] = req["id"]
+
+	return json.Marshal(resp)
+}
+
+// OpenSync opens a session serving recorded file transfers
+func (r *Replayer) OpenSync(ctx context.Context, serial string) (syncSession, error) {
+	entry, err := r.next(ctx, replayKey(TranscriptSync, "OPEN", nil))
+	if err == nil {
+		err = entry.err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &replayedSync{r: r, ctx: ctx}, nil
+}
+
+// replayedSync is a sync session of a Replayer
+type replayedSync struct {
+	r   *Replayer
+	ctx context.Context
+}
+
+// next returns the recorded entry of a sync request, decoding its file information into info
+func (s *replayedSync) next(op, remote string, info any) (TranscriptEntry, error) {
+	entry, err := s.r.next(s.ctx, replayKey(TranscriptSync, op+" "+remote, nil))
+	if err == nil {
+		err = entry.err()
+	}
+	if err == nil && info != nil {
+		err = json.Unmarshal(entry.Response, info)
+	}
+	return entry, err
+}
+
+func (s *replayedSync) stat(remote string) (*syncStat, error) {
+	var st *syncStat
+	if _, err := s.next("STAT", remote, &st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *replayedSync) list(remote string) ([]*syncStat, error) {
+	var entries []*syncStat
+	if _, err := s.next("LIST", remote, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (s *replayedSync) sendFile(r io.Reader, remote string, mode os.FileMode, mtime time.Time, total int64, progress func(SyncProgress)) error {
+	sent, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.next("SEND", remote, nil); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(SyncProgress{Path: remote, Bytes: sent, Total: total})
+	}
+	return nil
+}
+
+func (s *replayedSync) recvFile(w io.Writer, remote string, total int64, progress func(SyncProgress)) error {
+	entry, err := s.next("RECV", remote, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(entry.Data); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(SyncProgress{Path: remote, Bytes: int64(len(entry.Data)), Total: total})
+	}
+	return nil
+}
+
+func (s *replayedSync) Close() error {
+	return nil
+}
+
+// next pops the next recorded entry for key, keeping the last one
+func (r *Replayer) next(ctx context.Context, key string) (TranscriptEntry, error) {
+	r.mu.Lock()
+	queue := r.entries[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return TranscriptEntry{}, fmt.Errorf("%w: %s", ErrNotRecorded, key)
+	}
+
+	entry := queue[0]
+	if len(queue) > 1 {
+		r.entries[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	if r.Realtime {
+		select {
+		case <-ctx.Done():
+			return TranscriptEntry{}, ctx.Err()
+		case <-time.After(entry.Duration):
+		}
+	}
+
+	return entry, ctx.Err()
+}
+
+// result rebuilds the outcome of a recorded command
+func (e *TranscriptEntry) result() (*Result, error) {
+	if err := e.err(); err != nil {
+		return nil, err
+	}
+
+	return &Result{Stdout: e.Stdout, Stderr: e.Stderr, ExitCode: e.ExitCode}, nil
+}
+
+// err rebuilds the recorded transport error, nil if there was none
+func (e *TranscriptEntry) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return &ReplayedError{Message: e.Error}
+}
+
+// replayKey identifies an invocation, RPC requests by method and params only
+// since request ids differ between runs
+func replayKey(kind, command string, request []byte) string {
+	key := kind + " " + command
+	if kind == TranscriptRPC {
+		var req struct {
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(request, &req)
+		key += " " + string(compactJSON(req.Params))
+	}
+	return key
+}
+
+// compactJSON removes insignificant whitespace from a JSON document,
+// returning the input unchanged if it is not valid JSON
+func compactJSON(data []byte) json.RawMessage {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,157 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// trackingExecutor is a fakeExecutor following a fixed device list
+type trackingExecutor struct {
+	*fakeExecutor
+	devices []DeviceInfo
+}
+
+// TrackDevices reports the device list once and waits for ctx
+func (e *trackingExecutor) TrackDevices(ctx context.Context, fn func([]DeviceInfo)) error {
+	fn(e.devices)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeExecutor().
+		On(`^wm size$`, "Physical size: 1080x2400\n").
+		OnError(`^getprop ro.serialno$`, errors.New("device offline")).
+		OnFile("/sdcard/a.bin", []byte{0, 0xff, 0xfe, 'a'})
+	rec := NewRecorder(fake)
+	d := newFakeDriver(t, fake)
+	d.executor = rec
+
+	local := t.TempDir()
+	src := filepath.Join(local, "b.txt")
+	os.WriteFile(src, []byte("b"), 0644)
+
+	w, h := d.GetResolutionContext(ctx)
+	_, recordedErr := d.RunContext(ctx, "getprop", "ro.serialno")
+	if err := d.Pull(ctx, "/sdcard/a.bin", filepath.Join(local, "recorded.bin"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Push(ctx, src, "/sdcard/b.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Round-trip through a file
+	path := filepath.Join(local, "transcript.json")
+	if err := rec.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	transcript, err := LoadTranscript(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds []string
+	for _, entry := range transcript.Entries {
+		kinds = append(kinds, entry.Kind+" "+entry.Command)
+	}
+	want := []string{
+		"shell wm size",
+		"shell getprop ro.serialno",
+		"sync OPEN", "sync STAT /sdcard/a.bin", "sync RECV /sdcard/a.bin",
+		"sync OPEN", "sync STAT /sdcard/b.txt", "sync SEND /sdcard/b.txt",
+	}
+	if len(kinds) != len(want) {
+		t.Fatalf("recorded %q, want %q", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, kinds[i], want[i])
+		}
+	}
+
+	// Replay, with recovery enabled, without the fake
+	replay := New(WithExecutor(NewReplayer(transcript)), WithRecovery(RecoveryPolicy{Retries: 3, WaitTimeout: time.Minute}))
+
+	if rw, rh := replay.GetResolutionContext(ctx); rw != w || rh != h {
+		t.Errorf("replayed resolution = %d, %d, want %d, %d", rw, rh, w, h)
+	}
+
+	start := time.Now()
+	_, err = replay.RunContext(ctx, "getprop", "ro.serialno")
+	var replayed *ReplayedError
+	if !errors.As(err, &replayed) || err.Error() != recordedErr.Error() {
+		t.Errorf("replayed error = %v (%T), want *ReplayedError %q", err, err, recordedErr)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("replayed error triggered a recovery, took %s", time.Since(start))
+	}
+
+	if err := replay.Pull(ctx, "/sdcard/a.bin", filepath.Join(local, "replayed.bin"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(local, "replayed.bin")); string(data) != "\x00\xff\xfea" {
+		t.Errorf("replayed pull = %q", data)
+	}
+	if err := replay.Push(ctx, src, "/sdcard/b.txt", nil); err != nil {
+		t.Errorf("replayed push error = %v", err)
+	}
+
+	if _, err := replay.RunContext(ctx, "getprop", "ro.product.model"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("unrecorded command error = %v, want ErrNotRecorded", err)
+	}
+}
+
+func TestRecorderTrackDevices(t *testing.T) {
+	devices := []DeviceInfo{{Serial: "emulator-5554", State: StateDevice}}
+
+	tests := []struct {
+		name  string
+		inner Executor
+		want  bool
+	}{
+		{"tracking executor", &trackingExecutor{fakeExecutor: newFakeExecutor(), devices: devices}, true},
+		{"fake executor", newFakeExecutor(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := NewRecorder(tt.inner)
+			if got := canTrackDevices(rec); got != tt.want {
+				t.Errorf("canTrackDevices() = %v, want %v", got, tt.want)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			var got []DeviceInfo
+			err := rec.TrackDevices(ctx, func(list []DeviceInfo) { got = list })
+			if !tt.want {
+				if !errors.Is(err, errTrackingUnsupported) {
+					t.Errorf("TrackDevices() error = %v, want errTrackingUnsupported", err)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Serial != "emulator-5554" {
+				t.Errorf("TrackDevices() reported %v", got)
+			}
+		})
+	}
+}
+
+func TestRecorderWatchesDevice(t *testing.T) {
+	inner := &trackingExecutor{fakeExecutor: newFakeExecutor(), devices: []DeviceInfo{{Serial: "emulator-5554", State: StateDevice}}}
+	d := New(WithExecutor(inner), WithRecorder(NewRecorder(nil)))
+
+	d.watchDevice(DeviceInfo{Serial: "emulator-5554", State: StateDevice})
+	defer d.unwatchDevice()
+
+	if d.DeviceGone() == nil {
+		t.Error("DeviceGone() = nil, the device is not watched under WithRecorder")
+	}
+}
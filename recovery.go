@@ -0,0 +1,251 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// idempotentCommands lists the commands that can safely be run again after
+// the device dropped in the middle of their execution
+var idempotentCommands = map[string]bool{
+	"awk":         true,
+	"cat":         true,
+	"df":          true,
+	"dumpsys":     true,
+	"getprop":     true,
+	"grep":        true,
+	"ime":         true,
+	"ip":          true,
+	"ls":          true,
+	"netstat":     true,
+	"pidof":       true,
+	"ps":          true,
+	"pull":        true,
+	"push":        true,
+	"screencap":   true,
+	"stat":        true,
+	"test":        true,
+	"uiautomator": true,
+	"wm":          true,
+}
+
+// idempotentMethods lists the UiAutomator JSON-RPC methods that can safely be
+// sent again after the device dropped
+var idempotentMethods = map[string]bool{
+	"deviceInfo":          true,
+	"dumpWindowHierarchy": true,
+	"exist":               true,
+	"getLastToast":        true,
+	"objInfo":             true,
+	"takeScreenshot":      true,
+	"waitForExists":       true,
+	"waitForIdle":         true,
+}
+
+// RecoveryPolicy tells the driver how to recover when the device drops mid-run,
+// e.g. after a USB glitch. When a command fails because the transport was lost,
+// the driver waits for the device to come back, restarts the UiAutomator server,
+// switches back to the ADB keyboard, and retries the command if it is idempotent.
+type RecoveryPolicy struct {
+	Retries     int           // Maximum retries of an interrupted idempotent command
+	WaitTimeout time.Duration // How long to wait for the device, Config.WaitTimeout if zero
+	Backoff     time.Duration // Delay before the first retry, doubled after each retry
+}
+
+// WithRecovery enables automatic recovery when the device drops mid-run
+// Parameters:
+//   - policy: retry budget and timings of the recovery
+//
+// Returns:
+//   - Option: option to pass to New
+func WithRecovery(policy RecoveryPolicy) Option {
+	return func(d *Driver) {
+		d.recovery = &recoveryState{policy: policy}
+	}
+}
+
+// recoveryState serializes the recoveries of a driver
+type recoveryState struct {
+	policy RecoveryPolicy
+
+	mu         sync.Mutex
+	recoveries int // number of completed recoveries
+}
+
+// recoveringKey marks contexts of commands issued while recovering
+type recoveringKey struct{}
+
+// isRecovering reports whether ctx belongs to a recovery, whose commands must
+// not trigger another one
+func isRecovering(ctx context.Context) bool {
+	recovering, _ := ctx.Value(recoveringKey{}).(bool)
+	return recovering
+}
+
+// withoutRecovery returns a context whose commands do not trigger a recovery,
+// e.g. for health checks that are expected to fail
+func withoutRecovery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, recoveringKey{}, true)
+}
+
+// withRecovery runs fn and, when it fails because the transport was lost,
+// recovers the device and runs fn again if it is idempotent, within the
+// retry budget of the recovery policy
+// Parameters:
+//   - ctx: context of the operation
+//   - idempotent: whether fn can be run again
+//   - fn: the operation
+//
+// Returns:
+//   - error: the error of the last run of fn
+func (d *Driver) withRecovery(ctx context.Context, idempotent bool, fn func() error) error {
+	if d.recovery == nil || isRecovering(ctx) || isOneshot(ctx) {
+		return fn()
+	}
+
+	seen := d.recovery.generation()
+	err := fn()
+
+	delay := d.recovery.policy.Backoff
+	for attempt := 0; isTransportError(ctx, err); attempt++ {
+		if d.recoverDevice(ctx, seen) != nil {
+			return err
+		}
+
+		if !idempotent || attempt >= d.recovery.policy.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+
+		seen = d.recovery.generation()
+		err = fn()
+	}
+
+	return err
+}
+
+// isTransportError reports whether err means the command did not complete
+// because the connection to the device was lost. Executors report non-zero
+// exit statuses in results, so their errors are transport errors, apart from
+// the ones of fake and replayed executors.
+func isTransportError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var exitErr *ExitError
+	var replayed *ReplayedError
+	if errors.As(err, &exitErr) || errors.As(err, &replayed) {
+		return false
+	}
+
+	return !errors.Is(err, ErrUnscripted) && !errors.Is(err, ErrNotRecorded)
+}
+
+// generation returns the number of completed recoveries
+func (r *recoveryState) generation() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.recoveries
+}
+
+// recoverDevice waits for the device to come back and restores the state set
+// up by initialize. Concurrent callers wait for a single recovery.
+// Parameters:
+//   - ctx: context controlling the recovery
+//   - seen: generation observed before the failed operation started
+//
+// Returns:
+//   - error: nil once recovered, otherwise the reason the device did not come back
+func (d *Driver) recoverDevice(ctx context.Context, seen int) error {
+	r := d.recovery
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Another command recovered the device since the operation started
+	if r.recoveries != seen {
+		return nil
+	}
+
+	ctx = withoutRecovery(ctx)
+
+	if err := d.waitDevice(ctx, r.policy.WaitTimeout); err != nil {
+		return err
+	}
+
+	// Forwardings do not survive the transport, the next request creates a new one
+	d.forwards.setU2Forward(PortForward{})
+
+	d.startUiAutomator(ctx)
+
+	if d.config.SwitchIME {
+		d.SwitchAdbKeyboardContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.recoveries++
+
+	return nil
+}
+
+// waitDevice waits until the connected device is ready
+// Parameters:
+//   - ctx: context controlling the wait
+//   - timeout: maximum time to wait
+//
+// Returns:
+//   - error: nil once the device is ready, otherwise the error of the last
+//     lookup, e.g. ErrDeviceNotFound or ErrDeviceOffline
+func (d *Driver) waitDevice(ctx context.Context, timeout time.Duration) error {
+	if d.os == "android" {
+		return nil
+	}
+
+	_, err := d.waitSerial(ctx, d.device, timeout)
+	return err
+}
+
+// waitSerial waits until the device with the given serial is listed as ready
+// Parameters:
+//   - ctx: context controlling the wait
+//   - serial: serial of the device
+//   - timeout: maximum time to wait
+//
+// Returns:
+//   - DeviceInfo: the device once ready
+//   - error: nil once the device is ready, otherwise the error of the last
+//     lookup, e.g. ErrDeviceNotFound or ErrDeviceOffline
+func (d *Driver) waitSerial(ctx context.Context, serial string, timeout time.Duration) (DeviceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		devices, err := d.DevicesContext(ctx)
+		if err == nil {
+			var info DeviceInfo
+			info, err = selectDevice(devices, MatchSerial(serial))
+			if err == nil {
+				return info, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return DeviceInfo{}, err
+		case <-time.After(d.config.PollInterval):
+		}
+	}
+}
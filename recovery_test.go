@@ -0,0 +1,157 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// errTransport is a transport failure of a fake device
+var errTransport = errors.New("device offline")
+
+// newRecoveryDriver creates a driver recovering a device listed by the fake,
+// within the given retry budget
+func newRecoveryDriver(t *testing.T, fake *fakeExecutor, retries int) *Driver {
+	t.Helper()
+
+	fake.On(`^adb devices -l$`, "List of devices attached\nemulator-5554 device product:sdk model:Pixel\n")
+
+	cfg := DefaultConfig()
+	cfg.SwitchIME = false
+	d := New(
+		WithExecutor(fake),
+		WithConfig(cfg),
+		WithRecovery(RecoveryPolicy{Retries: retries, WaitTimeout: time.Second, Backoff: time.Millisecond}),
+	)
+	d.device = "emulator-5554"
+
+	return d
+}
+
+func TestWithRecovery(t *testing.T) {
+	tests := []struct {
+		name       string
+		cmd        []string
+		script     func(fake *fakeExecutor)
+		retries    int
+		wantRuns   int
+		wantErr    error
+		wantListed bool
+	}{
+		{
+			name: "idempotent command retried",
+			cmd:  []string{"getprop", "ro.product.model"},
+			script: func(fake *fakeExecutor) {
+				fake.OnError(`^getprop`, errTransport).Once().On(`^getprop`, "Pixel\n")
+			},
+			retries:    2,
+			wantRuns:   2,
+			wantListed: true,
+		},
+		{
+			name:       "idempotent command within the budget",
+			cmd:        []string{"getprop", "ro.product.model"},
+			script:     func(fake *fakeExecutor) { fake.OnError(`^getprop`, errTransport) },
+			retries:    2,
+			wantRuns:   3,
+			wantErr:    errTransport,
+			wantListed: true,
+		},
+		{
+			name:       "input not retried",
+			cmd:        []string{"input", "tap", "1", "2"},
+			script:     func(fake *fakeExecutor) { fake.OnError(`^input`, errTransport) },
+			retries:    2,
+			wantRuns:   1,
+			wantErr:    errTransport,
+			wantListed: true,
+		},
+		{
+			name:     "exit status not recovered",
+			cmd:      []string{"getprop", "ro.product.model"},
+			script:   func(fake *fakeExecutor) { fake.OnResult(`^getprop`, Result{ExitCode: 1}) },
+			retries:  2,
+			wantRuns: 1,
+			wantErr:  &ExitError{},
+		},
+		{
+			name:     "unscripted command not recovered",
+			cmd:      []string{"getprop", "ro.product.model"},
+			script:   func(fake *fakeExecutor) {},
+			retries:  2,
+			wantRuns: 1,
+			wantErr:  ErrUnscripted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeExecutor()
+			tt.script(fake)
+			d := newRecoveryDriver(t, fake, tt.retries)
+
+			_, err := d.RunResult(context.Background(), tt.cmd[0], tt.cmd[1:]...)
+
+			var exitErr *ExitError
+			switch want := tt.wantErr.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("RunResult() error = %v", err)
+				}
+			case *ExitError:
+				if !errors.As(err, &exitErr) {
+					t.Fatalf("RunResult() error = %v, want *ExitError", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("RunResult() error = %v, want %v", err, want)
+				}
+			}
+
+			cmdline := Cmd(tt.cmd[0], tt.cmd[1:]...).String()
+			if n := countCalls(fake, cmdline); n != tt.wantRuns {
+				t.Errorf("%q ran %d times, want %d", cmdline, n, tt.wantRuns)
+			}
+			if listed := countCalls(fake, "adb devices -l") > 0; listed != tt.wantListed {
+				t.Errorf("waited for the device = %v, want %v", listed, tt.wantListed)
+			}
+		})
+	}
+}
+
+func TestWithRecoveryDeviceGone(t *testing.T) {
+	fake := newFakeExecutor().OnError(`^getprop`, errTransport)
+	cfg := DefaultConfig()
+	cfg.SwitchIME = false
+	cfg.PollInterval = 10 * time.Millisecond
+	d := New(
+		WithExecutor(fake.On(`^adb devices -l$`, "List of devices attached\n")),
+		WithConfig(cfg),
+		WithRecovery(RecoveryPolicy{Retries: 2, WaitTimeout: 50 * time.Millisecond}),
+	)
+	d.device = "emulator-5554"
+
+	// The command fails with its own error, without retries
+	if _, err := d.RunResult(context.Background(), "getprop"); !errors.Is(err, errTransport) {
+		t.Errorf("RunResult() error = %v, want the transport error", err)
+	}
+	if n := countCalls(fake, "getprop"); n != 1 {
+		t.Errorf("getprop ran %d times, want once", n)
+	}
+	if d.recovery.generation() != 0 {
+		t.Error("the device was recovered while gone")
+	}
+}
+
+func TestWithRecoveryDisabled(t *testing.T) {
+	fake := newFakeExecutor().OnError(`^getprop`, errTransport)
+	d := newFakeDriver(t, fake)
+
+	if _, err := d.RunResult(context.Background(), "getprop"); !errors.Is(err, errTransport) {
+		t.Errorf("RunResult() error = %v, want the transport error", err)
+	}
+	if calls := fake.Calls(); len(calls) != 1 {
+		t.Errorf("calls = %q, want getprop only", calls)
+	}
+}
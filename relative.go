@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"math"
+	"sort"
+
+	"github.com/beevik/etree"
+)
+
+// Parent returns the parent node of the element
+// Returns:
+//   - Element: the parent, nil for the top node
+func (d *element) Parent() Element {
+	d.attach()
+
+	if d.element == nil {
+		return nil
+	}
+
+	parent := d.element.Parent()
+	if parent == nil || !isNode(parent) {
+		return nil
+	}
+
+	return d.relative(parent)
+}
+
+// Children returns the child nodes of the element
+// Returns:
+//   - []Element: the children in document order, nil if none
+func (d *element) Children() []Element {
+	d.attach()
+
+	if d.element == nil {
+		return nil
+	}
+
+	return d.relatives(childNodes(d.element), nil)
+}
+
+// Siblings returns the other child nodes of the parent of the element
+// Returns:
+//   - []Element: the siblings in document order, nil if none
+func (d *element) Siblings() []Element {
+	d.attach()
+
+	if d.element == nil || d.element.Parent() == nil {
+		return nil
+	}
+
+	return d.relatives(childNodes(d.element.Parent()), d.element)
+}
+
+// Child returns the first child node located by a Locator.
+// Use FindElements to search all the descendants.
+// Parameters:
+//   - locator: a By, a Query or an XPath
+//
+// Returns:
+//   - Element: the child, nil if none is located
+func (d *element) Child(locator Locator) Element {
+	d.attach()
+
+	if d.element == nil || isEmptyLocator(locator) {
+		return nil
+	}
+
+	var cache matchCache
+	for _, child := range childNodes(d.element) {
+		if locator.match(child, &cache) {
+			return d.relative(child)
+		}
+	}
+
+	return nil
+}
+
+// Below returns the closest node located by a Locator under the element,
+// overlapping it horizontally, e.g. the input under a label
+// Parameters:
+//   - locator: a By, a Query or an XPath
+//
+// Returns:
+//   - Element: the node, nil if none is located
+func (d *element) Below(locator Locator) Element {
+	return d.closest(locator, func(self, other *Bounds) (float64, bool) {
+		if other.LTY < self.RBY || !overlaps(self.LTX, self.RBX, other.LTX, other.RBX) {
+			return 0, false
+		}
+		return float64(other.LTY - self.RBY), true
+	})
+}
+
+// RightOf returns the closest node located by a Locator on the right of the
+// element, overlapping it vertically, e.g. the input next to a label
+// Parameters:
+//   - locator: a By, a Query or an XPath
+//
+// Returns:
+//   - Element: the node, nil if none is located
+func (d *element) RightOf(locator Locator) Element {
+	return d.closest(locator, func(self, other *Bounds) (float64, bool) {
+		if other.LTX < self.RBX || !overlaps(self.LTY, self.RBY, other.LTY, other.RBY) {
+			return 0, false
+		}
+		return float64(other.LTX - self.RBX), true
+	})
+}
+
+// Near returns the closest node located by a Locator within a distance of the
+// element, measured between the edges of their bounds. Ancestors and
+// descendants of the element are left out.
+// Parameters:
+//   - locator: a By, a Query or an XPath
+//   - radius: maximum distance in pixels
+//
+// Returns:
+//   - Element: the node, nil if none is located
+func (d *element) Near(locator Locator, radius int) Element {
+	return d.closest(locator, func(self, other *Bounds) (float64, bool) {
+		dx := max(other.LTX-self.RBX, self.LTX-other.RBX, 0)
+		dy := max(other.LTY-self.RBY, self.LTY-other.RBY, 0)
+		distance := math.Hypot(float64(dx), float64(dy))
+		return distance, distance <= float64(radius)
+	})
+}
+
+// closest returns the located node of the whole screen with the smallest
+// distance to the element, distance reporting false for nodes out of reach
+func (d *element) closest(locator Locator, distance func(self, other *Bounds) (float64, bool)) Element {
+	d.attach()
+
+	if d.element == nil || isEmptyLocator(locator) {
+		return nil
+	}
+
+	self := nodeBounds(d.element)
+
+	type candidate struct {
+		node     *etree.Element
+		distance float64
+	}
+	var candidates []candidate
+	var cache matchCache
+
+	var walk func(parent *etree.Element)
+	walk = func(parent *etree.Element) {
+		for _, child := range parent.ChildElements() {
+			if child == d.element {
+				// Descendants are inside the element, not next to it
+				continue
+			}
+			if isNode(child) && !isAncestor(child, d.element) && locator.match(child, &cache) {
+				if dist, ok := distance(self, nodeBounds(child)); ok {
+					candidates = append(candidates, candidate{node: child, distance: dist})
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(treeRoot(d.element))
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Stable, so that the first node in document order wins ties
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	return d.relative(candidates[0].node)
+}
+
+// relative creates the element of another node of the same hierarchy
+func (d *element) relative(node *etree.Element) Element {
+	return d.newElement(treeRoot(node), node)
+}
+
+// relatives creates the elements of nodes of the same hierarchy, leaving out skip
+func (d *element) relatives(nodes []*etree.Element, skip *etree.Element) []Element {
+	var es []Element
+	for _, node := range nodes {
+		if node != skip {
+			es = append(es, d.relative(node))
+		}
+	}
+	return es
+}
+
+// childNodes returns the child hierarchy nodes of an XML element
+func childNodes(parent *etree.Element) []*etree.Element {
+	var nodes []*etree.Element
+	for _, child := range parent.ChildElements() {
+		if isNode(child) {
+			nodes = append(nodes, child)
+		}
+	}
+	return nodes
+}
+
+// treeRoot returns the top XML element of the hierarchy holding node
+func treeRoot(node *etree.Element) *etree.Element {
+	for node.Parent() != nil {
+		node = node.Parent()
+	}
+	return node
+}
+
+// isAncestor reports whether node is an ancestor of el
+func isAncestor(node, el *etree.Element) bool {
+	for parent := el.Parent(); parent != nil; parent = parent.Parent() {
+		if parent == node {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether the ranges [a1, a2] and [b1, b2] overlap
+func overlaps(a1, a2, b1, b2 int) bool {
+	return a1 < b2 && b1 < a2
+}
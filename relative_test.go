@@ -0,0 +1,81 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+// relativeHierarchy is a form with known bounds: a label with an input on its
+// right and a hint under it, above two buttons
+const relativeHierarchy = `<?xml version="1.0" encoding="UTF-8"?>
+<hierarchy rotation="0">
+  <node index="0" text="" resource-id="app:id/root" class="android.widget.FrameLayout" bounds="[0,0][1000,1000]">
+    <node index="0" text="Name" resource-id="app:id/label" class="android.widget.TextView" bounds="[0,0][300,100]"/>
+    <node index="1" text="" resource-id="app:id/input" class="android.widget.EditText" bounds="[320,0][1000,100]"/>
+    <node index="2" text="Required" resource-id="app:id/hint" class="android.widget.TextView" bounds="[0,150][300,200]"/>
+    <node index="3" text="" resource-id="app:id/buttons" class="android.widget.LinearLayout" bounds="[0,800][1000,1000]">
+      <node index="0" text="OK" resource-id="app:id/ok" class="android.widget.Button" bounds="[0,800][500,1000]"/>
+      <node index="1" text="Cancel" resource-id="app:id/cancel" class="android.widget.Button" bounds="[500,800][1000,1000]"/>
+    </node>
+  </node>
+</hierarchy>`
+
+func TestRelatives(t *testing.T) {
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, relativeHierarchy)
+
+	// one turns a single relative into a list
+	one := func(el Element) []Element {
+		if el == nil {
+			return nil
+		}
+		return []Element{el}
+	}
+	button := HasClass(Eq("android.widget.Button"))
+	textView := HasClass(Eq("android.widget.TextView"))
+
+	tests := []struct {
+		name     string
+		from     string
+		relative func(el Element) []Element
+		want     []string
+	}{
+		{"parent", "label", func(el Element) []Element { return one(el.Parent()) }, []string{"root"}},
+		{"parent of the top node", "root", func(el Element) []Element { return one(el.Parent()) }, nil},
+		{"children", "buttons", Element.Children, []string{"ok", "cancel"}},
+		{"no children", "label", Element.Children, nil},
+		{"siblings", "label", Element.Siblings, []string{"input", "hint", "buttons"}},
+		{"siblings of the top node", "root", Element.Siblings, nil},
+		{"child", "root", func(el Element) []Element { return one(el.Child(textView)) }, []string{"label"}},
+		{"child is not a grandchild", "root", func(el Element) []Element { return one(el.Child(button)) }, nil},
+		{"below", "label", func(el Element) []Element { return one(el.Below(textView)) }, []string{"hint"}},
+		{"below overlapping only", "label", func(el Element) []Element { return one(el.Below(button)) }, []string{"ok"}},
+		{"nothing below", "ok", func(el Element) []Element { return one(el.Below(HasText(Eq("")))) }, nil},
+		{"right of", "label", func(el Element) []Element { return one(el.RightOf(HasText(Eq("")))) }, []string{"input"}},
+		{"right of overlapping only", "label", func(el Element) []Element { return one(el.RightOf(textView)) }, nil},
+		{"near", "label", func(el Element) []Element { return one(el.Near(HasText(Eq("Required")), 60)) }, []string{"hint"}},
+		{"near out of reach", "label", func(el Element) []Element { return one(el.Near(HasText(Eq("Required")), 40)) }, nil},
+		{"near leaves ancestors out", "label", func(el Element) []Element {
+			return one(el.Near(HasClass(Suffix("Layout")), 1000))
+		}, []string{"buttons"}},
+		{"near leaves descendants out", "buttons", func(el Element) []Element { return one(el.Near(button, 1000)) }, nil},
+		{"empty locator", "label", func(el Element) []Element { return one(el.Below(Query{})) }, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := doc.FindElement(HasResourceID(Eq("app:id/" + tt.from)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, el := range tt.relative(from) {
+				got = append(got, el.ResourceID()[len("app:id/"):])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
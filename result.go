@@ -0,0 +1,47 @@
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Result holds the outcome of a command executed on the device
+type Result struct {
+	Cmd      string        // command line that was executed
+	Stdout   string        // standard output of the command
+	Stderr   string        // standard error of the command, empty if the transport merges it into Stdout
+	ExitCode int           // exit status of the command
+	Duration time.Duration // time spent running the command
+}
+
+// Output returns stdout followed by stderr, with surrounding whitespace trimmed
+func (r *Result) Output() string {
+	return strings.TrimSpace(r.Stdout + r.Stderr)
+}
+
+// Success reports whether the command exited with status 0
+func (r *Result) Success() bool {
+	return r.ExitCode == 0
+}
+
+// ExitError is returned when a command exits with a non-zero status.
+// Use errors.As to retrieve the exit code and the output of the failing command.
+type ExitError struct {
+	Cmd    string  // command line that failed
+	Result *Result // full result of the command
+}
+
+// Error implements the error interface
+func (e *ExitError) Error() string {
+	msg := fmt.Sprintf("command %q exited with status %d", e.Cmd, e.Result.ExitCode)
+	if stderr := strings.TrimSpace(e.Result.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// ExitCode returns the exit status of the failing command
+func (e *ExitError) ExitCode() int {
+	return e.Result.ExitCode
+}
@@ -0,0 +1,80 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// RPCCaller is implemented by executors that also carry the JSON-RPC requests
+// sent to the UiAutomator server, so that they can be faked or recorded.
+// Executors without it leave the requests to a plain HTTP client.
+type RPCCaller interface {
+	// CallRPC posts a JSON-RPC request body to url and returns the response body
+	CallRPC(ctx context.Context, url string, request []byte) ([]byte, error)
+}
+
+// sendRPC posts a JSON-RPC request body through the executor when it supports it,
+// retrying idempotent methods when the device drops
+// Parameters:
+//   - ctx: context controlling the request lifetime
+//   - url: JSON-RPC endpoint of the UiAutomator server
+//   - request: JSON-RPC request body
+//
+// Returns:
+//   - []byte: the response body
+//   - error: nil if successful, otherwise error details
+func (d *Driver) sendRPC(ctx context.Context, url string, request []byte) ([]byte, error) {
+	var body []byte
+	err := d.withRecovery(ctx, idempotentMethods[rpcMethod(request)], func() (err error) {
+		if caller, ok := d.executor.(RPCCaller); ok {
+			body, err = caller.CallRPC(ctx, url, request)
+		} else {
+			body, err = httpRPC(ctx, d.http, url, request)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// httpRPC posts a JSON-RPC request body over HTTP and returns the response body.
+// A nil client uses the default client of Request.
+func httpRPC(ctx context.Context, client *http.Client, url string, request []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = defaultClient()
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// rpcMethod extracts the method name of a JSON-RPC request body
+func rpcMethod(request []byte) string {
+	var req struct {
+		Method string `json:"method"`
+	}
+	json.Unmarshal(request, &req)
+	return req.Method
+}
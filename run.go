@@ -1,9 +1,11 @@
 package driver
 
 import (
-	"fmt"
+	"bytes"
+	"context"
+	"errors"
 	"os/exec"
-	"strings"
+	"time"
 )
 
 // pcOnlyCommands is a map that defines commands only executable on a PC.
@@ -20,6 +22,10 @@ var pcOnlyCommands = map[string]string{
 }
 
 // Run executes an adb command.
+// Arguments are passed literally, see RunResult for the quoting rules.
+// Commands are run by the driver Executor. By default on PC, shell commands are
+// sent to the ADB server through its wire protocol, while commands in
+// pcOnlyCommands still go through the adb binary.
 // Parameters:
 //   - cmd: The command to execute.
 //   - args: Additional arguments for the command.
@@ -28,27 +34,177 @@ var pcOnlyCommands = map[string]string{
 //   - string: The output of the command.
 //   - error: An error object if the command execution fails.
 func (d *Driver) Run(cmd string, args ...string) (string, error) {
-	var argv []string
-
-	if d.os != "android" {
-		if _, exists := pcOnlyCommands[cmd]; exists {
-			argv = append(argv, []string{"adb", "-s", d.device, cmd}...)
-			argv = append(argv, args...)
-		} else {
-			newArgs := fmt.Sprintf(`"%s %s"`, cmd, strings.Join(args, " "))
-			argv = append(argv, []string{"adb", "-s", d.device, "shell", newArgs}...)
+	return d.RunContext(context.Background(), cmd, args...)
+}
+
+// RunContext executes an adb command like Run, but stops it as soon as ctx is done.
+// Parameters:
+//   - ctx: Context controlling the command lifetime.
+//   - cmd: The command to execute.
+//   - args: Additional arguments for the command.
+//
+// Returns:
+//   - string: The output of the command, stdout followed by stderr.
+//   - error: An *ExitError if the command exits with a non-zero status,
+//     ctx.Err() if it was cancelled, or the transport error.
+func (d *Driver) RunContext(ctx context.Context, cmd string, args ...string) (string, error) {
+	res, err := d.RunResult(ctx, cmd, args...)
+	if res == nil {
+		return "", err
+	}
+
+	if err != nil {
+		return res.Stdout + res.Stderr, err
+	}
+
+	return res.Output(), nil
+}
+
+// RunResult executes an adb command and returns its structured result.
+// Every argument is quoted for the device shell, so text containing spaces,
+// quotes, "$" or ";" reaches the command unchanged. Use Pipe to build pipelines.
+// Parameters:
+//   - ctx: Context controlling the command lifetime.
+//   - cmd: The command to execute.
+//   - args: Additional arguments for the command.
+//
+// Returns:
+//   - *Result: stdout, stderr, exit status and duration of the command,
+//     also returned along with an *ExitError.
+//   - error: An *ExitError if the command exits with a non-zero status,
+//     ctx.Err() if it was cancelled, or the transport error.
+func (d *Driver) RunResult(ctx context.Context, cmd string, args ...string) (*Result, error) {
+	var res *Result
+	err := d.withRecovery(ctx, idempotentCommands[cmd], func() (err error) {
+		if _, exists := pcOnlyCommands[cmd]; exists && d.os != "android" {
+			argv := append([]string{cmd}, args...)
+			res, err = d.execute(ctx, "adb "+ShellJoin(argv), func() (*Result, error) {
+				return d.executor.Host(ctx, d.device, argv...)
+			})
+			return err
 		}
-	} else {
-		cmd = strings.Join(append([]string{cmd}, args...), " ")
-		argv = append(argv, "-c", cmd)
+
+		res, err = d.shellResult(ctx, Cmd(cmd, args...).String())
+		return err
+	})
+
+	return res, err
+}
+
+// Pipe executes commands on the device, connecting the output of each command
+// to the input of the next one, like "cmd1 | cmd2" in a shell.
+// Parameters:
+//   - cmds: The commands of the pipeline.
+//
+// Returns:
+//   - string: The output of the last command.
+//   - error: An *ExitError if the last command exits with a non-zero status.
+func (d *Driver) Pipe(cmds ...Command) (string, error) {
+	return d.PipeContext(context.Background(), cmds...)
+}
+
+// PipeContext executes a pipeline like Pipe, but stops it as soon as ctx is done.
+// Parameters:
+//   - ctx: Context controlling the pipeline lifetime.
+//   - cmds: The commands of the pipeline.
+//
+// Returns:
+//   - string: The output of the last command.
+//   - error: An *ExitError if the last command exits with a non-zero status.
+func (d *Driver) PipeContext(ctx context.Context, cmds ...Command) (string, error) {
+	res, err := d.PipeResult(ctx, cmds...)
+	if res == nil {
+		return "", err
+	}
+
+	if err != nil {
+		return res.Stdout + res.Stderr, err
 	}
 
-	command := exec.Command(d.shell, argv...)
-	output, err := command.CombinedOutput()
+	return res.Output(), nil
+}
+
+// PipeResult executes a pipeline and returns its structured result.
+// Parameters:
+//   - ctx: Context controlling the pipeline lifetime.
+//   - cmds: The commands of the pipeline.
+//
+// Returns:
+//   - *Result: Output and exit status of the pipeline.
+//   - error: An *ExitError if the last command exits with a non-zero status.
+func (d *Driver) PipeResult(ctx context.Context, cmds ...Command) (*Result, error) {
+	idempotent := true
+	for _, c := range cmds {
+		idempotent = idempotent && idempotentCommands[c.Name]
+	}
+
+	var res *Result
+	err := d.withRecovery(ctx, idempotent, func() (err error) {
+		res, err = d.shellResult(ctx, pipeline(cmds))
+		return err
+	})
+
+	return res, err
+}
+
+// shellResult runs an already quoted command line in the device shell
+func (d *Driver) shellResult(ctx context.Context, cmdline string) (*Result, error) {
+	return d.execute(ctx, cmdline, func() (*Result, error) {
+		return d.executor.Shell(ctx, d.device, cmdline)
+	})
+}
+
+// runOneshot runs a command line in a dedicated shell, bypassing the session.
+// It is meant for long-running commands that would block the session.
+func (d *Driver) runOneshot(ctx context.Context, cmdline string) (*Result, error) {
+	return d.shellResult(withOneshot(ctx), cmdline)
+}
+
+// execute runs fn and completes its result with the command line, the duration
+// and an *ExitError for non-zero exit statuses
+func (d *Driver) execute(ctx context.Context, cmdline string, fn func() (*Result, error)) (*Result, error) {
+	start := time.Now()
 
+	res, err := fn()
 	if err != nil {
-		return string(output), err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	res.Cmd = cmdline
+	res.Duration = time.Since(start)
+
+	if res.ExitCode != 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return res, &ExitError{Cmd: cmdline, Result: res}
+	}
+
+	return res, nil
+}
+
+// runLocal executes a program on the local machine and returns its structured result.
+// A non-zero exit status is reported in the result, not as an error.
+func runLocal(ctx context.Context, name string, args ...string) (*Result, error) {
+	var stdout, stderr bytes.Buffer
+
+	command := exec.CommandContext(ctx, name, args...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, err
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: command.ProcessState.ExitCode(),
+	}, nil
 }
@@ -0,0 +1,269 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errSessionUnavailable is returned when no shell session could be opened
+var errSessionUnavailable = errors.New("shell session unavailable")
+
+// sessionCloseTimeout bounds the wait for a closed session shell to exit
+const sessionCloseTimeout = time.Second
+
+// shellSession is a long-lived device shell that runs commands one after another.
+// Each command runs in a subshell followed by sentinel lines carrying its stderr
+// and exit status, so a short command costs a round trip instead of a new adb
+// connection, and cannot alter or exit the session shell.
+// If the shell dies, the next command transparently opens a new one.
+type shellSession struct {
+	open    func(ctx context.Context) (io.ReadWriteCloser, error) // opens a new raw shell stream
+	id      string                                                // unique id used in sentinels
+	errPath string                                                // device file collecting stderr
+
+	mu     sync.Mutex
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	seq    int
+}
+
+// newShellSession creates a session, the shell itself is opened on first use
+// Parameters:
+//   - open: function opening a raw shell stream on the device
+//   - root: device working directory receiving the stderr file
+//
+// Returns:
+//   - *shellSession: the session
+func newShellSession(open func(ctx context.Context) (io.ReadWriteCloser, error), root string) *shellSession {
+	id := strconv.FormatUint(rand.Uint64(), 36)
+
+	return &shellSession{
+		open:    open,
+		id:      id,
+		errPath: root + "/.driver-" + id + ".err",
+	}
+}
+
+// run executes a command line in the session shell
+// Parameters:
+//   - ctx: context controlling the command, cancelling it kills the session
+//   - cmdline: quoted command line to execute
+//
+// Returns:
+//   - *Result: output and exit status of the command
+//   - error: errSessionUnavailable if no shell could be opened, or the I/O error
+func (s *shellSession) run(ctx context.Context, cmdline string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if s.conn == nil {
+			conn, err := s.open(ctx)
+			if err != nil {
+				return nil, errSessionUnavailable
+			}
+			s.conn = conn
+			s.reader = bufio.NewReader(conn)
+		}
+
+		res, started, err := s.roundTrip(ctx, cmdline)
+		if err == nil {
+			return res, nil
+		}
+
+		s.reset()
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// The shell died before the command produced anything, it is safe to retry once
+		if started || attempt > 0 {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip writes one framed command and reads its framed output.
+// started reports whether any output of the command was received.
+func (s *shellSession) roundTrip(ctx context.Context, cmdline string) (res *Result, started bool, err error) {
+	stop := context.AfterFunc(ctx, func() {
+		s.conn.Close()
+	})
+	defer stop()
+
+	s.seq++
+	marker := fmt.Sprintf("__DRIVER_%s_%d__", s.id, s.seq)
+
+	script := fmt.Sprintf("( %s\n) </dev/null 2>%s; __rc=$?; printf '\\n%%s\\n' %s; cat %s 2>/dev/null; printf '\\n%%s %%d\\n' %s \"$__rc\"\n",
+		cmdline, s.errPath, marker, s.errPath, marker)
+
+	if _, err := io.WriteString(s.conn, script); err != nil {
+		return nil, false, err
+	}
+
+	stdout, err := s.readUntil(marker+"\n", &started)
+	if err != nil {
+		return nil, started, err
+	}
+
+	var trailer string
+	stderr, err := s.readUntilPrefix(marker+" ", &trailer)
+	if err != nil {
+		return nil, true, err
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(trailer))
+	if err != nil {
+		return nil, true, fmt.Errorf("shell session: invalid exit status %q", trailer)
+	}
+
+	return &Result{Stdout: stdout, Stderr: stderr, ExitCode: code}, true, nil
+}
+
+// readUntil reads lines until one equals sentinel and returns what came before it,
+// without the newline printed in front of the sentinel
+func (s *shellSession) readUntil(sentinel string, started *bool) (string, error) {
+	var out strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if len(line) > 0 {
+			*started = true
+		}
+		if line == sentinel {
+			return strings.TrimSuffix(out.String(), "\n"), nil
+		}
+		out.WriteString(line)
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// readUntilPrefix reads lines until one starts with prefix, stores the rest of that
+// line in trailer and returns what came before it
+func (s *shellSession) readUntilPrefix(prefix string, trailer *string) (string, error) {
+	var out strings.Builder
+	for {
+		line, err := s.reader.ReadString('\n')
+		if strings.HasPrefix(line, prefix) && strings.HasSuffix(line, "\n") {
+			*trailer = strings.TrimPrefix(line, prefix)
+			return strings.TrimSuffix(out.String(), "\n"), nil
+		}
+		out.WriteString(line)
+
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// reset closes the current shell, the next command opens a new one
+func (s *shellSession) reset() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+		s.reader = nil
+	}
+}
+
+// Close removes the stderr file and closes the shell
+func (s *shellSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	io.WriteString(s.conn, "rm -f "+s.errPath+"; exit\n")
+
+	// Let the shell exit by itself, closing it first may kill it before it removes the file
+	reader := s.reader
+	exited := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, reader)
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(sessionCloseTimeout):
+	}
+
+	s.reset()
+
+	return nil
+}
+
+// localShell is a shell process on the local machine, used when running on Android
+type localShell struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+// openLocalShell starts a local shell reading commands from stdin
+func openLocalShell(shell string) (io.ReadWriteCloser, error) {
+	cmd := exec.Command(shell)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &localShell{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+// Read reads from the shell stdout
+func (l *localShell) Read(p []byte) (int, error) {
+	return l.stdout.Read(p)
+}
+
+// Write writes to the shell stdin
+func (l *localShell) Write(p []byte) (int, error) {
+	return l.stdin.Write(p)
+}
+
+// Close kills the shell process
+func (l *localShell) Close() error {
+	l.stdin.Close()
+	l.cmd.Process.Kill()
+	return l.cmd.Wait()
+}
+
+// openShell opens a raw shell on the device reading commands from its stdin.
+// The returned stream is not bound to ctx once opened.
+func (c *adbClient) openShell(ctx context.Context, serial string) (io.ReadWriteCloser, error) {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.send("exec:sh"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.stop()
+
+	return conn, nil
+}
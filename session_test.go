@@ -0,0 +1,144 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newLocalSession creates a session over local sh processes, counting the
+// shells it opens
+func newLocalSession(t *testing.T) (*shellSession, *atomic.Int32) {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("the session runs sh")
+	}
+
+	opened := new(atomic.Int32)
+	s := newShellSession(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		opened.Add(1)
+		return openLocalShell("sh")
+	}, t.TempDir())
+	t.Cleanup(func() { s.Close() })
+
+	return s, opened
+}
+
+func TestShellSessionFraming(t *testing.T) {
+	s, opened := newLocalSession(t)
+
+	tests := []struct {
+		name    string
+		cmdline string
+		want    Result
+	}{
+		{"stdout", "echo hi", Result{Stdout: "hi\n"}},
+		{"no final newline", "printf hi", Result{Stdout: "hi"}},
+		{"empty lines", "printf 'a\\n\\n\\nb\\n\\n'", Result{Stdout: "a\n\n\nb\n\n"}},
+		{"stderr and status", "echo out; echo err >&2; exit 3", Result{Stdout: "out\n", Stderr: "err\n", ExitCode: 3}},
+		{"stderr without newline", "printf err >&2; false", Result{Stderr: "err", ExitCode: 1}},
+		{"stderr of the last command only", "true", Result{}},
+		{"exit does not end the session", "exit 7", Result{ExitCode: 7}},
+		{"stdin is closed", "cat", Result{}},
+		{"sentinel lookalike", "echo __DRIVER_x_1__", Result{Stdout: "__DRIVER_x_1__\n"}},
+		{"variables are kept", "__rc=5; echo $__rc", Result{Stdout: "5\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := s.run(context.Background(), tt.cmdline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *res != tt.want {
+				t.Errorf("run(%q) = %+v, want %+v", tt.cmdline, *res, tt.want)
+			}
+		})
+	}
+
+	if n := opened.Load(); n != 1 {
+		t.Errorf("opened %d shells, want a single one", n)
+	}
+}
+
+func TestShellSessionRespawn(t *testing.T) {
+	s, opened := newLocalSession(t)
+	ctx := context.Background()
+
+	if _, err := s.run(ctx, "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A shell dying before the command starts is replaced, the command is run once more
+	s.conn.Close()
+	if res, err := s.run(ctx, "echo again"); err != nil || res.Stdout != "again\n" {
+		t.Fatalf("run() after the shell died = %v, %v", res, err)
+	}
+	if n := opened.Load(); n != 2 {
+		t.Errorf("opened %d shells, want 2", n)
+	}
+
+	// A command killing its shell is run on a new shell once, then fails
+	if _, err := s.run(ctx, "kill -9 $$"); err == nil {
+		t.Error("run() killing the shell succeeded")
+	}
+	if n := opened.Load(); n != 3 {
+		t.Errorf("opened %d shells, want 3", n)
+	}
+
+	if res, err := s.run(ctx, "echo back"); err != nil || res.Stdout != "back\n" {
+		t.Errorf("run() after the failure = %v, %v", res, err)
+	}
+}
+
+func TestShellSessionCanceled(t *testing.T) {
+	s, opened := newLocalSession(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := s.run(ctx, "sleep 10"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("run() error = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The killed shell is replaced by the next command
+	if res, err := s.run(context.Background(), "echo ok"); err != nil || res.Stdout != "ok\n" {
+		t.Errorf("run() after the cancellation = %v, %v", res, err)
+	}
+	if n := opened.Load(); n != 2 {
+		t.Errorf("opened %d shells, want 2", n)
+	}
+}
+
+func TestShellSessionClose(t *testing.T) {
+	s, _ := newLocalSession(t)
+
+	if _, err := s.run(context.Background(), "echo err >&2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.errPath); err != nil {
+		t.Fatalf("stderr file: %v", err)
+	}
+
+	// The shell removes the file before exiting
+	s.Close()
+	if _, err := os.Stat(s.errPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stderr file left after Close: %v", err)
+	}
+}
+
+func TestShellSessionUnavailable(t *testing.T) {
+	s := newShellSession(func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return nil, errors.New("device offline")
+	}, "/data/local/tmp")
+
+	if _, err := s.run(context.Background(), "true"); !errors.Is(err, errSessionUnavailable) {
+		t.Errorf("run() error = %v, want errSessionUnavailable", err)
+	}
+}
@@ -1,7 +1,8 @@
 package driver
 
 import (
-	"fmt"
+	"context"
+	"strconv"
 )
 
 type Direction int
@@ -17,23 +18,35 @@ const (
 // Parameters:
 //   - direction: swipe direction, one of SWIPE_UP/SWIPE_DOWN/SWIPE_LEFT/SWIPE_RIGHT
 func (d *Driver) Swipe(direction Direction) {
-	w, h := d.GetResolution()
+	d.SwipeContext(context.Background(), direction)
+}
+
+// SwipeContext performs a full screen swipe like Swipe, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the command lifetime
+//   - direction: swipe direction, one of SWIPE_UP/SWIPE_DOWN/SWIPE_LEFT/SWIPE_RIGHT
+//
+// Returns:
+//   - error: error if the swipe could not be sent
+func (d *Driver) SwipeContext(ctx context.Context, direction Direction) error {
+	w, h := d.GetResolutionContext(ctx)
 	bounds := &Bounds{
 		LTX: 0,
 		LTY: 0,
 		RBX: w,
 		RBY: h,
 	}
-	d.swipeInRange(bounds, direction, 0, 0.5)
+	return d.swipeInRange(ctx, bounds, direction, 0, 0.5)
 }
 
 // SwipeInRange performs a swipe gesture within a specified boundary
 // Parameters:
+//   - ctx: context controlling the command lifetime
 //   - bounds: boundary coordinates for the swipe area
 //   - direction: swipe direction, one of SWIPE_UP/SWIPE_DOWN/SWIPE_LEFT/SWIPE_RIGHT
 //   - duration: swipe duration in milliseconds, 0 means using default value 40ms
 //   - ratio: swipe distance ratio relative to boundary length, range [0,1]
-func (d *Driver) swipeInRange(bounds *Bounds, direction Direction, duration int, ratio float64) {
+func (d *Driver) swipeInRange(ctx context.Context, bounds *Bounds, direction Direction, duration int, ratio float64) error {
 	if duration == 0 {
 		duration = 40 // Default duration if not specified
 	}
@@ -102,6 +115,7 @@ func (d *Driver) swipeInRange(bounds *Bounds, direction Direction, duration int,
 	}
 
 	// Execute swipe command
-	c := fmt.Sprintf("%d %d %d %d %d", startX, startY, endX, endY, duration)
-	d.Run("input", "swipe", c)
+	_, err := d.RunContext(ctx, "input", "swipe",
+		strconv.Itoa(startX), strconv.Itoa(startY), strconv.Itoa(endX), strconv.Itoa(endY), strconv.Itoa(duration))
+	return err
 }
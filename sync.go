@@ -0,0 +1,525 @@
+package driver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	syncChunkSize = 64 * 1024 // maximum DATA payload accepted by adbd
+	syncModeDir   = 0040000   // S_IFDIR
+	syncModeType  = 0170000   // S_IFMT
+)
+
+// SyncOptions configures Push and Pull transfers
+type SyncOptions struct {
+	PreserveMode  bool               // keep file permissions from the source
+	PreserveTimes bool               // keep modification times from the source
+	Progress      func(SyncProgress) // called after every transferred chunk, may be nil
+}
+
+// SyncProgress reports the state of a running transfer
+type SyncProgress struct {
+	Path  string // file currently being transferred
+	Bytes int64  // bytes of Path transferred so far
+	Total int64  // size of Path
+}
+
+// SyncError describes a failed sync operation
+type SyncError struct {
+	Op      string // sync request (SEND/RECV/STAT/LIST)
+	Path    string // remote path of the request
+	Message string // failure message sent by the device
+}
+
+// Error implements the error interface
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("sync %s %s: %s", e.Op, e.Path, e.Message)
+}
+
+// syncStat is the file information returned by STAT and LIST
+type syncStat struct {
+	Name  string `json:"name"`
+	Mode  uint32 `json:"mode"`
+	Size  uint32 `json:"size"`
+	Mtime uint32 `json:"mtime"`
+}
+
+// IsDir reports whether the stat describes a directory
+func (s *syncStat) IsDir() bool {
+	return s.Mode&syncModeType == syncModeDir
+}
+
+// syncSession is an open file transfer session with a device, see syncer
+type syncSession interface {
+	// stat returns the remote file information, Mode is 0 if the path does not exist
+	stat(remote string) (*syncStat, error)
+	// list returns the entries of a remote directory, without "." and ".."
+	list(remote string) ([]*syncStat, error)
+	// sendFile uploads the content of r to the remote path with the given mode and mtime
+	sendFile(r io.Reader, remote string, mode os.FileMode, mtime time.Time, total int64, progress func(SyncProgress)) error
+	// recvFile downloads the remote path into w
+	recvFile(w io.Writer, remote string, total int64, progress func(SyncProgress)) error
+	// Close ends the session
+	Close() error
+}
+
+// syncer is implemented by executors transferring files themselves, like the
+// default executor on PC speaking the ADB sync protocol. With other executors,
+// Push and Pull run the "adb push" and "adb pull" host commands.
+type syncer interface {
+	// OpenSync opens a session with the device identified by serial,
+	// errSyncUnsupported if the executor wraps one that is not a syncer
+	OpenSync(ctx context.Context, serial string) (syncSession, error)
+}
+
+// errSyncUnsupported is returned by OpenSync of executors wrapping one that
+// cannot transfer files itself
+var errSyncUnsupported = errors.New("file transfers unsupported")
+
+// openSync opens a sync session with the device through the executor,
+// reporting false if the executor cannot transfer files itself
+func (d *Driver) openSync(ctx context.Context) (syncSession, bool, error) {
+	s, ok := d.executor.(syncer)
+	if !ok {
+		return nil, false, nil
+	}
+
+	conn, err := s.OpenSync(ctx, d.device)
+	if errors.Is(err, errSyncUnsupported) {
+		return nil, false, nil
+	}
+	return conn, true, err
+}
+
+// syncConn is an ADB connection switched to sync mode
+type syncConn struct {
+	*adbConn
+}
+
+// sync opens a connection to the device in sync mode
+func (c *adbClient) sync(ctx context.Context, serial string) (*syncConn, error) {
+	conn, err := c.transport(ctx, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.send("sync:"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &syncConn{conn}, nil
+}
+
+// Close ends the sync session and closes the connection
+func (c *syncConn) Close() error {
+	c.writeHeader("QUIT", 0)
+	return c.adbConn.Close()
+}
+
+// writeHeader writes a sync request id followed by a little endian length
+func (c *syncConn) writeHeader(id string, n uint32) error {
+	buf := make([]byte, 8)
+	copy(buf, id)
+	binary.LittleEndian.PutUint32(buf[4:], n)
+	_, err := c.Write(buf)
+	return err
+}
+
+// request writes a sync request carrying a path argument
+func (c *syncConn) request(id, arg string) error {
+	if err := c.writeHeader(id, uint32(len(arg))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c, arg)
+	return err
+}
+
+// readHeader reads a sync response id and its 32-bit argument
+func (c *syncConn) readHeader() (string, uint32, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return "", 0, err
+	}
+	return string(buf[:4]), binary.LittleEndian.Uint32(buf[4:]), nil
+}
+
+// readFail reads the message of a FAIL response
+func (c *syncConn) readFail(op, remote string, n uint32) error {
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(c, msg); err != nil {
+		return err
+	}
+	return &SyncError{Op: op, Path: remote, Message: string(msg)}
+}
+
+// stat returns the remote file information, Mode is 0 if the path does not exist
+func (c *syncConn) stat(remote string) (*syncStat, error) {
+	if err := c.request("STAT", remote); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		return nil, err
+	}
+	if string(buf[:4]) != "STAT" {
+		return nil, &SyncError{Op: "STAT", Path: remote, Message: "unexpected response " + string(buf[:4])}
+	}
+
+	return &syncStat{
+		Name:  path.Base(remote),
+		Mode:  binary.LittleEndian.Uint32(buf[4:]),
+		Size:  binary.LittleEndian.Uint32(buf[8:]),
+		Mtime: binary.LittleEndian.Uint32(buf[12:]),
+	}, nil
+}
+
+// list returns the entries of a remote directory, without "." and ".."
+func (c *syncConn) list(remote string) ([]*syncStat, error) {
+	if err := c.request("LIST", remote); err != nil {
+		return nil, err
+	}
+
+	var entries []*syncStat
+	for {
+		buf := make([]byte, 20)
+		if _, err := io.ReadFull(c, buf); err != nil {
+			return nil, err
+		}
+
+		switch string(buf[:4]) {
+		case "DONE":
+			return entries, nil
+		case "FAIL":
+			return nil, c.readFail("LIST", remote, binary.LittleEndian.Uint32(buf[4:]))
+		case "DENT":
+		default:
+			return nil, &SyncError{Op: "LIST", Path: remote, Message: "unexpected response " + string(buf[:4])}
+		}
+
+		name := make([]byte, binary.LittleEndian.Uint32(buf[16:]))
+		if _, err := io.ReadFull(c, name); err != nil {
+			return nil, err
+		}
+		if string(name) == "." || string(name) == ".." {
+			continue
+		}
+
+		entries = append(entries, &syncStat{
+			Name:  string(name),
+			Mode:  binary.LittleEndian.Uint32(buf[4:]),
+			Size:  binary.LittleEndian.Uint32(buf[8:]),
+			Mtime: binary.LittleEndian.Uint32(buf[12:]),
+		})
+	}
+}
+
+// sendFile uploads the content of r to the remote path with the given mode and mtime
+func (c *syncConn) sendFile(r io.Reader, remote string, mode os.FileMode, mtime time.Time, total int64, progress func(SyncProgress)) error {
+	if err := c.request("SEND", fmt.Sprintf("%s,%d", remote, uint32(mode.Perm())|0100000)); err != nil {
+		return err
+	}
+
+	var sent int64
+	buf := make([]byte, syncChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := c.writeHeader("DATA", uint32(n)); err != nil {
+				return err
+			}
+			if _, err := c.Write(buf[:n]); err != nil {
+				return err
+			}
+
+			sent += int64(n)
+			if progress != nil {
+				progress(SyncProgress{Path: remote, Bytes: sent, Total: total})
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.writeHeader("DONE", uint32(mtime.Unix())); err != nil {
+		return err
+	}
+
+	id, n, err := c.readHeader()
+	if err != nil {
+		return err
+	}
+
+	switch id {
+	case "OKAY":
+		return nil
+	case "FAIL":
+		return c.readFail("SEND", remote, n)
+	}
+
+	return &SyncError{Op: "SEND", Path: remote, Message: "unexpected response " + id}
+}
+
+// recvFile downloads the remote path into w
+func (c *syncConn) recvFile(w io.Writer, remote string, total int64, progress func(SyncProgress)) error {
+	if err := c.request("RECV", remote); err != nil {
+		return err
+	}
+
+	var received int64
+	for {
+		id, n, err := c.readHeader()
+		if err != nil {
+			return err
+		}
+
+		switch id {
+		case "DONE":
+			return nil
+		case "FAIL":
+			return c.readFail("RECV", remote, n)
+		case "DATA":
+		default:
+			return &SyncError{Op: "RECV", Path: remote, Message: "unexpected response " + id}
+		}
+
+		if _, err := io.CopyN(w, c, int64(n)); err != nil {
+			return err
+		}
+
+		received += int64(n)
+		if progress != nil {
+			progress(SyncProgress{Path: remote, Bytes: received, Total: total})
+		}
+	}
+}
+
+// Push copies a local file or directory to the device using the ADB sync protocol.
+// Directories are copied recursively. If remotePath is an existing directory,
+// the source is copied into it, like "adb push". Transfers go through the
+// driver Executor, executors without sync support running "adb push", in
+// which case opts is ignored.
+// Parameters:
+//   - ctx: context controlling the whole transfer
+//   - localPath: local file or directory to copy
+//   - remotePath: destination path on the device
+//   - opts: transfer options, nil for defaults
+//
+// Returns:
+//   - error: nil if successful, *SyncError if the device rejected a request,
+//     *ExitError if a command run on the device failed, e.g. cp on Android
+func (d *Driver) Push(ctx context.Context, localPath, remotePath string, opts *SyncOptions) error {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	if d.os == "android" {
+		_, err := d.RunContext(ctx, "cp", "-r", localPath, remotePath)
+		return err
+	}
+
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	conn, ok, err := d.openSync(ctx)
+	if !ok {
+		_, err = d.RunContext(ctx, "push", localPath, remotePath)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if st, err := conn.stat(remotePath); err != nil {
+		return err
+	} else if st.IsDir() {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+
+	if !info.IsDir() {
+		return d.pushFile(conn, localPath, remotePath, info, opts)
+	}
+
+	return filepath.Walk(localPath, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(remotePath, filepath.ToSlash(rel))
+
+		if fi.IsDir() {
+			// SEND creates parent directories, only empty ones need an explicit mkdir
+			entries, err := os.ReadDir(p)
+			if err != nil || len(entries) > 0 {
+				return err
+			}
+			_, err = d.RunContext(ctx, "mkdir", "-p", remote)
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		return d.pushFile(conn, p, remote, fi, opts)
+	})
+}
+
+// pushFile sends a single regular file over an open sync connection
+func (d *Driver) pushFile(conn syncSession, localPath, remotePath string, info os.FileInfo, opts *SyncOptions) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mode := os.FileMode(0644)
+	if opts.PreserveMode {
+		mode = info.Mode()
+	}
+
+	mtime := time.Now()
+	if opts.PreserveTimes {
+		mtime = info.ModTime()
+	}
+
+	return conn.sendFile(file, remotePath, mode, mtime, info.Size(), opts.Progress)
+}
+
+// Pull copies a file or directory from the device using the ADB sync protocol.
+// Directories are copied recursively. If localPath is an existing directory,
+// the source is copied into it, like "adb pull". Transfers go through the
+// driver Executor, executors without sync support running "adb pull", in
+// which case opts is ignored.
+// Parameters:
+//   - ctx: context controlling the whole transfer
+//   - remotePath: file or directory on the device
+//   - localPath: local destination path
+//   - opts: transfer options, nil for defaults
+//
+// Returns:
+//   - error: nil if successful, ErrFileNotFound if remotePath does not exist,
+//     *SyncError if the device rejected a request, *ExitError if cp failed on Android
+func (d *Driver) Pull(ctx context.Context, remotePath, localPath string, opts *SyncOptions) error {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	if d.os == "android" {
+		_, err := d.RunContext(ctx, "cp", "-r", remotePath, localPath)
+		return err
+	}
+
+	conn, ok, err := d.openSync(ctx)
+	if !ok {
+		_, err = d.RunContext(ctx, "pull", remotePath, localPath)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	st, err := conn.stat(remotePath)
+	if err != nil {
+		return err
+	}
+	if st.Mode == 0 {
+		return ErrFileNotFound
+	}
+
+	if DirExists(localPath) {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+
+	if !st.IsDir() {
+		return d.pullFile(conn, remotePath, localPath, st, opts)
+	}
+
+	return d.pullDir(conn, remotePath, localPath, st, opts)
+}
+
+// pullDir recursively pulls a remote directory
+func (d *Driver) pullDir(conn syncSession, remotePath, localPath string, st *syncStat, opts *SyncOptions) error {
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return err
+	}
+
+	entries, err := conn.list(remotePath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		remote := path.Join(remotePath, entry.Name)
+		local := filepath.Join(localPath, entry.Name)
+
+		if entry.IsDir() {
+			err = d.pullDir(conn, remote, local, entry, opts)
+		} else {
+			err = d.pullFile(conn, remote, local, entry, opts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return applySyncStat(localPath, st, opts)
+}
+
+// pullFile receives a single remote file over an open sync connection
+func (d *Driver) pullFile(conn syncSession, remotePath, localPath string, st *syncStat, opts *SyncOptions) error {
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+
+	err = conn.recvFile(file, remotePath, int64(st.Size), opts.Progress)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(localPath)
+		return err
+	}
+
+	return applySyncStat(localPath, st, opts)
+}
+
+// applySyncStat copies the remote mode and mtime to a local path when requested
+func applySyncStat(localPath string, st *syncStat, opts *SyncOptions) error {
+	if opts.PreserveMode {
+		if err := os.Chmod(localPath, os.FileMode(st.Mode).Perm()); err != nil {
+			return err
+		}
+	}
+
+	if opts.PreserveTimes {
+		mtime := time.Unix(int64(st.Mtime), 0)
+		if err := os.Chtimes(localPath, mtime, mtime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,303 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushPullFake(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeExecutor().OnFile("/sdcard/screen.png", []byte("png"))
+	d := newFakeDriver(t, fake)
+
+	local := t.TempDir()
+
+	// Pull into an existing directory keeps the remote name
+	if err := d.Pull(ctx, "/sdcard/screen.png", local, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(local, "screen.png")); string(data) != "png" {
+		t.Errorf("pulled %q, want %q", data, "png")
+	}
+
+	// Push a directory tree
+	src := filepath.Join(local, "assets")
+	os.MkdirAll(filepath.Join(src, "img"), 0755)
+	os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(src, "img", "b.txt"), []byte("b"), 0644)
+
+	if err := d.Push(ctx, src, "/data/local/tmp/assets", nil); err != nil {
+		t.Fatal(err)
+	}
+	for remote, want := range map[string]string{
+		"/data/local/tmp/assets/a.txt":     "a",
+		"/data/local/tmp/assets/img/b.txt": "b",
+	} {
+		if data, ok := fake.File(remote); !ok || string(data) != want {
+			t.Errorf("File(%q) = %q, %v, want %q", remote, data, ok, want)
+		}
+	}
+
+	// Pushing into an existing directory nests the source, like adb push
+	if err := d.Push(ctx, filepath.Join(src, "a.txt"), "/data/local/tmp/assets/img", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.File("/data/local/tmp/assets/img/a.txt"); !ok {
+		t.Errorf("a.txt not pushed into the existing directory, calls %q", fake.Calls())
+	}
+
+	// Pull the tree back
+	dst := filepath.Join(local, "copy")
+	if err := d.Pull(ctx, "/data/local/tmp/assets", dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "img/a.txt", "img/b.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not pulled: %v", name, err)
+		}
+	}
+
+	if err := d.Pull(ctx, "/sdcard/nope.png", local, nil); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Pull() of a missing file error = %v, want ErrFileNotFound", err)
+	}
+}
+
+// hostOnlyExecutor hides the optional capabilities of an executor
+type hostOnlyExecutor struct {
+	Executor
+}
+
+func TestPushPullWithoutSync(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(local, []byte("a"), 0644)
+
+	fake := newFakeExecutor().
+		On(`^adb push `+regexp.QuoteMeta(ShellQuote(local))+` /sdcard/a.txt$`, "1 file pushed\n").
+		OnResult(`^adb pull /sdcard/nope `, Result{Stderr: "adb: error: remote object '/sdcard/nope' does not exist\n", ExitCode: 1})
+
+	d := New(WithExecutor(hostOnlyExecutor{fake}))
+
+	if err := d.Push(context.Background(), local, "/sdcard/a.txt", nil); err != nil {
+		t.Errorf("Push() error = %v", err)
+	}
+
+	var exitErr *ExitError
+	if err := d.Pull(context.Background(), "/sdcard/nope", filepath.Dir(local), nil); !errors.As(err, &exitErr) {
+		t.Errorf("Pull() error = %v, want *ExitError", err)
+	}
+}
+
+// syncRequest reads a sync request of the fake ADB server, with its argument
+// or data, the argument of DONE being the mtime of a sent file
+func syncRequest(t *testing.T, conn net.Conn) (string, uint32, string) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", 0, ""
+	}
+
+	id, n := string(header[:4]), binary.LittleEndian.Uint32(header[4:])
+	if id == "DONE" || id == "QUIT" {
+		return id, n, ""
+	}
+
+	arg := make([]byte, n)
+	if _, err := io.ReadFull(conn, arg); err != nil {
+		t.Errorf("sync %s: %v", id, err)
+	}
+
+	return id, n, string(arg)
+}
+
+// syncPacket writes a sync response id, its 32-bit argument and a payload
+func syncPacket(conn net.Conn, id string, n uint32, payload ...byte) {
+	buf := make([]byte, 8)
+	copy(buf, id)
+	binary.LittleEndian.PutUint32(buf[4:], n)
+	conn.Write(append(buf, payload...))
+}
+
+// syncDent returns the payload of a LIST entry following its mode
+func syncDent(size, mtime uint32, name string) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, size)
+	buf = binary.LittleEndian.AppendUint32(buf, mtime)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(name)))
+	return append(buf, name...)
+}
+
+func TestSyncProtocol(t *testing.T) {
+	const mtime = 1700000000
+
+	type upload struct {
+		path, mode string
+		data       string
+		mtime      uint32
+	}
+	uploads := make(chan upload, 1)
+
+	server := newFakeAdbServer(t).on("sync:", func(t *testing.T, conn net.Conn, _ string) {
+		io.WriteString(conn, "OKAY")
+
+		for {
+			id, _, arg := syncRequest(t, conn)
+			switch id {
+			case "STAT":
+				var mode, size uint32
+				switch arg {
+				case "/sdcard/a.txt":
+					mode, size = 0100640, 5
+				case "/sdcard":
+					mode = syncModeDir | 0771
+				}
+				st := binary.LittleEndian.AppendUint32([]byte("STAT"), mode)
+				st = binary.LittleEndian.AppendUint32(st, size)
+				conn.Write(binary.LittleEndian.AppendUint32(st, mtime))
+			case "LIST":
+				syncPacket(conn, "DENT", syncModeDir|0771, syncDent(0, mtime, ".")...)
+				syncPacket(conn, "DENT", syncModeDir|0771, syncDent(0, mtime, "..")...)
+				syncPacket(conn, "DENT", 0100640, syncDent(5, mtime, "a.txt")...)
+				syncPacket(conn, "DONE", 0, make([]byte, 12)...)
+			case "RECV":
+				if arg != "/sdcard/a.txt" {
+					msg := "No such file or directory"
+					syncPacket(conn, "FAIL", uint32(len(msg)), []byte(msg)...)
+					continue
+				}
+				syncPacket(conn, "DATA", 3, []byte("hel")...)
+				syncPacket(conn, "DATA", 2, []byte("lo")...)
+				syncPacket(conn, "DONE", 0)
+			case "SEND":
+				up := upload{}
+				up.path, up.mode, _ = strings.Cut(arg, ",")
+				for {
+					id, n, data := syncRequest(t, conn)
+					if id != "DATA" {
+						up.mtime = n
+						break
+					}
+					up.data += data
+				}
+				uploads <- up
+				syncPacket(conn, "OKAY", 0)
+			default:
+				return
+			}
+		}
+	})
+
+	conn, err := server.client().sync(context.Background(), "emulator-5554")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Run("stat", func(t *testing.T) {
+		st, err := conn.stat("/sdcard/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *st != (syncStat{Name: "a.txt", Mode: 0100640, Size: 5, Mtime: mtime}) || st.IsDir() {
+			t.Errorf("stat() = %+v", *st)
+		}
+
+		if st, _ := conn.stat("/sdcard"); !st.IsDir() {
+			t.Errorf("stat(/sdcard) = %+v, want a directory", *st)
+		}
+		if st, _ := conn.stat("/nope"); st.Mode != 0 {
+			t.Errorf("stat(/nope) = %+v, want mode 0", *st)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		entries, err := conn.list("/sdcard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || *entries[0] != (syncStat{Name: "a.txt", Mode: 0100640, Size: 5, Mtime: mtime}) {
+			t.Errorf("list() = %v", entries)
+		}
+	})
+
+	t.Run("recv", func(t *testing.T) {
+		var buf bytes.Buffer
+		var progress []int64
+		err := conn.recvFile(&buf, "/sdcard/a.txt", 5, func(p SyncProgress) {
+			progress = append(progress, p.Bytes)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "hello" || len(progress) != 2 || progress[1] != 5 {
+			t.Errorf("recvFile() = %q, progress %v", buf.String(), progress)
+		}
+
+		var syncErr *SyncError
+		if err := conn.recvFile(io.Discard, "/nope", 0, nil); !errors.As(err, &syncErr) || syncErr.Message != "No such file or directory" {
+			t.Errorf("recvFile(/nope) error = %v, want *SyncError", err)
+		}
+	})
+
+	t.Run("send", func(t *testing.T) {
+		modified := time.Unix(mtime, 0)
+		if err := conn.sendFile(strings.NewReader("hello"), "/sdcard/b.txt", 0600, modified, 5, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		up := <-uploads
+		if up != (upload{path: "/sdcard/b.txt", mode: "33152", data: "hello", mtime: mtime}) {
+			t.Errorf("sent %+v", up)
+		}
+	})
+}
+
+func TestDownloadFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app.apk" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "apk")
+	}))
+	defer server.Close()
+
+	cfg := DefaultConfig()
+	cfg.TempPath = t.TempDir()
+	fake := newFakeExecutor().
+		On(`^test -e /sdcard/Download$`, "").
+		OnFile("/sdcard/Download/.keep", nil)
+	d := New(WithExecutor(fake), WithConfig(cfg))
+	d.device = "emulator-5554"
+
+	if err := d.DownloadFile(server.URL+"/app.apk", "/sdcard/Download/app.apk"); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := fake.File("/sdcard/Download/app.apk"); !ok || string(data) != "apk" {
+		t.Errorf("pushed %q, %v, want %q", data, ok, "apk")
+	}
+
+	if err := d.DownloadFile(server.URL+"/missing.apk", "/sdcard/Download/missing.apk"); !errors.Is(err, ErrDownloadFailed) {
+		t.Errorf("DownloadFile() of a missing file error = %v, want ErrDownloadFailed", err)
+	}
+
+	// Neither the pushed file nor the failed download is left on the host
+	if err := filepath.Walk(cfg.TempPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("staging file %s left on the host", path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
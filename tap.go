@@ -1,15 +1,31 @@
 package driver
 
-import "strconv"
+import (
+	"context"
+	"strconv"
+)
 
 // Tap performs a tap action at the specified coordinates.
 // Parameters:
 //   - x: The x-coordinate to tap.
 //   - y: The y-coordinate to tap.
 func (d *Driver) Tap(x, y int) {
+	d.TapContext(context.Background(), x, y)
+}
+
+// TapContext performs a tap action like Tap, stopping when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the command lifetime.
+//   - x: The x-coordinate to tap.
+//   - y: The y-coordinate to tap.
+//
+// Returns:
+//   - error: An error object if the tap could not be sent.
+func (d *Driver) TapContext(ctx context.Context, x, y int) error {
 	px := strconv.Itoa(x)
 	py := strconv.Itoa(y)
-	d.Run("input", "tap", px, py)
+	_, err := d.RunContext(ctx, "input", "tap", px, py)
+	return err
 }
 
 // LongTap performs a long tap action at the specified coordinates.
@@ -17,7 +33,20 @@ func (d *Driver) Tap(x, y int) {
 //   - x: The x-coordinate to long tap.
 //   - y: The y-coordinate to long tap.
 func (d *Driver) LongTap(x, y int) {
+	d.LongTapContext(context.Background(), x, y)
+}
+
+// LongTapContext performs a long tap action like LongTap, stopping when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the command lifetime.
+//   - x: The x-coordinate to long tap.
+//   - y: The y-coordinate to long tap.
+//
+// Returns:
+//   - error: An error object if the long tap could not be sent.
+func (d *Driver) LongTapContext(ctx context.Context, x, y int) error {
 	px := strconv.Itoa(x)
 	py := strconv.Itoa(y)
-	d.Run("input", "swipe", px, py, px, py, "800")
+	_, err := d.RunContext(ctx, "input", "swipe", px, py, px, py, "800")
+	return err
 }
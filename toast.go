@@ -0,0 +1,171 @@
+package driver
+
+import (
+	"context"
+	"time"
+)
+
+// GetLastToast returns the message of the last toast reported by the server
+// Parameters:
+//   - ctx: context controlling the call
+//
+// Returns:
+//   - string: the message, empty if no toast was shown since it was cleared
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) GetLastToast(ctx context.Context) (string, error) {
+	var message *string
+	if err := c.call(ctx, 0, "getLastToast", &message); err != nil || message == nil {
+		return "", err
+	}
+
+	return *message, nil
+}
+
+// ClearLastToast forgets the last toast, so that GetLastToast reports the next one only
+// Parameters:
+//   - ctx: context controlling the call
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) ClearLastToast(ctx context.Context) error {
+	c.toastMu.Lock()
+	defer c.toastMu.Unlock()
+
+	return c.call(ctx, 0, "clearLastToast", nil)
+}
+
+// TakeLastToast returns the message of the last toast and clears it in one
+// step, so that concurrent callers never get the same toast
+// Parameters:
+//   - ctx: context controlling the calls
+//
+// Returns:
+//   - string: the message, empty if no toast was shown since it was cleared
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) TakeLastToast(ctx context.Context) (string, error) {
+	c.toastMu.Lock()
+	defer c.toastMu.Unlock()
+
+	message, err := c.GetLastToast(ctx)
+	if err != nil || message == "" {
+		return "", err
+	}
+
+	if err := c.call(ctx, 0, "clearLastToast", nil); err != nil {
+		return "", err
+	}
+
+	return message, nil
+}
+
+// WaitToast waits for a toast and returns its message. Toasts never appear in
+// Document, they are caught by the UiAutomator server. A toast shown before
+// the call and not returned yet is returned at once: use WaitToastAfter to
+// catch the toast of an action such as a Tap. Every toast is returned once only.
+// Parameters:
+//   - timeout: maximum time to wait, Config.WaitTimeout if zero
+//
+// Returns:
+//   - string: the message, e.g. "Saved"
+//   - error: ErrToastNotFound if no toast was shown in time, otherwise the server error
+func (d *Driver) WaitToast(timeout time.Duration) (string, error) {
+	return d.WaitToastContext(context.Background(), timeout)
+}
+
+// WaitToastContext waits for a toast like WaitToast, stopping when ctx is done
+// Parameters:
+//   - ctx: context bounding the whole wait, in addition to timeout
+//   - timeout: maximum time to wait, Config.WaitTimeout if zero
+//
+// Returns:
+//   - string: the message, e.g. "Saved"
+//   - error: same errors as WaitToast, or ctx.Err() if ctx is done first
+func (d *Driver) WaitToastContext(ctx context.Context, timeout time.Duration) (string, error) {
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return "", err
+	}
+
+	return d.pollToast(ctx, timeout)
+}
+
+// WaitToastAfter clears the last toast, runs an action and waits for the toast
+// it shows, e.g. the "Saved" toast of a Tap, so that an older toast is not
+// taken for it. Every toast is returned once only.
+// Parameters:
+//   - ctx: context bounding the whole wait, in addition to timeout
+//   - timeout: maximum time to wait after the action, Config.WaitTimeout if zero
+//   - action: the action showing the toast, nil to only wait
+//
+// Returns:
+//   - string: the message, e.g. "Saved"
+//   - error: the error of action, otherwise the same errors as WaitToastContext
+func (d *Driver) WaitToastAfter(ctx context.Context, timeout time.Duration, action func() error) (string, error) {
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return "", err
+	}
+
+	if err := d.u2.ClearLastToast(ctx); err != nil {
+		return "", err
+	}
+
+	if action != nil {
+		if err := action(); err != nil {
+			return "", err
+		}
+	}
+
+	return d.pollToast(ctx, timeout)
+}
+
+// pollToast takes the last toast until there is one or timeout is reached
+func (d *Driver) pollToast(ctx context.Context, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = d.config.WaitTimeout
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		message, err := d.u2.TakeLastToast(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if message != "" {
+			return message, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-deadline.C:
+			return "", ErrToastNotFound
+		case <-time.After(d.config.PollInterval / 2):
+		}
+	}
+}
+
+// LastToast returns the message of the last toast shown, without waiting
+// nor consuming it
+// Returns:
+//   - string: the message, empty if no toast was shown recently
+//   - error: nil if successful, otherwise error details
+func (d *Driver) LastToast() (string, error) {
+	return d.LastToastContext(context.Background())
+}
+
+// LastToastContext returns the last toast like LastToast, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//
+// Returns:
+//   - string: the message, empty if no toast was shown recently
+//   - error: same errors as LastToast, or ctx.Err() if ctx is done
+func (d *Driver) LastToastContext(ctx context.Context) (string, error) {
+	if err := d.ensureUiAutomator(ctx); err != nil {
+		return "", err
+	}
+
+	return d.u2.GetLastToast(ctx)
+}
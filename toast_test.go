@@ -0,0 +1,151 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// toastServer is a fakeU2Server keeping the last toast like the UiAutomator server
+type toastServer struct {
+	*fakeU2Server
+
+	mu    sync.Mutex
+	toast *string
+}
+
+// newToastServer creates a toastServer whose last toast is message, none if empty
+func newToastServer(message string) *toastServer {
+	s := &toastServer{fakeU2Server: newFakeU2Server()}
+	s.show(message)
+
+	s.Handle("getLastToast", func([]json.RawMessage) (any, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.toast, nil
+	})
+	s.Handle("clearLastToast", func([]json.RawMessage) (any, error) {
+		s.show("")
+		return true, nil
+	})
+
+	return s
+}
+
+// show makes message the last toast, clearing it if empty
+func (s *toastServer) show(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.toast = nil
+	if message != "" {
+		s.toast = &message
+	}
+}
+
+// newToastDriver creates a driver whose UiAutomator server is the given one
+func newToastDriver(t *testing.T, server *toastServer) *Driver {
+	t.Helper()
+
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+
+	d := newFakeDriver(t, newFakeExecutor())
+	d.u2 = NewU2Client(srv.URL)
+	d.config.PollInterval = 20 * time.Millisecond
+	d.supervisor.setState(U2Running, nil)
+
+	return d
+}
+
+func TestWaitToast(t *testing.T) {
+	ctx := context.Background()
+	server := newToastServer("Pending")
+	d := newToastDriver(t, server)
+
+	// A toast shown before the call is returned
+	if msg, err := d.WaitToast(100 * time.Millisecond); err != nil || msg != "Pending" {
+		t.Errorf("WaitToast() = %q, %v, want Pending", msg, err)
+	}
+
+	// Each toast is returned once
+	if msg, err := d.WaitToastContext(ctx, 100*time.Millisecond); !errors.Is(err, ErrToastNotFound) {
+		t.Errorf("WaitToastContext() of a returned toast = %q, %v, want ErrToastNotFound", msg, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.show("Later")
+	}()
+	if msg, err := d.WaitToastContext(ctx, time.Second); err != nil || msg != "Later" {
+		t.Errorf("WaitToastContext() = %q, %v, want Later", msg, err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.WaitToastContext(canceled, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitToastContext() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitToastAfter(t *testing.T) {
+	ctx := context.Background()
+	server := newToastServer("Stale")
+	d := newToastDriver(t, server)
+
+	// The toast shown before the action is cleared first
+	msg, err := d.WaitToastAfter(ctx, time.Second, func() error {
+		server.show("Saved")
+		return nil
+	})
+	if err != nil || msg != "Saved" {
+		t.Errorf("WaitToastAfter() = %q, %v, want Saved", msg, err)
+	}
+
+	server.show("Stale")
+	if msg, err := d.WaitToastAfter(ctx, 100*time.Millisecond, func() error { return nil }); !errors.Is(err, ErrToastNotFound) {
+		t.Errorf("WaitToastAfter() of an action showing nothing = %q, %v, want ErrToastNotFound", msg, err)
+	}
+
+	failed := errors.New("tap failed")
+	if _, err := d.WaitToastAfter(ctx, time.Second, func() error { return failed }); !errors.Is(err, failed) {
+		t.Errorf("WaitToastAfter() error = %v, want the action error", err)
+	}
+}
+
+func TestTakeLastToast(t *testing.T) {
+	server := newToastServer("Hello")
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	client := NewU2Client(srv.URL)
+
+	var wg sync.WaitGroup
+	messages := make(chan string, 8)
+	for i := 0; i < cap(messages); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, err := client.TakeLastToast(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+			messages <- message
+		}()
+	}
+	wg.Wait()
+	close(messages)
+
+	taken := 0
+	for message := range messages {
+		if message != "" {
+			taken++
+		}
+	}
+	if taken != 1 {
+		t.Errorf("the toast was taken %d times, want once", taken)
+	}
+}
@@ -1,39 +1,336 @@
 package driver
 
 import (
-	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-// Check if the UiAutomator server is running
-func (d *Driver) checkUiAutomator() (bool, string) {
-	output, _ := d.Run("netstat", "-anp", "2>/dev/null")
+// Timings of the UiAutomator server supervision
+const (
+	u2PingTimeout   = 3 * time.Second        // timeout of a health check
+	u2ReadyInterval = 200 * time.Millisecond // interval between pings while the server starts
+	u2MaxBackoff    = 30 * time.Second       // maximum delay between two restarts
+)
+
+// U2State is the state of the UiAutomator server
+type U2State string
+
+const (
+	U2Stopped    U2State = "stopped"    // not started, or stopped by Cleanup
+	U2Starting   U2State = "starting"   // launched, waiting for it to answer
+	U2Running    U2State = "running"    // answering health checks
+	U2Restarting U2State = "restarting" // crashed or stopped answering, being restarted
+	U2Failed     U2State = "failed"     // could not be started
+)
+
+// U2Status reports the supervision of the UiAutomator server
+type U2Status struct {
+	State     U2State   // current state
+	Since     time.Time // time of the last state change
+	Restarts  int       // restarts after the server crashed or stopped answering
+	LastError error     // last failure of the server, nil if none
+}
+
+// u2Supervisor starts the UiAutomator server and keeps it answering
+type u2Supervisor struct {
+	lifecycle sync.Mutex // serializes starts, restarts and stops of the server
+
+	mu     sync.Mutex
+	status U2Status
+	health context.CancelFunc // stops the health loop, nil if not running
+	launch *u2Launch          // server launched by the driver, nil if adopted or stopped
+}
+
+// u2Launch is a server process launched by the driver
+type u2Launch struct {
+	cancel context.CancelFunc // kills the process
+	exited chan struct{}      // closed when the process exits
+	err    error              // why the process exited, set before exited is closed
+}
+
+// newU2Supervisor creates a supervisor of a stopped server
+func newU2Supervisor() *u2Supervisor {
+	return &u2Supervisor{status: U2Status{State: U2Stopped, Since: time.Now()}}
+}
+
+// setState records a state change, and the error causing it if any
+func (s *u2Supervisor) setState(state U2State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status.State != state {
+		s.status.State = state
+		s.status.Since = time.Now()
+	}
+	if err != nil {
+		s.status.LastError = err
+	}
+}
+
+// state returns the current state
+func (s *u2Supervisor) state() U2State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status.State
+}
+
+// stopHealth stops the health loop
+func (s *u2Supervisor) stopHealth() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.health != nil {
+		s.health()
+		s.health = nil
+	}
+}
+
+// UiAutomatorStatus reports the state of the UiAutomator server.
+// The server is started on connection, checked in the background and
+// restarted with an increasing delay when it crashes or stops answering.
+// Returns:
+//   - U2Status: the current status
+func (d *Driver) UiAutomatorStatus() U2Status {
+	s := d.supervisor
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.status
+}
+
+// pingUiAutomator checks that the UiAutomator server answers, without
+// triggering a device recovery when it does not
+func (d *Driver) pingUiAutomator(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(withoutRecovery(ctx), u2PingTimeout)
+	defer cancel()
+
+	return d.u2.Ping(ctx)
+}
+
+// ensureUiAutomator starts the UiAutomator server unless it is supervised as running
+func (d *Driver) ensureUiAutomator(ctx context.Context) error {
+	if d.supervisor.state() == U2Running {
+		return nil
+	}
+
+	return d.startUiAutomator(ctx)
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, ":9008") {
-			process := strings.Fields(line)
-			if len(process) > 1 {
-				pid := strings.Split(process[len(process)-1], "/")[0]
-				return true, pid
-			}
-			break
+// startUiAutomator starts the UiAutomator server, waits for it to answer and
+// supervises it. A server that already answers is adopted instead of being
+// launched again.
+func (d *Driver) startUiAutomator(ctx context.Context) error {
+	s := d.supervisor
+
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	if d.pingUiAutomator(ctx) != nil {
+		d.killUiAutomator(ctx)
+
+		s.setState(U2Starting, nil)
+		if err := d.launchUiAutomator(ctx); err != nil {
+			s.setState(U2Failed, err)
+			return err
 		}
 	}
 
-	return false, ""
+	s.setState(U2Running, nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.health == nil {
+		var health context.Context
+		health, s.health = context.WithCancel(context.Background())
+		go d.healthLoop(health)
+	}
+
+	return nil
+}
+
+// restartUiAutomator stops the UiAutomator server and starts a new one,
+// e.g. to load a newly installed jar
+func (d *Driver) restartUiAutomator(ctx context.Context) error {
+	d.stopUiAutomator(ctx)
+	return d.startUiAutomator(ctx)
 }
 
-// Stop the UiAutomator server if it is running
-func (d *Driver) stopUiAutomator() {
-	if running, pid := d.checkUiAutomator(); running {
-		d.Run("kill", pid)
+// stopUiAutomator stops the supervision and the UiAutomator server
+func (d *Driver) stopUiAutomator(ctx context.Context) {
+	s := d.supervisor
+
+	// Stop the health loop first, so that it gives up a pending restart
+	s.stopHealth()
+
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+
+	d.killUiAutomator(ctx)
+	s.setState(U2Stopped, nil)
+}
+
+// killUiAutomator kills the server, including one left over by another driver
+func (d *Driver) killUiAutomator(ctx context.Context) {
+	s := d.supervisor
+
+	s.mu.Lock()
+	if s.launch != nil {
+		s.launch.cancel()
+		s.launch = nil
+	}
+	s.mu.Unlock()
+
+	d.RunContext(withoutRecovery(ctx), "pkill", "-f", "com.wetest.uia2.Main")
+}
+
+// launchUiAutomator runs the server in a dedicated shell, so it does not hold
+// the shell session and outlives ctx, and waits until it answers
+func (d *Driver) launchUiAutomator(ctx context.Context) error {
+	s := d.supervisor
+
+	server, cancel := context.WithCancel(context.Background())
+	launch := &u2Launch{cancel: cancel, exited: make(chan struct{})}
+	cmdline := Cmd("env", "CLASSPATH="+d.config.U2Path, "app_process", "/", "com.wetest.uia2.Main").String()
+
+	go func() {
+		defer close(launch.exited)
+
+		res, err := d.runOneshot(server, cmdline)
+		if err == nil {
+			err = fmt.Errorf("exited: %s", strings.TrimSpace(res.Output()))
+		}
+		launch.err = fmt.Errorf("%w: %v", ErrUiAutomatorUnavailable, err)
+	}()
+
+	timeout := time.NewTimer(d.config.WaitTimeout)
+	defer timeout.Stop()
+
+	for d.pingUiAutomator(ctx) != nil {
+		select {
+		case <-launch.exited:
+			return launch.err
+		case <-ctx.Done():
+			cancel()
+			return ctx.Err()
+		case <-timeout.C:
+			cancel()
+			return fmt.Errorf("%w: no answer after %s", ErrUiAutomatorUnavailable, d.config.WaitTimeout)
+		case <-time.After(u2ReadyInterval):
+		}
 	}
+
+	s.mu.Lock()
+	s.launch = launch
+	s.mu.Unlock()
+
+	return nil
 }
 
-// Start the UiAutomator server
-func (d *Driver) startUiAutomator() {
-	d.stopUiAutomator()
-	go d.Run("CLASSPATH="+U2_PATH, "app_process", "/", "com.wetest.uia2.Main")
+// healthLoop pings the server every Config.U2HealthInterval until ctx is done,
+// and restarts it when it exits or stops answering
+func (d *Driver) healthLoop(ctx context.Context) {
+	s := d.supervisor
+
+	for {
+		s.mu.Lock()
+		launch := s.launch
+		s.mu.Unlock()
+
+		// A server launched by someone else can only be pinged
+		var exited chan struct{}
+		if launch != nil {
+			exited = launch.exited
+		}
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-exited:
+			err = launch.err
+		case <-time.After(d.config.U2HealthInterval):
+			err = d.pingUiAutomator(ctx)
+		}
+
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.status.Restarts++
+		s.mu.Unlock()
+		s.setState(U2Restarting, err)
+
+		if !d.reviveUiAutomator(ctx) {
+			return
+		}
+	}
+}
+
+// reviveUiAutomator restarts the server until it answers, waiting longer
+// after each failure, and reports false if ctx is done first
+func (d *Driver) reviveUiAutomator(ctx context.Context) bool {
+	s := d.supervisor
+
+	for delay := time.Second; ; delay = min(delay*2, u2MaxBackoff) {
+		s.lifecycle.Lock()
+		if ctx.Err() != nil {
+			s.lifecycle.Unlock()
+			return false
+		}
+
+		// The forwarding may be what broke, e.g. after the ADB server restarted
+		d.forwards.setU2Forward(PortForward{})
+
+		err := d.pingUiAutomator(ctx)
+		if err != nil {
+			d.killUiAutomator(ctx)
+			err = d.launchUiAutomator(ctx)
+		}
+		s.lifecycle.Unlock()
+
+		if err == nil {
+			s.setState(U2Running, nil)
+			return true
+		}
+		s.setState(U2Restarting, err)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
+
+// u2URL returns the JSON-RPC endpoint of the UiAutomator server.
+// On PC the server is reached through an adb forward from a free port of the
+// ADB server host, created on first use and removed by Cleanup.
+func (d *Driver) u2URL(ctx context.Context) (string, error) {
+	if d.os == "android" {
+		return "http://127.0.0.1:" + strconv.Itoa(d.config.U2Port) + "/jsonrpc/0", nil
+	}
+
+	f := d.forwards.u2Forward()
+	if f.Local == "" || f.Serial != d.device {
+		var err error
+		f, err = d.ForwardContext(ctx, TCP(0), TCP(d.config.U2Port))
+		if err != nil {
+			return "", err
+		}
+		d.forwards.setU2Forward(f)
+	}
+
+	return "http://" + net.JoinHostPort(d.adb.serverHost(), strings.TrimPrefix(f.Local, "tcp:")) + "/jsonrpc/0", nil
 }
@@ -0,0 +1,395 @@
+package driver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RPCError is an error response of the UiAutomator server
+type RPCError struct {
+	Method  string          `json:"-"`       // method of the failed request
+	Code    int             `json:"code"`    // JSON-RPC error code
+	Message string          `json:"message"` // error message, often a Java exception name
+	Data    json.RawMessage `json:"data"`    // additional data, e.g. a stack trace
+}
+
+// Error implements the error interface
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("u2 %s: %d %s", e.Method, e.Code, e.Message)
+}
+
+// U2Client is a typed client of the JSON-RPC API of the UiAutomator server (u2.jar)
+type U2Client struct {
+	Timeout time.Duration // timeout of each call, added to the wait of waiting methods; 0 for none
+
+	endpoint func(ctx context.Context) (string, error)                             // resolves the server URL
+	send     func(ctx context.Context, url string, request []byte) ([]byte, error) // posts a request
+
+	mu sync.Mutex
+	id int
+
+	toastMu sync.Mutex // serializes the reads and clears of the last toast
+}
+
+// NewU2Client creates a client for the UiAutomator server at the given URL,
+// e.g. an httptest server in tests. Drivers provide a connected client with U2,
+// following their Config. This one uses the RPCTimeout of DefaultConfig,
+// which can be changed with Timeout, and the default client of Request.
+// Parameters:
+//   - url: JSON-RPC endpoint, e.g. "http://127.0.0.1:9008/jsonrpc/0"
+//
+// Returns:
+//   - *U2Client: the client
+func NewU2Client(url string) *U2Client {
+	return &U2Client{
+		Timeout: DefaultConfig().RPCTimeout,
+		endpoint: func(context.Context) (string, error) {
+			return url, nil
+		},
+		send: func(ctx context.Context, url string, request []byte) ([]byte, error) {
+			return httpRPC(ctx, nil, url, request)
+		},
+	}
+}
+
+// U2 returns the client of the UiAutomator server of the device.
+// Requests go through the driver executor, so they can be faked or recorded.
+// Returns:
+//   - *U2Client: the client
+func (d *Driver) U2() *U2Client {
+	return d.u2
+}
+
+// newDriverU2Client creates the client returned by U2
+func newDriverU2Client(d *Driver) *U2Client {
+	return &U2Client{
+		Timeout:  d.config.RPCTimeout,
+		endpoint: d.u2URL,
+		send:     d.sendRPC,
+	}
+}
+
+// rpcRequest is a JSON-RPC request
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC response
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// Call invokes a method of the server, for methods without a typed wrapper
+// Parameters:
+//   - ctx: context controlling the call, bounded by Timeout
+//   - method: method name, e.g. "deviceInfo"
+//   - result: pointer receiving the decoded result, nil to ignore it
+//   - params: method parameters
+//
+// Returns:
+//   - error: nil if successful, *RPCError for an error response, otherwise the transport error
+func (c *U2Client) Call(ctx context.Context, method string, result any, params ...any) error {
+	return c.call(ctx, 0, method, result, params...)
+}
+
+// call invokes a method, extending the timeout by wait for methods that block on the device
+func (c *U2Client) call(ctx context.Context, wait time.Duration, method string, result any, params ...any) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout+wait)
+		defer cancel()
+	}
+
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.mu.Unlock()
+
+	if params == nil {
+		params = []any{}
+	}
+
+	request, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	url, err := c.endpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := c.send(ctx, url, request)
+	if err != nil {
+		return err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("u2 %s: invalid response: %w", method, err)
+	}
+
+	if resp.Error != nil {
+		resp.Error.Method = method
+		return resp.Error
+	}
+
+	if string(resp.ID) != fmt.Sprint(id) {
+		return fmt.Errorf("u2 %s: response id %s does not match request id %d", method, resp.ID, id)
+	}
+
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("u2 %s: unexpected result %s: %w", method, resp.Result, err)
+	}
+
+	return nil
+}
+
+// Ping checks that the server answers
+// Parameters:
+//   - ctx: context controlling the call
+//
+// Returns:
+//   - error: nil if the server answered, otherwise error details
+func (c *U2Client) Ping(ctx context.Context) error {
+	var pong string
+	if err := c.call(ctx, 0, "ping", &pong); err != nil {
+		return err
+	}
+
+	if pong != "pong" {
+		return fmt.Errorf("u2 ping: unexpected answer %q", pong)
+	}
+
+	return nil
+}
+
+// DumpWindowHierarchy returns the XML hierarchy of the current window
+// Parameters:
+//   - ctx: context controlling the call
+//   - compressed: true to leave out unimportant nodes
+//   - maxDepth: maximum depth of the hierarchy
+//
+// Returns:
+//   - string: the hierarchy XML
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) DumpWindowHierarchy(ctx context.Context, compressed bool, maxDepth int) (string, error) {
+	var xml string
+	err := c.call(ctx, 0, "dumpWindowHierarchy", &xml, compressed, maxDepth)
+	return xml, err
+}
+
+// Click taps a point of the screen
+// Parameters:
+//   - ctx: context controlling the call
+//   - x, y: coordinates of the point
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) Click(ctx context.Context, x, y int) error {
+	return c.boolCall(ctx, 0, "click", x, y)
+}
+
+// Swipe swipes between two points
+// Parameters:
+//   - ctx: context controlling the call
+//   - sx, sy: start point
+//   - ex, ey: end point
+//   - steps: number of moves, each taking about 5ms
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) Swipe(ctx context.Context, sx, sy, ex, ey, steps int) error {
+	return c.boolCall(ctx, 0, "swipe", sx, sy, ex, ey, steps)
+}
+
+// Drag presses a point, moves to another one and releases
+// Parameters:
+//   - ctx: context controlling the call
+//   - sx, sy: start point
+//   - ex, ey: end point
+//   - steps: number of moves, each taking about 5ms
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) Drag(ctx context.Context, sx, sy, ex, ey, steps int) error {
+	return c.boolCall(ctx, 0, "drag", sx, sy, ex, ey, steps)
+}
+
+// TakeScreenshot captures the screen
+// Parameters:
+//   - ctx: context controlling the call
+//   - scale: scale of the image, 1 for the screen size
+//   - quality: JPEG quality, 1 to 100
+//
+// Returns:
+//   - []byte: the JPEG image
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) TakeScreenshot(ctx context.Context, scale float64, quality int) ([]byte, error) {
+	var data string
+	if err := c.call(ctx, 0, "takeScreenshot", &data, scale, quality); err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// U2DeviceInfo is the device information reported by the UiAutomator server
+type U2DeviceInfo struct {
+	CurrentPackageName string `json:"currentPackageName"`
+	DisplayHeight      int    `json:"displayHeight"`
+	DisplayWidth       int    `json:"displayWidth"`
+	DisplayRotation    int    `json:"displayRotation"`
+	DisplaySizeDpX     int    `json:"displaySizeDpX"`
+	DisplaySizeDpY     int    `json:"displaySizeDpY"`
+	ProductName        string `json:"productName"`
+	ScreenOn           bool   `json:"screenOn"`
+	SdkInt             int    `json:"sdkInt"`
+	NaturalOrientation bool   `json:"naturalOrientation"`
+}
+
+// DeviceInfo returns the display and foreground app information
+// Parameters:
+//   - ctx: context controlling the call
+//
+// Returns:
+//   - U2DeviceInfo: the information
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) DeviceInfo(ctx context.Context) (U2DeviceInfo, error) {
+	var info U2DeviceInfo
+	err := c.call(ctx, 0, "deviceInfo", &info)
+	return info, err
+}
+
+// WaitForIdle waits until the UI of the foreground app is idle
+// Parameters:
+//   - ctx: context controlling the call
+//   - timeout: maximum time to wait
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) WaitForIdle(ctx context.Context, timeout time.Duration) error {
+	return c.call(ctx, timeout, "waitForIdle", nil, timeout.Milliseconds())
+}
+
+// U2Bounds is a rectangle of the screen
+type U2Bounds struct {
+	Top    int `json:"top"`
+	Bottom int `json:"bottom"`
+	Left   int `json:"left"`
+	Right  int `json:"right"`
+}
+
+// U2ObjInfo describes a UI object found by the UiAutomator server
+type U2ObjInfo struct {
+	Bounds             U2Bounds `json:"bounds"`
+	VisibleBounds      U2Bounds `json:"visibleBounds"`
+	ChildCount         int      `json:"childCount"`
+	ClassName          string   `json:"className"`
+	ContentDescription string   `json:"contentDescription"`
+	PackageName        string   `json:"packageName"`
+	ResourceName       string   `json:"resourceName"`
+	Text               string   `json:"text"`
+	Checkable          bool     `json:"checkable"`
+	Checked            bool     `json:"checked"`
+	Clickable          bool     `json:"clickable"`
+	Enabled            bool     `json:"enabled"`
+	Focusable          bool     `json:"focusable"`
+	Focused            bool     `json:"focused"`
+	LongClickable      bool     `json:"longClickable"`
+	Scrollable         bool     `json:"scrollable"`
+	Selected           bool     `json:"selected"`
+}
+
+// ObjInfo describes the first object matching the selector
+// Parameters:
+//   - ctx: context controlling the call
+//   - sel: the selector
+//
+// Returns:
+//   - U2ObjInfo: the object information
+//   - error: nil if successful, *RPCError if no object matches
+func (c *U2Client) ObjInfo(ctx context.Context, sel U2Selector) (U2ObjInfo, error) {
+	var info U2ObjInfo
+	err := c.call(ctx, 0, "objInfo", &info, sel)
+	return info, err
+}
+
+// SetText replaces the text of the first object matching the selector
+// Parameters:
+//   - ctx: context controlling the call
+//   - sel: the selector
+//   - text: the new text
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) SetText(ctx context.Context, sel U2Selector, text string) error {
+	return c.boolCall(ctx, 0, "setText", sel, text)
+}
+
+// PressKey presses a named key
+// Parameters:
+//   - ctx: context controlling the call
+//   - key: key name, e.g. "home", "back", "enter" or "recent"
+//
+// Returns:
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) PressKey(ctx context.Context, key string) error {
+	return c.boolCall(ctx, 0, "pressKey", key)
+}
+
+// Exist reports whether an object matches the selector
+// Parameters:
+//   - ctx: context controlling the call
+//   - sel: the selector
+//
+// Returns:
+//   - bool: true if an object matches
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) Exist(ctx context.Context, sel U2Selector) (bool, error) {
+	var exists bool
+	err := c.call(ctx, 0, "exist", &exists, sel)
+	return exists, err
+}
+
+// WaitForExists waits until an object matches the selector
+// Parameters:
+//   - ctx: context controlling the call
+//   - sel: the selector
+//   - timeout: maximum time to wait
+//
+// Returns:
+//   - bool: true if an object matched before the timeout
+//   - error: nil if successful, otherwise error details
+func (c *U2Client) WaitForExists(ctx context.Context, sel U2Selector, timeout time.Duration) (bool, error) {
+	var exists bool
+	err := c.call(ctx, timeout, "waitForExists", &exists, sel, timeout.Milliseconds())
+	return exists, err
+}
+
+// boolCall invokes a method answering a success flag, turning false into an error
+func (c *U2Client) boolCall(ctx context.Context, wait time.Duration, method string, params ...any) error {
+	var ok bool
+	if err := c.call(ctx, wait, method, &ok, params...); err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("u2 %s: failed", method)
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package driver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestU2ClientCalls(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeU2Server().
+		On("ping", "pong").
+		On("dumpWindowHierarchy", "<hierarchy/>").
+		On("click", true).
+		On("swipe", false).
+		On("takeScreenshot", base64.StdEncoding.EncodeToString([]byte("jpeg"))).
+		On("deviceInfo", map[string]any{"displayWidth": 1080, "displayHeight": 2400, "sdkInt": 34}).
+		OnError("objInfo", -32001, "UiObjectNotFoundException").
+		Handle("exist", func(params []json.RawMessage) (any, error) {
+			var sel U2Selector
+			if len(params) != 1 || json.Unmarshal(params[0], &sel) != nil {
+				return nil, errors.New("bad selector")
+			}
+			return sel.Text == "OK", nil
+		})
+
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	client := NewU2Client(srv.URL + "/jsonrpc/0")
+
+	tests := []struct {
+		name    string
+		call    func() (any, error)
+		want    any
+		wantErr string
+	}{
+		{"ping", func() (any, error) { return nil, client.Ping(ctx) }, nil, ""},
+		{"dump", func() (any, error) { return client.DumpWindowHierarchy(ctx, true, 50) }, "<hierarchy/>", ""},
+		{"click", func() (any, error) { return nil, client.Click(ctx, 1, 2) }, nil, ""},
+		{"failed swipe", func() (any, error) { return nil, client.Swipe(ctx, 0, 0, 1, 1, 10) }, nil, "u2 swipe: failed"},
+		{"screenshot", func() (any, error) {
+			data, err := client.TakeScreenshot(ctx, 1, 80)
+			return string(data), err
+		}, "jpeg", ""},
+		{"device info", func() (any, error) {
+			info, err := client.DeviceInfo(ctx)
+			return [3]int{info.DisplayWidth, info.DisplayHeight, info.SdkInt}, err
+		}, [3]int{1080, 2400, 34}, ""},
+		{"exist", func() (any, error) { return client.Exist(ctx, U2Selector{Text: "OK"}) }, true, ""},
+		{"not existing", func() (any, error) { return client.Exist(ctx, U2Selector{Text: "Cancel"}) }, false, ""},
+		{"rpc error", func() (any, error) {
+			_, err := client.ObjInfo(ctx, U2Selector{Text: "nope"})
+			return nil, err
+		}, nil, "u2 objInfo: -32001 UiObjectNotFoundException"},
+		{"unknown method", func() (any, error) { return nil, client.PressKey(ctx, "home") }, nil, "u2 pressKey: -32601 Method not found: pressKey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var rpcErr *RPCError
+	if _, err := client.ObjInfo(ctx, U2Selector{}); !errors.As(err, &rpcErr) || rpcErr.Method != "objInfo" || rpcErr.Code != -32001 {
+		t.Errorf("ObjInfo() error = %#v, want *RPCError of objInfo", err)
+	}
+
+	if calls := fake.Calls(); len(calls) == 0 || calls[0] != "ping" {
+		t.Errorf("Calls() = %q", calls)
+	}
+}
+
+func TestU2ClientInvalidResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		wantErr string
+	}{
+		{"id mismatch", `{"jsonrpc":"2.0","id":99,"result":true}`, http.StatusOK, "does not match request id"},
+		{"not json", `<html>`, http.StatusOK, "invalid response"},
+		{"bad result", `{"jsonrpc":"2.0","id":1,"result":"yes"}`, http.StatusOK, "unexpected result"},
+		{"http error", ``, http.StatusBadGateway, "502 Bad Gateway"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			err := NewU2Client(srv.URL).Click(context.Background(), 0, 0)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Click() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestU2ClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(newFakeU2Server().Handle("waitForIdle", func([]json.RawMessage) (any, error) {
+		<-release
+		return true, nil
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := NewU2Client(srv.URL)
+	client.Timeout = 20 * time.Millisecond
+
+	// Waiting methods get their wait on top of the timeout
+	start := time.Now()
+	err := client.WaitForIdle(context.Background(), 30*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitForIdle() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("WaitForIdle() gave up after %s, before its wait", elapsed)
+	}
+}
+
+func TestDriverU2ThroughExecutor(t *testing.T) {
+	ctx := context.Background()
+
+	fake := newFakeExecutor().
+		On(`^adb forward tcp:0 tcp:\d+$`, "40123\n").Once().
+		On(`^rpc deviceInfo$`, `{"currentPackageName":"com.android.settings","displayWidth":1080}`).
+		OnError(`^rpc objInfo$`, &RPCError{Code: -32001, Message: "UiObjectNotFoundException"})
+	d := newFakeDriver(t, fake)
+
+	info, err := d.U2().DeviceInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.CurrentPackageName != "com.android.settings" || info.DisplayWidth != 1080 {
+		t.Errorf("DeviceInfo() = %+v", info)
+	}
+
+	var rpcErr *RPCError
+	if _, err := d.U2().ObjInfo(ctx, U2Selector{Text: "nope"}); !errors.As(err, &rpcErr) || rpcErr.Method != "objInfo" {
+		t.Errorf("ObjInfo() error = %v, want *RPCError", err)
+	}
+
+	// The forwarding is created once and reused
+	want := []string{"adb forward tcp:0 tcp:9008", "rpc deviceInfo", "rpc objInfo"}
+	calls := fake.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %q, want %q", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("call %d = %q, want %q", i, calls[i], want[i])
+		}
+	}
+}
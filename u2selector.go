@@ -0,0 +1,132 @@
+package driver
+
+import "encoding/json"
+
+// Mask bits telling the UiAutomator server which fields of a selector are set
+const (
+	maskText                  = 0x01
+	maskTextContains          = 0x02
+	maskTextMatches           = 0x04
+	maskTextStartsWith        = 0x08
+	maskClassName             = 0x10
+	maskClassNameMatches      = 0x20
+	maskDescription           = 0x40
+	maskDescriptionContains   = 0x80
+	maskDescriptionMatches    = 0x0100
+	maskDescriptionStartsWith = 0x0200
+	maskCheckable             = 0x0400
+	maskChecked               = 0x0800
+	maskClickable             = 0x1000
+	maskLongClickable         = 0x2000
+	maskScrollable            = 0x4000
+	maskEnabled               = 0x8000
+	maskFocusable             = 0x010000
+	maskFocused               = 0x020000
+	maskSelected              = 0x040000
+	maskPackageName           = 0x080000
+	maskPackageNameMatches    = 0x100000
+	maskResourceID            = 0x200000
+	maskResourceIDMatches     = 0x400000
+	maskIndex                 = 0x800000
+	maskInstance              = 0x01000000
+)
+
+// U2Selector selects UI objects on the UiAutomator server, like an Android UiSelector.
+// Empty strings and nil pointers are left out, set fields must all match.
+// "Matches" fields are Java regular expressions.
+type U2Selector struct {
+	Text                  string
+	TextContains          string
+	TextMatches           string
+	TextStartsWith        string
+	ClassName             string
+	ClassNameMatches      string
+	Description           string
+	DescriptionContains   string
+	DescriptionMatches    string
+	DescriptionStartsWith string
+	Checkable             *bool
+	Checked               *bool
+	Clickable             *bool
+	LongClickable         *bool
+	Scrollable            *bool
+	Enabled               *bool
+	Focusable             *bool
+	Focused               *bool
+	Selected              *bool
+	PackageName           string
+	PackageNameMatches    string
+	ResourceID            string
+	ResourceIDMatches     string
+	Index                 *int        // index among the siblings
+	Instance              *int        // index among the matching objects
+	Child                 *U2Selector // selects a descendant of the matching object instead
+}
+
+// MarshalJSON encodes the selector as expected by the server, with the mask of the set fields
+func (s U2Selector) MarshalJSON() ([]byte, error) {
+	// The server expects the chain of child selectors flattened at the top level
+	relations := []string{}
+	selectors := []any{}
+	for child := s.Child; child != nil; child = child.Child {
+		leaf := *child
+		leaf.Child = nil
+		relations = append(relations, "child")
+		selectors = append(selectors, leaf)
+	}
+
+	fields := map[string]any{
+		"childOrSibling":         relations,
+		"childOrSiblingSelector": selectors,
+	}
+	mask := 0
+
+	setString := func(key string, bit int, value string) {
+		if value != "" {
+			fields[key] = value
+			mask |= bit
+		}
+	}
+	setBool := func(key string, bit int, value *bool) {
+		if value != nil {
+			fields[key] = *value
+			mask |= bit
+		}
+	}
+	setInt := func(key string, bit int, value *int) {
+		if value != nil {
+			fields[key] = *value
+			mask |= bit
+		}
+	}
+
+	setString("text", maskText, s.Text)
+	setString("textContains", maskTextContains, s.TextContains)
+	setString("textMatches", maskTextMatches, s.TextMatches)
+	setString("textStartsWith", maskTextStartsWith, s.TextStartsWith)
+	setString("className", maskClassName, s.ClassName)
+	setString("classNameMatches", maskClassNameMatches, s.ClassNameMatches)
+	setString("description", maskDescription, s.Description)
+	setString("descriptionContains", maskDescriptionContains, s.DescriptionContains)
+	setString("descriptionMatches", maskDescriptionMatches, s.DescriptionMatches)
+	setString("descriptionStartsWith", maskDescriptionStartsWith, s.DescriptionStartsWith)
+	setBool("checkable", maskCheckable, s.Checkable)
+	setBool("checked", maskChecked, s.Checked)
+	setBool("clickable", maskClickable, s.Clickable)
+	setBool("longClickable", maskLongClickable, s.LongClickable)
+	setBool("scrollable", maskScrollable, s.Scrollable)
+	setBool("enabled", maskEnabled, s.Enabled)
+	setBool("focusable", maskFocusable, s.Focusable)
+	setBool("focused", maskFocused, s.Focused)
+	setBool("selected", maskSelected, s.Selected)
+	setString("packageName", maskPackageName, s.PackageName)
+	setString("packageNameMatches", maskPackageNameMatches, s.PackageNameMatches)
+	setString("resourceId", maskResourceID, s.ResourceID)
+	setString("resourceIdMatches", maskResourceIDMatches, s.ResourceIDMatches)
+	setInt("index", maskIndex, s.Index)
+	setInt("instance", maskInstance, s.Instance)
+
+	fields["mask"] = mask
+
+	return json.Marshal(fields)
+}
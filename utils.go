@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,28 +21,46 @@ type Requester struct {
 	Method  string            // The HTTP method to use (e.g., GET, POST).
 	Headers map[string]string // A map of headers to include in the request.
 	Data    interface{}       // The data to send with the request, if any.
+	Client  *http.Client      // The client sending the request, nil for the default one.
 }
 
-var (
+// defaultClient is the HTTP client of requests made without a Driver,
+// resolving names with the DNS server of DefaultConfig.
+var defaultClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{Transport: newTransport(DefaultConfig().DNSServer)}
+})
+
+// newTransport creates an HTTP transport resolving names with the given DNS server.
+// Parameters:
+//   - dnsServer: DNS server address (host:port), empty for the system resolver.
+//
+// Returns:
+//   - *http.Transport: The transport.
+func newTransport(dnsServer string) *http.Transport {
 	// dialer is a custom net.Dialer with specific timeout and resolver settings.
-	dialer = &net.Dialer{
+	dialer := &net.Dialer{
 		Timeout:   30 * time.Second, // Connection timeout duration.
 		KeepAlive: 30 * time.Second, // Keep-alive period for the connection.
-		Resolver: &net.Resolver{
+	}
+
+	if dnsServer != "" {
+		dialer.Resolver = &net.Resolver{
 			PreferGo: true, // Prefer Go's built-in DNS resolver.
 			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
 				d := net.Dialer{}
-				return d.DialContext(ctx, "udp", "114.114.114.114:53") // Custom DNS server.
+				return d.DialContext(ctx, "udp", dnsServer) // Custom DNS server.
 			},
-		},
+		}
 	}
-	// transport is an HTTP transport that uses the custom dialer.
-	transport = &http.Transport{
+
+	return &http.Transport{
 		DialContext: dialer.DialContext,
 	}
-)
+}
 
 // Request sends an HTTP request based on the provided Requester options.
+// Without a Client, names are resolved with the DNS server of DefaultConfig,
+// use Driver.Request to follow the settings of a driver.
 // Parameters:
 //   - opt: A pointer to a Requester struct containing request details.
 //
@@ -49,6 +68,18 @@ var (
 //   - map[string]any: A map containing the response data if successful.
 //   - error: An error object if the request fails.
 func Request(opt *Requester) (map[string]any, error) {
+	return RequestContext(context.Background(), opt)
+}
+
+// RequestContext sends an HTTP request like Request, aborting it when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the request lifetime.
+//   - opt: A pointer to a Requester struct containing request details.
+//
+// Returns:
+//   - map[string]any: A map containing the response data if successful.
+//   - error: An error object if the request fails.
+func RequestContext(ctx context.Context, opt *Requester) (map[string]any, error) {
 	var res = make(map[string]any)
 
 	var data []byte
@@ -59,7 +90,7 @@ func Request(opt *Requester) (map[string]any, error) {
 		}
 	}
 
-	req, err := http.NewRequest(opt.Method, opt.Url, bytes.NewBuffer(data))
+	req, err := http.NewRequestWithContext(ctx, opt.Method, opt.Url, bytes.NewBuffer(data))
 	if err != nil {
 		return nil, err
 	}
@@ -79,9 +110,9 @@ func Request(opt *Requester) (map[string]any, error) {
 		}
 	}
 
-	// Create an HTTP client with the custom transport.
-	client := &http.Client{
-		Transport: transport,
+	client := opt.Client
+	if client == nil {
+		client = defaultClient()
 	}
 
 	// Send the HTTP request.
@@ -107,6 +138,36 @@ func Request(opt *Requester) (map[string]any, error) {
 	return nil, errors.New(resp.Status)
 }
 
+// Request sends an HTTP request like the Request function, with the HTTP
+// client of the driver, which resolves names with Config.DNSServer.
+// Parameters:
+//   - opt: A pointer to a Requester struct containing request details.
+//
+// Returns:
+//   - map[string]any: A map containing the response data if successful.
+//   - error: An error object if the request fails.
+func (d *Driver) Request(opt *Requester) (map[string]any, error) {
+	return d.RequestContext(context.Background(), opt)
+}
+
+// RequestContext sends an HTTP request like Request, aborting it when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the request lifetime.
+//   - opt: A pointer to a Requester struct containing request details.
+//
+// Returns:
+//   - map[string]any: A map containing the response data if successful.
+//   - error: An error object if the request fails.
+func (d *Driver) RequestContext(ctx context.Context, opt *Requester) (map[string]any, error) {
+	if opt.Client == nil {
+		withClient := *opt
+		withClient.Client = d.http
+		opt = &withClient
+	}
+
+	return RequestContext(ctx, opt)
+}
+
 // DownloadFile downloads a file from the specified URL and saves it to the given path.
 // For non-Android systems, it first downloads to a temporary location and then pushes to device.
 // Parameters:
@@ -116,13 +177,25 @@ func Request(opt *Requester) (map[string]any, error) {
 // Returns:
 //   - error: nil if successful, otherwise contains error details
 func (d *Driver) DownloadFile(url string, filepath string) error {
+	return d.DownloadFileContext(context.Background(), url, filepath)
+}
+
+// DownloadFileContext downloads a file like DownloadFile, aborting when ctx is done.
+// Parameters:
+//   - ctx: Context controlling the download and the push to device
+//   - url: The URL of the file to download
+//   - filepath: The destination path where the file should be saved
+//
+// Returns:
+//   - error: nil if successful, otherwise contains error details
+func (d *Driver) DownloadFileContext(ctx context.Context, url string, filepath string) error {
 	filepathParts := strings.Split(filepath, "/")
 	filepath = strings.Join(filepathParts[:len(filepathParts)-1], "/")
 	originalFilepath := filepath
 	filename := filepathParts[len(filepathParts)-1]
 
 	if d.os != "android" {
-		filepath = TEMP_PATH + filepath
+		filepath = d.config.TempPath + filepath
 	}
 
 	if !DirExists(filepath) {
@@ -133,13 +206,20 @@ func (d *Driver) DownloadFile(url string, filepath string) error {
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	defer func() {
+		out.Close()
+		// Off device the local file is only staged for the push
+		if d.os != "android" {
+			os.Remove(out.Name())
+		}
+	}()
 
-	client := &http.Client{
-		Transport: transport,
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
 	}
 
-	res, err := client.Get(url)
+	res, err := d.http.Do(req)
 	if err != nil {
 		return err
 	}
@@ -155,11 +235,12 @@ func (d *Driver) DownloadFile(url string, filepath string) error {
 	}
 
 	if d.os != "android" {
-		if !d.FileExists(originalFilepath) {
-			d.CreateDir(originalFilepath)
+		out.Close()
+
+		if !d.FileExistsContext(ctx, originalFilepath) {
+			d.CreateDirContext(ctx, originalFilepath)
 		}
-		_, err = d.Run("push", filepath+"/"+filename, originalFilepath)
-		d.DeleteFile(filepath + "/" + filename)
+		err = d.Push(ctx, filepath+"/"+filename, originalFilepath, nil)
 	}
 
 	return err
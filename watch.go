@@ -0,0 +1,223 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// StateRemoved is reported for a device that is no longer listed by adb
+const StateRemoved = "removed"
+
+// DeviceEventType is the kind of change reported by WatchDevices
+type DeviceEventType string
+
+const (
+	DeviceAdded        DeviceEventType = "added"         // device appeared
+	DeviceRemoved      DeviceEventType = "removed"       // device disappeared
+	DeviceStateChanged DeviceEventType = "state-changed" // device state changed, e.g. unauthorized -> device
+)
+
+// DeviceEvent is a change of the device list
+type DeviceEvent struct {
+	Type     DeviceEventType // kind of change
+	Device   DeviceInfo      // device after the change, last known info when removed
+	OldState string          // state before the change, empty when added
+}
+
+// deviceTracker is implemented by executors that can follow the device list
+// as it changes instead of being polled
+type deviceTracker interface {
+	// TrackDevices calls fn with the current device list and then with every
+	// new list, until ctx is done or tracking fails
+	TrackDevices(ctx context.Context, fn func([]DeviceInfo)) error
+}
+
+// errTrackingUnsupported is returned by TrackDevices of executors wrapping one
+// that cannot track devices
+var errTrackingUnsupported = errors.New("device tracking unsupported")
+
+// canTrackDevices reports whether an executor can follow the device list,
+// looking through a Recorder
+func canTrackDevices(e Executor) bool {
+	if r, ok := e.(*Recorder); ok {
+		return canTrackDevices(r.inner)
+	}
+
+	_, ok := e.(deviceTracker)
+	return ok
+}
+
+// WatchDevices reports devices being plugged, unplugged or changing state.
+// The devices present when watching starts are reported as added.
+// The device list is followed with "host:track-devices" when the executor
+// supports it, and polled otherwise.
+// Parameters:
+//   - ctx: context controlling the watch, the channel is closed when it is done
+//
+// Returns:
+//   - <-chan DeviceEvent: the events, in order
+func (d *Driver) WatchDevices(ctx context.Context) <-chan DeviceEvent {
+	events := make(chan DeviceEvent)
+
+	go func() {
+		defer close(events)
+
+		known := make(map[string]DeviceInfo)
+		d.trackDevices(ctx, func(devices []DeviceInfo) {
+			for _, event := range diffDevices(known, devices) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}()
+
+	return events
+}
+
+// trackDevices calls fn with every device list until ctx is done, reconnecting
+// to the tracking stream when it breaks and polling when it is not supported
+func (d *Driver) trackDevices(ctx context.Context, fn func([]DeviceInfo)) {
+	for ctx.Err() == nil {
+		if tracker, ok := d.executor.(deviceTracker); ok && canTrackDevices(d.executor) {
+			if tracker.TrackDevices(ctx, fn) != nil && ctx.Err() == nil {
+				// The server went away, report every device as removed until it is back
+				fn(nil)
+			}
+		} else if devices, err := d.DevicesContext(ctx); err == nil {
+			fn(devices)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.config.PollInterval):
+		}
+	}
+}
+
+// diffDevices turns a new device list into events and updates known accordingly
+func diffDevices(known map[string]DeviceInfo, devices []DeviceInfo) []DeviceEvent {
+	var events []DeviceEvent
+
+	current := make(map[string]bool, len(devices))
+	for _, info := range devices {
+		current[info.Serial] = true
+
+		old, ok := known[info.Serial]
+		switch {
+		case !ok:
+			events = append(events, DeviceEvent{Type: DeviceAdded, Device: info})
+		case old.State != info.State:
+			events = append(events, DeviceEvent{Type: DeviceStateChanged, Device: info, OldState: old.State})
+		}
+		known[info.Serial] = info
+	}
+
+	for serial, info := range known {
+		if !current[serial] {
+			events = append(events, DeviceEvent{Type: DeviceRemoved, Device: info, OldState: info.State})
+			delete(known, serial)
+		}
+	}
+
+	return events
+}
+
+// deviceWatch follows the state of the connected device
+type deviceWatch struct {
+	cancel context.CancelFunc // stops the watch
+
+	mu    sync.Mutex
+	state string        // last known state of the device
+	gone  chan struct{} // closed when the device stops being ready
+}
+
+// watchDevice starts following the state of the connected device, replacing
+// any previous watch. It needs an executor able to track devices, so that
+// no polling commands are sent to fake or replayed executors.
+func (d *Driver) watchDevice(info DeviceInfo) {
+	d.unwatchDevice()
+
+	if !canTrackDevices(d.executor) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &deviceWatch{cancel: cancel, state: info.State, gone: make(chan struct{})}
+	if old := d.watch.Swap(w); old != nil {
+		old.cancel()
+	}
+
+	go func() {
+		for event := range d.WatchDevices(ctx) {
+			if event.Device.Serial != info.Serial {
+				continue
+			}
+
+			state := event.Device.State
+			if event.Type == DeviceRemoved {
+				state = StateRemoved
+			}
+			w.setState(state)
+		}
+	}()
+}
+
+// unwatchDevice stops following the connected device
+func (d *Driver) unwatchDevice() {
+	if w := d.watch.Swap(nil); w != nil {
+		w.cancel()
+	}
+}
+
+// setState records a new device state, signalling the device going away
+func (w *deviceWatch) setState(state string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wasReady := w.state == StateDevice
+	w.state = state
+
+	if wasReady && state != StateDevice {
+		close(w.gone)
+	} else if !wasReady && state == StateDevice {
+		w.gone = make(chan struct{})
+	}
+}
+
+// DeviceState returns the last known state of the connected device,
+// e.g. StateDevice, StateOffline or StateRemoved.
+// It is only followed on PC with the default executor, otherwise it is empty.
+// Returns:
+//   - string: the device state
+func (d *Driver) DeviceState() string {
+	w := d.watch.Load()
+	if w == nil {
+		return ""
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.state
+}
+
+// DeviceGone returns a channel closed when the connected device is unplugged
+// or stops being ready. Once the device is back, a new channel is returned.
+// Returns:
+//   - <-chan struct{}: the channel, nil if the device state is not followed
+func (d *Driver) DeviceGone() <-chan struct{} {
+	w := d.watch.Load()
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.gone
+}
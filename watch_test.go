@@ -0,0 +1,73 @@
+package driver
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestDiffDevices(t *testing.T) {
+	known := make(map[string]DeviceInfo)
+
+	steps := []struct {
+		name    string
+		devices []DeviceInfo
+		want    []DeviceEvent
+	}{
+		{
+			name:    "plugged",
+			devices: []DeviceInfo{{Serial: "a", State: StateUnauthorized}},
+			want:    []DeviceEvent{{Type: DeviceAdded, Device: DeviceInfo{Serial: "a", State: StateUnauthorized}}},
+		},
+		{
+			name:    "authorized",
+			devices: []DeviceInfo{{Serial: "a", State: StateDevice}},
+			want:    []DeviceEvent{{Type: DeviceStateChanged, Device: DeviceInfo{Serial: "a", State: StateDevice}, OldState: StateUnauthorized}},
+		},
+		{
+			name:    "unchanged",
+			devices: []DeviceInfo{{Serial: "a", State: StateDevice}},
+		},
+		{
+			name: "unplugged",
+			want: []DeviceEvent{{Type: DeviceRemoved, Device: DeviceInfo{Serial: "a", State: StateDevice}, OldState: StateDevice}},
+		},
+	}
+
+	for _, step := range steps {
+		got := diffDevices(known, step.devices)
+		if len(got) != len(step.want) {
+			t.Fatalf("%s: events = %+v, want %+v", step.name, got, step.want)
+		}
+		for i := range got {
+			if got[i] != step.want[i] {
+				t.Errorf("%s: event %d = %+v, want %+v", step.name, i, got[i], step.want[i])
+			}
+		}
+	}
+}
+
+func TestWatchDeviceConcurrentAccess(t *testing.T) {
+	inner := &trackingExecutor{fakeExecutor: newFakeExecutor(), devices: []DeviceInfo{{Serial: "emulator-5554", State: StateDevice}}}
+	d := New(WithExecutor(inner))
+	defer d.unwatchDevice()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				d.watchDevice(DeviceInfo{Serial: "emulator-5554", State: StateDevice})
+				d.unwatchDevice()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				d.DeviceState()
+				d.DeviceGone()
+			}
+		}()
+	}
+	wg.Wait()
+}
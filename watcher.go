@@ -0,0 +1,314 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WatchAction handles a node matched by a watcher, e.g. WatchTap or WatchBack
+type WatchAction func(ctx context.Context, d *Driver, el Element) error
+
+// WatchTap taps the matched node, e.g. the "Allow" button of a permission prompt
+func WatchTap(ctx context.Context, d *Driver, el Element) error {
+	return el.TapContext(ctx)
+}
+
+// WatchBack presses the back key, e.g. to dismiss a "rate this app" dialog
+func WatchBack(ctx context.Context, d *Driver, el Element) error {
+	if !d.BackContext(ctx) {
+		return errors.New("watcher: back key failed")
+	}
+	return nil
+}
+
+// watcherRounds bounds the actions run on one snapshot, so that a watcher
+// whose action does not dismiss its node cannot loop forever
+const watcherRounds = 3
+
+// watcher is a node to handle whenever it shows up
+type watcher struct {
+	name   string      // name given to Watch
+	locate Locator     // node to look for
+	action WatchAction // what to do with the node
+	count  int         // number of times the action succeeded
+	err    error       // error of the last action, nil if it succeeded
+}
+
+// watcherSet is the watcher registry of a driver
+type watcherSet struct {
+	check sync.Mutex // serializes checks, so that a node is only handled once
+
+	mu       sync.Mutex
+	watchers []*watcher         // in registration order
+	paused   bool               // checks are skipped while paused
+	cancel   context.CancelFunc // stops the background loop, nil if not started
+	done     chan struct{}      // closed when the background loop returns
+}
+
+// watchingKey marks contexts of watcher checks, whose element waits must not run the watchers again
+type watchingKey struct{}
+
+// Watch registers a watcher handling a node whenever it shows up, e.g. a
+// permission prompt or an update dialog randomly breaking a flow.
+// Every screen dumped by WaitElement is checked, so that it goes on once the
+// node is handled, and StartWatchers also checks the screen in the background.
+// Document and FindElement never run watchers, the snapshot they return is
+// left as it is. Watchers are tried in registration order.
+// Parameters:
+//   - name: name of the watcher, replacing any watcher with the same name,
+//     whose count goes on
+//   - locator: node to look for, a By, a Query or an XPath, timeouts being ignored
+//   - action: what to do with the node, e.g. WatchTap or WatchBack
+//
+// Returns:
+//   - error: ErrSelectorEmpty if the locator is empty, or why it is invalid,
+//     e.g. a bad Regex or an *XPathError; an expression failing on a screen,
+//     e.g. selecting texts, is reported by WatcherErrors
+func (d *Driver) Watch(name string, locator Locator, action WatchAction) error {
+	if isEmptyLocator(locator) {
+		return ErrSelectorEmpty
+	}
+	if err := locatorError(locator); err != nil {
+		return err
+	}
+
+	w := &d.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, old := range w.watchers {
+		if old.name == name {
+			w.watchers[i] = &watcher{name: name, locate: locator, action: action, count: old.count}
+			return nil
+		}
+	}
+
+	w.watchers = append(w.watchers, &watcher{name: name, locate: locator, action: action})
+	return nil
+}
+
+// Unwatch removes a watcher
+// Parameters:
+//   - name: name of the watcher
+func (d *Driver) Unwatch(name string) {
+	w := &d.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i, old := range w.watchers {
+		if old.name == name {
+			w.watchers = append(w.watchers[:i], w.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+// WatcherCounts returns how many times each watcher handled its node,
+// failed actions being left out, see WatcherErrors
+// Returns:
+//   - map[string]int: the counts, by watcher name
+func (d *Driver) WatcherCounts() map[string]int {
+	w := &d.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	counts := make(map[string]int, len(w.watchers))
+	for _, watcher := range w.watchers {
+		counts[watcher.name] = watcher.count
+	}
+	return counts
+}
+
+// WatcherErrors returns the errors of the watchers whose last action failed,
+// e.g. a tap on a node gone meanwhile. The error is forgotten once an action
+// of the watcher succeeds.
+// Returns:
+//   - map[string]error: the errors, by watcher name, empty if no action failed
+func (d *Driver) WatcherErrors() map[string]error {
+	w := &d.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	errs := make(map[string]error)
+	for _, watcher := range w.watchers {
+		if watcher.err != nil {
+			errs[watcher.name] = watcher.err
+		}
+	}
+	return errs
+}
+
+// PauseWatchers suspends the watchers, both in element waits and in the background,
+// e.g. while a flow expects one of the watched nodes
+func (d *Driver) PauseWatchers() {
+	d.watchers.mu.Lock()
+	defer d.watchers.mu.Unlock()
+
+	d.watchers.paused = true
+}
+
+// ResumeWatchers resumes the watchers suspended by PauseWatchers
+func (d *Driver) ResumeWatchers() {
+	d.watchers.mu.Lock()
+	defer d.watchers.mu.Unlock()
+
+	d.watchers.paused = false
+}
+
+// StartWatchers checks the screen for watched nodes in the background,
+// in addition to element waits, until StopWatchers or Cleanup
+// Parameters:
+//   - interval: time between two checks, Config.PollInterval if zero
+func (d *Driver) StartWatchers(interval time.Duration) {
+	if interval <= 0 {
+		interval = d.config.PollInterval
+	}
+
+	d.StopWatchers()
+
+	ctx, cancel := context.WithCancel(withWatching(context.Background()))
+	done := make(chan struct{})
+
+	w := &d.watchers
+	w.mu.Lock()
+	w.cancel = cancel
+	w.done = done
+	w.mu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+
+			// Leave the screen to a check already running on a snapshot
+			if !w.check.TryLock() {
+				continue
+			}
+			if !w.isIdle() {
+				if doc := d.DocumentContext(ctx); doc != nil {
+					d.runWatchers(ctx, doc)
+				}
+			}
+			w.check.Unlock()
+		}
+	}()
+}
+
+// StopWatchers stops the background checks started by StartWatchers and waits
+// for a running action to complete, so it must not be called from a WatchAction.
+// Registered watchers keep checking the screens of element waits.
+func (d *Driver) StopWatchers() {
+	w := &d.watchers
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel, w.done = nil, nil
+	w.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// withWatching returns a context whose element waits do not run the watchers
+func withWatching(ctx context.Context) context.Context {
+	return context.WithValue(ctx, watchingKey{}, true)
+}
+
+// isWatching reports whether ctx was created by withWatching
+func isWatching(ctx context.Context) bool {
+	watching, _ := ctx.Value(watchingKey{}).(bool)
+	return watching
+}
+
+// isIdle reports whether there is nothing to check, without watchers or while paused
+func (w *watcherSet) isIdle() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.paused || len(w.watchers) == 0
+}
+
+// watchDocument runs the watchers on a snapshot of an element wait and returns
+// the snapshot to use instead, taken again after an action changed the screen
+func (d *Driver) watchDocument(ctx context.Context, doc *Document) *Document {
+	w := &d.watchers
+	if isWatching(ctx) || w.isIdle() {
+		return doc
+	}
+
+	ctx = withWatching(ctx)
+
+	// Another check is running, e.g. an action taking a snapshot itself
+	if !w.check.TryLock() {
+		return doc
+	}
+	defer w.check.Unlock()
+
+	for round := 0; round < watcherRounds && doc != nil; round++ {
+		if !d.runWatchers(ctx, doc) {
+			return doc
+		}
+		doc = d.DocumentContext(ctx)
+	}
+
+	return doc
+}
+
+// runWatchers runs the action of the first watcher whose node is in the snapshot,
+// counting it if it succeeds and keeping its error otherwise
+// Returns:
+//   - bool: true if an action was run, even a failed one, as it may have changed the screen
+func (d *Driver) runWatchers(ctx context.Context, doc *Document) bool {
+	w := &d.watchers
+
+	w.mu.Lock()
+	if w.paused {
+		w.mu.Unlock()
+		return false
+	}
+	watchers := append([]*watcher(nil), w.watchers...)
+	w.mu.Unlock()
+
+	for _, watcher := range watchers {
+		el, err := doc.FindElement(watcher.locate)
+		if err != nil {
+			// An expression failing on this screen, e.g. selecting texts, is reported
+			if !errors.Is(err, ErrElementNotFound) {
+				w.record(watcher.name, err)
+			}
+			continue
+		}
+
+		w.record(watcher.name, watcher.action(ctx, d, el))
+
+		return true
+	}
+
+	return false
+}
+
+// record counts a successful action of a watcher or keeps its error. The
+// result goes to the watcher registered under the name, which may have been
+// replaced while the action ran, and is dropped if it was removed.
+func (w *watcherSet) record(name string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, watcher := range w.watchers {
+		if watcher.name == name {
+			watcher.err = err
+			if err == nil {
+				watcher.count++
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// newTestDocument parses a hierarchy into a document of d
+func newTestDocument(t *testing.T, d *Driver, xml string) *Document {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xml); err != nil {
+		t.Fatal(err)
+	}
+	return &Document{d: d, RawXML: xml, root: &doc.Element}
+}
+
+func TestRunWatchers(t *testing.T) {
+	ctx := withWatching(context.Background())
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, lookupHierarchy)
+
+	failed := errors.New("node gone")
+	var actionErr error
+	action := func(context.Context, *Driver, Element) error { return actionErr }
+
+	label := HasResourceID(Eq("app:id/label"))
+	d.Watch("label", label, action)
+	d.Watch("missing", HasText(Eq("Update")), action)
+
+	tests := []struct {
+		name      string
+		err       error
+		wantCount int
+	}{
+		{"success", nil, 1},
+		{"failure", failed, 1},
+		{"success again", nil, 2},
+	}
+
+	for _, tt := range tests {
+		actionErr = tt.err
+		if !d.runWatchers(ctx, doc) {
+			t.Fatalf("%s: runWatchers() = false, want the action run", tt.name)
+		}
+
+		if got := d.WatcherCounts()["label"]; got != tt.wantCount {
+			t.Errorf("%s: count = %d, want %d", tt.name, got, tt.wantCount)
+		}
+		if got := d.WatcherErrors()["label"]; got != tt.err {
+			t.Errorf("%s: error = %v, want %v", tt.name, got, tt.err)
+		}
+	}
+
+	if _, ok := d.WatcherErrors()["missing"]; ok {
+		t.Error("WatcherErrors() reports a watcher whose node never showed up")
+	}
+
+	// Replacing a watcher keeps its count
+	d.Watch("label", label, WatchBack)
+	if got := d.WatcherCounts()["label"]; got != 2 {
+		t.Errorf("count after replacing = %d, want 2", got)
+	}
+
+	d.Unwatch("label")
+	d.Watch("label", label, action)
+	if got := d.WatcherCounts()["label"]; got != 0 {
+		t.Errorf("count after Unwatch and Watch = %d, want 0", got)
+	}
+}
+
+func TestWatcherReplacedWhileRunning(t *testing.T) {
+	ctx := withWatching(context.Background())
+	d := New(WithExecutor(newFakeExecutor()))
+	doc := newTestDocument(t, d, lookupHierarchy)
+
+	label := HasResourceID(Eq("app:id/label"))
+	d.Watch("label", label, func(context.Context, *Driver, Element) error {
+		// The result goes to the watcher replacing this one
+		d.Watch("label", label, WatchTap)
+		return nil
+	})
+
+	d.runWatchers(ctx, doc)
+	if got := d.WatcherCounts()["label"]; got != 1 {
+		t.Errorf("count = %d, want 1", got)
+	}
+
+	failed := errors.New("node gone")
+	d.Watch("label", label, func(context.Context, *Driver, Element) error {
+		d.Watch("label", label, WatchTap)
+		return failed
+	})
+	d.runWatchers(ctx, doc)
+	if got := d.WatcherErrors()["label"]; got != failed {
+		t.Errorf("error = %v, want %v", got, failed)
+	}
+
+	// The result of a removed watcher is dropped
+	d.Watch("label", label, func(context.Context, *Driver, Element) error {
+		d.Unwatch("label")
+		return nil
+	})
+	d.runWatchers(ctx, doc)
+	if counts := d.WatcherCounts(); len(counts) != 0 {
+		t.Errorf("counts = %v, want none", counts)
+	}
+}
+
+func TestWatchersRunInWaits(t *testing.T) {
+	d, _ := newLookupDriver(t, lookupHierarchy)
+
+	runs := 0
+	d.Watch("label", HasResourceID(Eq("app:id/label")), func(context.Context, *Driver, Element) error {
+		runs++
+		return nil
+	})
+
+	doc := d.Document()
+	if doc == nil {
+		t.Fatal("Document() = nil")
+	}
+	if _, err := doc.FindElement(HasResourceID(Eq("app:id/form"))); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 0 {
+		t.Errorf("Document() ran the watcher %d times, want none", runs)
+	}
+
+	if _, err := d.WaitElement(HasResourceID(Eq("app:id/form"))); err != nil {
+		t.Fatal(err)
+	}
+	if runs == 0 {
+		t.Error("WaitElement() did not run the watcher")
+	}
+}
@@ -0,0 +1,203 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// WirelessError represents a failed network debugging operation
+type WirelessError struct {
+	Op      string // operation: pair, connect, disconnect or tcpip
+	Addr    string // device address (host:port) or port for tcpip
+	Message string // message reported by adb
+	Err     error  // sentinel error classifying the failure
+}
+
+// Error implements the error interface
+func (e *WirelessError) Error() string {
+	return fmt.Sprintf("adb %s %s: %s", e.Op, e.Addr, e.Message)
+}
+
+// Unwrap returns the sentinel error classifying the failure, e.g. ErrPairingFailed
+func (e *WirelessError) Unwrap() error {
+	return e.Err
+}
+
+// Pair pairs with a device using Android 11+ wireless debugging.
+// The address and code are shown in "Wireless debugging > Pair device with pairing code".
+// Parameters:
+//   - hostport: pairing address of the device (host:port)
+//   - code: six digit pairing code
+//
+// Returns:
+//   - error: nil if successful, otherwise a *WirelessError wrapping ErrPairingFailed,
+//     or the transport error
+func (d *Driver) Pair(hostport, code string) error {
+	return d.PairContext(context.Background(), hostport, code)
+}
+
+// PairContext pairs with a device like Pair, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the pairing
+//   - hostport: pairing address of the device (host:port)
+//   - code: six digit pairing code
+//
+// Returns:
+//   - error: same errors as Pair, or ctx.Err() if ctx is done
+func (d *Driver) PairContext(ctx context.Context, hostport, code string) error {
+	msg, err := d.wireless(ctx, "", "pair", hostport, code)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(msg, "Successfully paired") {
+		return &WirelessError{Op: "pair", Addr: hostport, Message: msg, Err: ErrPairingFailed}
+	}
+
+	return nil
+}
+
+// ConnectTCP connects adb to a device over the network and then connects the
+// driver to it like Connect, so that it can be used like a USB device
+// Parameters:
+//   - hostport: address of the device (host:port), port 5555 if omitted
+//
+// Returns:
+//   - error: nil if successful, otherwise a *WirelessError wrapping ErrConnectFailed
+//     or ErrDeviceUnauthorized, or the errors of Connect
+func (d *Driver) ConnectTCP(hostport string) error {
+	return d.ConnectTCPContext(context.Background(), hostport)
+}
+
+// ConnectTCPContext connects to a network device like ConnectTCP, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the connection and initialization
+//   - hostport: address of the device (host:port), port 5555 if omitted
+//
+// Returns:
+//   - error: same errors as ConnectTCP, or ctx.Err() if ctx is done
+func (d *Driver) ConnectTCPContext(ctx context.Context, hostport string) error {
+	addr := withDefaultPort(hostport)
+
+	msg, err := d.wireless(ctx, "", "connect", addr)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(msg, "connected to"), strings.HasPrefix(msg, "already connected to"):
+	case strings.Contains(msg, "authenticate"):
+		return &WirelessError{Op: "connect", Addr: addr, Message: msg, Err: ErrDeviceUnauthorized}
+	default:
+		return &WirelessError{Op: "connect", Addr: addr, Message: msg, Err: ErrConnectFailed}
+	}
+
+	// The device shows up offline until the connection handshake completes
+	if _, err := d.waitSerial(ctx, addr, d.config.WaitTimeout); err != nil {
+		return err
+	}
+
+	return d.ConnectWhereContext(ctx, MatchSerial(addr))
+}
+
+// Disconnect disconnects adb from a network device
+// Parameters:
+//   - hostport: address of the device (host:port), port 5555 if omitted,
+//     empty to disconnect every network device
+//
+// Returns:
+//   - error: nil if successful, otherwise a *WirelessError wrapping ErrDeviceNotFound,
+//     or the transport error
+func (d *Driver) Disconnect(hostport string) error {
+	return d.DisconnectContext(context.Background(), hostport)
+}
+
+// DisconnectContext disconnects a network device like Disconnect, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//   - hostport: address of the device (host:port), port 5555 if omitted,
+//     empty to disconnect every network device
+//
+// Returns:
+//   - error: same errors as Disconnect, or ctx.Err() if ctx is done
+func (d *Driver) DisconnectContext(ctx context.Context, hostport string) error {
+	args := []string{"disconnect"}
+	addr := ""
+	if hostport != "" {
+		addr = withDefaultPort(hostport)
+		args = append(args, addr)
+	}
+
+	msg, err := d.wireless(ctx, "", args...)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(msg, "disconnected") {
+		return &WirelessError{Op: "disconnect", Addr: addr, Message: msg, Err: ErrDeviceNotFound}
+	}
+
+	if addr == "" || addr == d.device {
+		d.unwatchDevice()
+	}
+
+	return nil
+}
+
+// EnableTCPIP restarts adbd on the connected device listening on a TCP port,
+// so that it can then be reached with ConnectTCP
+// Parameters:
+//   - port: TCP port, usually 5555
+//
+// Returns:
+//   - error: nil if successful, otherwise a *WirelessError wrapping ErrTCPIPFailed,
+//     or the transport error
+func (d *Driver) EnableTCPIP(port int) error {
+	return d.EnableTCPIPContext(context.Background(), port)
+}
+
+// EnableTCPIPContext enables TCP/IP debugging like EnableTCPIP, stopping when ctx is done
+// Parameters:
+//   - ctx: context controlling the request
+//   - port: TCP port, usually 5555
+//
+// Returns:
+//   - error: same errors as EnableTCPIP, or ctx.Err() if ctx is done
+func (d *Driver) EnableTCPIPContext(ctx context.Context, port int) error {
+	msg, err := d.wireless(ctx, d.device, "tcpip", strconv.Itoa(port))
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(msg, "restarting") {
+		return &WirelessError{Op: "tcpip", Addr: strconv.Itoa(port), Message: msg, Err: ErrTCPIPFailed}
+	}
+
+	return nil
+}
+
+// wireless runs an adb host command and returns its output, failures
+// being reported in the output like the adb binary does
+func (d *Driver) wireless(ctx context.Context, serial string, args ...string) (string, error) {
+	res, err := d.executor.Host(ctx, serial, args...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+
+	return strings.TrimPrefix(res.Output(), "error: "), nil
+}
+
+// withDefaultPort appends the default adb port to an address without one
+func withDefaultPort(hostport string) string {
+	if _, _, err := net.SplitHostPort(hostport); err == nil {
+		return hostport
+	}
+
+	return net.JoinHostPort(hostport, "5555")
+}
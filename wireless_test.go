@@ -0,0 +1,156 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// newAdbDriver creates a driver connected to emulator-5554 through a fake ADB server
+func newAdbDriver(t *testing.T, server *fakeAdbServer) *Driver {
+	t.Helper()
+
+	d := New(WithAdbServer(server.listener.Addr().String()))
+	d.device = "emulator-5554"
+
+	return d
+}
+
+// onFail answers a request with a FAIL response
+func (s *fakeAdbServer) onFail(req, message string) *fakeAdbServer {
+	return s.on(req, func(t *testing.T, conn net.Conn, _ string) {
+		fmt.Fprintf(conn, "FAIL%04x%s", len(message), message)
+	})
+}
+
+func TestWireless(t *testing.T) {
+	tests := []struct {
+		name    string
+		op      func(d *Driver) error
+		req     string
+		reply   string
+		fail    bool
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:  "paired",
+			op:    func(d *Driver) error { return d.Pair("10.0.0.2:37000", "123456") },
+			req:   "host:pair:123456:10.0.0.2:37000",
+			reply: "Successfully paired to 10.0.0.2:37000 [guid=adb-R5CT-x]",
+		},
+		{
+			name:    "wrong pairing code",
+			op:      func(d *Driver) error { return d.Pair("10.0.0.2:37000", "000000") },
+			req:     "host:pair:000000:10.0.0.2:37000",
+			reply:   "Failed: Wrong password or connection was dropped.",
+			wantErr: ErrPairingFailed,
+			wantMsg: "Failed: Wrong password or connection was dropped.",
+		},
+		{
+			name:    "pairing refused by the server",
+			op:      func(d *Driver) error { return d.Pair("10.0.0.2:37000", "123456") },
+			req:     "host:pair:123456:10.0.0.2:37000",
+			reply:   "unable to start pairing client.",
+			fail:    true,
+			wantErr: ErrPairingFailed,
+			wantMsg: "unable to start pairing client.",
+		},
+		{
+			name:    "connection refused",
+			op:      func(d *Driver) error { return d.ConnectTCP("10.0.0.2") },
+			req:     "host:connect:10.0.0.2:5555",
+			reply:   "failed to connect to '10.0.0.2:5555': Connection refused",
+			wantErr: ErrConnectFailed,
+			wantMsg: "failed to connect to '10.0.0.2:5555': Connection refused",
+		},
+		{
+			name:    "connection unauthorized",
+			op:      func(d *Driver) error { return d.ConnectTCP("10.0.0.2:5555") },
+			req:     "host:connect:10.0.0.2:5555",
+			reply:   "failed to authenticate to 10.0.0.2:5555",
+			wantErr: ErrDeviceUnauthorized,
+			wantMsg: "failed to authenticate to 10.0.0.2:5555",
+		},
+		{
+			name:  "disconnected",
+			op:    func(d *Driver) error { return d.Disconnect("10.0.0.2") },
+			req:   "host:disconnect:10.0.0.2:5555",
+			reply: "disconnected 10.0.0.2:5555",
+		},
+		{
+			name:  "disconnected everything",
+			op:    func(d *Driver) error { return d.Disconnect("") },
+			req:   "host:disconnect:",
+			reply: "disconnected everything",
+		},
+		{
+			name:    "disconnect unknown device",
+			op:      func(d *Driver) error { return d.Disconnect("10.0.0.3:5555") },
+			req:     "host:disconnect:10.0.0.3:5555",
+			reply:   "no such device '10.0.0.3:5555'",
+			fail:    true,
+			wantErr: ErrDeviceNotFound,
+			wantMsg: "no such device '10.0.0.3:5555'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAdbServer(t)
+			if tt.fail {
+				server.onFail(tt.req, tt.reply)
+			} else {
+				server.onString(tt.req, tt.reply)
+			}
+
+			err := tt.op(newAdbDriver(t, server))
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("error = %v", err)
+				}
+				return
+			}
+
+			var wirelessErr *WirelessError
+			if !errors.As(err, &wirelessErr) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want a *WirelessError wrapping %v", err, tt.wantErr)
+			}
+			if wirelessErr.Message != tt.wantMsg {
+				t.Errorf("Message = %q, want %q", wirelessErr.Message, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestEnableTCPIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		wantErr error
+	}{
+		{"restarting", "restarting in TCP mode port: 5555\n", nil},
+		{"refused", "error: adbd cannot run as root in production builds\n", ErrTCPIPFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAdbServer(t).on("tcpip:5555", func(t *testing.T, conn net.Conn, _ string) {
+				io.WriteString(conn, "OKAY"+tt.reply)
+			})
+
+			err := newAdbDriver(t, server).EnableTCPIP(5555)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("EnableTCPIP() error = %v, want %v", err, tt.wantErr)
+			}
+
+			want := []string{"host:transport:emulator-5554", "tcpip:5555"}
+			if got := server.received(); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+				t.Errorf("requests = %q, want %q", got, want)
+			}
+		})
+	}
+}
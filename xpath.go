@@ -0,0 +1,251 @@
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/beevik/etree"
+)
+
+// XPathError reports an invalid XPath expression or a failed evaluation
+type XPathError struct {
+	Expr string // the expression
+	Pos  int    // byte offset of a syntax error in Expr, -1 for evaluation errors
+	Msg  string // what went wrong
+}
+
+func (e *XPathError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("xpath %q: %s", e.Expr, e.Msg)
+	}
+	return fmt.Sprintf("xpath %q: %s at offset %d", e.Expr, e.Msg, e.Pos)
+}
+
+// XPathQuote quotes a string as an XPath literal.
+// XPath 1.0 has no escape sequences, so a string holding both quote
+// characters is split into parts joined with concat().
+// Parameters:
+//   - s: the string to quote
+//
+// Returns:
+//   - string: s in single quotes, in double quotes if it holds a single quote,
+//     otherwise a concat() expression
+func XPathQuote(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+
+	// Don't say "yes" -> concat('Don', "'", 't say "yes"')
+	var parts []string
+	for i, part := range strings.Split(s, "'") {
+		if i > 0 {
+			parts = append(parts, `"'"`)
+		}
+		if part != "" {
+			parts = append(parts, "'"+part+"'")
+		}
+	}
+	return "concat(" + strings.Join(parts, ", ") + ")"
+}
+
+// XPath is an XPath 1.0 expression used as a Locator, e.g.
+// XPath(`//node[@text="OK"]`). Its methods build expressions, quoting values
+// with XPathQuote:
+//
+//	driver.NewXPath().Descendant("node").AttrEq("text", "Don't allow")
+//
+// gives //node[@text="Don't allow"]. The lookups report an invalid expression
+// with an *XPathError.
+type XPath string
+
+// NewXPath creates an empty expression, the following steps starting from the root
+func NewXPath() XPath {
+	return ""
+}
+
+// Self adds a . step, so that the following steps start from the searched element
+func (x XPath) Self() XPath {
+	x += "."
+	return x
+}
+
+// Child adds a step selecting the child elements with the given tag, * for any
+func (x XPath) Child(tag string) XPath {
+	x += XPath("/" + tag)
+	return x
+}
+
+// Descendant adds a step selecting the descendant elements with the given tag, * for any
+func (x XPath) Descendant(tag string) XPath {
+	x += XPath("//" + tag)
+	return x
+}
+
+// Parent adds a step selecting the parent element
+func (x XPath) Parent() XPath {
+	x += "/.."
+	return x
+}
+
+// HasAttr keeps the elements having an attribute
+func (x XPath) HasAttr(name string) XPath {
+	return x.Where("@" + name)
+}
+
+// AttrEq keeps the elements whose attribute equals value
+func (x XPath) AttrEq(name, value string) XPath {
+	return x.Where("@" + name + "=" + XPathQuote(value))
+}
+
+// AttrContains keeps the elements whose attribute contains value
+func (x XPath) AttrContains(name, value string) XPath {
+	return x.Where("contains(@" + name + ", " + XPathQuote(value) + ")")
+}
+
+// AttrStartsWith keeps the elements whose attribute starts with value
+func (x XPath) AttrStartsWith(name, value string) XPath {
+	return x.Where("starts-with(@" + name + ", " + XPathQuote(value) + ")")
+}
+
+// AttrEndsWith keeps the elements whose attribute ends with value.
+// XPath 1.0 has no ends-with(), so the end of the attribute is taken with substring().
+func (x XPath) AttrEndsWith(name, value string) XPath {
+	attr := "@" + name
+	n := utf8.RuneCountInString(value)
+	return x.Where(fmt.Sprintf("substring(%s, string-length(%s) - %d + 1)=%s", attr, attr, n, XPathQuote(value)))
+}
+
+// AttrNormalized keeps the elements whose attribute equals value once
+// whitespace is trimmed and collapsed, e.g. texts spanning several lines
+func (x XPath) AttrNormalized(name, value string) XPath {
+	return x.Where("normalize-space(@" + name + ")=" + XPathQuote(strings.Join(strings.Fields(value), " ")))
+}
+
+// Position keeps the element at a position among those selected by the step, from 1
+func (x XPath) Position(n int) XPath {
+	return x.Where(strconv.Itoa(n))
+}
+
+// Last keeps the last element selected by the step
+func (x XPath) Last() XPath {
+	return x.Where("last()")
+}
+
+// Where adds a raw predicate, values in it must be quoted with XPathQuote
+func (x XPath) Where(predicate string) XPath {
+	x += XPath("[" + predicate + "]")
+	return x
+}
+
+// String returns the expression
+func (x XPath) String() string {
+	return string(x)
+}
+
+// match reports whether the node is selected by the expression, evaluated
+// from the root once per search. Locating with an XPath alone evaluates it
+// from the searched element instead.
+func (x XPath) match(node *etree.Element, c *matchCache) bool {
+	return c.xpath(string(x), treeRoot(node))[node]
+}
+
+// SelectElement finds the first UI element matching the XPath expression,
+// like FindElement with an XPath. It only returns descendants of the current
+// node, the whole screen for a Document.
+// Parameters:
+//   - xpath: XPath 1.0 expression, e.g. `//node[contains(@text, "Pay")][1]`
+//
+// Returns:
+//   - Element: the first element in document order
+//   - error: *XPathError if the expression is invalid or does not select
+//     elements, ErrElementNotFound if nothing matches
+func (d *Document) SelectElement(xpath string) (Element, error) {
+	es, err := d.SelectElements(xpath)
+	if err != nil {
+		return nil, err
+	}
+	if len(es) == 0 {
+		return nil, ErrElementNotFound
+	}
+
+	return es[0], nil
+}
+
+// SelectElements finds all UI elements matching the XPath expression,
+// like FindElements with an XPath
+// Parameters:
+//   - xpath: XPath 1.0 expression
+//
+// Returns:
+//   - []Element: the elements in document order, nil if none matches
+//   - error: *XPathError if the expression is invalid or does not select elements
+func (d *Document) SelectElements(xpath string) ([]Element, error) {
+	scope := d.scope()
+
+	nodes, err := selectXPath(xpath, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	es := make([]Element, 0, len(nodes))
+	for _, node := range nodes {
+		es = append(es, d.newElement(scope, node))
+	}
+
+	return es, nil
+}
+
+// selectXPath evaluates an expression from scope and keeps the elements below
+// it, so that an absolute path such as //node only searches the descendants
+// of an element
+func selectXPath(expr string, scope *etree.Element) ([]*etree.Element, error) {
+	nodes, err := evalXPath(expr, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	below := nodes[:0]
+	for _, node := range nodes {
+		if isAncestor(scope, node) {
+			below = append(below, node)
+		}
+	}
+	return below, nil
+}
+
+// evalXPath evaluates an expression selecting elements, from the context element
+func evalXPath(expr string, context *etree.Element) ([]*etree.Element, error) {
+	compiled, err := compileXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &xcontext{node: xnode{el: context}, pos: 1, size: 1, order: documentOrder(context)}
+	v, err := compiled.eval(ctx)
+	if err != nil {
+		return nil, &XPathError{Expr: expr, Pos: -1, Msg: err.Error()}
+	}
+
+	nodes, ok := v.([]xnode)
+	if !ok {
+		return nil, &XPathError{Expr: expr, Pos: -1, Msg: fmt.Sprintf("result is a %s, not elements", typeName(v))}
+	}
+
+	els := make([]*etree.Element, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.isElement() {
+			return nil, &XPathError{Expr: expr, Pos: -1, Msg: "result holds attributes or texts, not elements only"}
+		}
+		els = append(els, node.el)
+	}
+
+	return els, nil
+}
@@ -0,0 +1,265 @@
+package driver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// xpathHierarchy is a list of three items followed by a total
+const xpathHierarchy = `<?xml version="1.0" encoding="UTF-8"?>
+<hierarchy rotation="0">
+  <node index="0" text="" resource-id="app:id/list" class="android.widget.ListView">
+    <node index="0" text="Apple" resource-id="app:id/item" class="android.widget.TextView"/>
+    <node index="1" text="Banana" resource-id="app:id/item" class="android.widget.TextView"/>
+    <node index="2" text="Don't say &quot;yes&quot;" resource-id="app:id/item" class="android.widget.TextView"/>
+  </node>
+  <node index="1" text="  Total:   3  " resource-id="app:id/total" class="android.widget.TextView"/>
+</hierarchy>`
+
+// parseHierarchy parses a hierarchy dump, returning its root
+func parseHierarchy(t *testing.T, xml string) *etree.Element {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(xml); err != nil {
+		t.Fatal(err)
+	}
+	return &doc.Element
+}
+
+// nodeNames names nodes by text, by resource id for nodes without text
+func nodeNames(nodes []*etree.Element) string {
+	names := make([]string, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.SelectAttrValue("text", "")
+		if names[i] == "" {
+			names[i] = node.SelectAttrValue("resource-id", node.Tag)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func TestEvalXPath(t *testing.T) {
+	root := parseHierarchy(t, xpathHierarchy)
+	const dont = `Don't say "yes"`
+
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		// Paths and axes
+		{"descendants", `//node[@resource-id='app:id/item']`, "Apple,Banana," + dont},
+		{"absolute", `/hierarchy/node[2]`, "  Total:   3  "},
+		{"any tag", `/*/*`, "app:id/list,  Total:   3  "},
+		{"parent", `//node[@text='Banana']/parent::node`, "app:id/list"},
+		{"abbreviated parent", `//node[@text='Banana']/..`, "app:id/list"},
+		{"self", `//node[@text='Banana']/self::node`, "Banana"},
+		{"ancestors", `//node[@text='Banana']/ancestor::*`, "hierarchy,app:id/list"},
+		{"ancestor or self", `//node[@text='Apple']/ancestor-or-self::node`, "app:id/list,Apple"},
+		{"nearest ancestor", `//node[@text='Banana']/ancestor::*[1]`, "app:id/list"},
+		{"following siblings", `//node[@text='Apple']/following-sibling::node`, "Banana," + dont},
+		{"next sibling", `//node[@text='Apple']/following-sibling::node[1]`, "Banana"},
+		{"preceding siblings", `//node[@text='Banana']/preceding-sibling::node`, "Apple"},
+		{"previous sibling", `//node[@index=2]/preceding-sibling::node[1]`, "Banana"},
+		{"children", `//node[@resource-id='app:id/list']/child::node`, "Apple,Banana," + dont},
+		{"descendant axis", `/hierarchy/descendant::node[@index=1]`, "Banana,  Total:   3  "},
+		{"union in document order", `//node[@text='Banana'] | //node[@text='Apple']`, "Apple,Banana"},
+		{"no text children", `//node[text()]`, ""},
+
+		// Predicates
+		{"position", `//node[@resource-id='app:id/item'][2]`, "Banana"},
+		{"last", `//node[@resource-id='app:id/item'][last()]`, dont},
+		{"before last", `//node[@resource-id='app:id/item'][position() < last()]`, "Apple,Banana"},
+		{"position per parent", `//node[1]`, "app:id/list,Apple"},
+		{"position of the set", `(//node)[1]`, "app:id/list"},
+		{"last of the set", `(//node[@resource-id='app:id/item'])[last()]`, dont},
+		{"chained predicates", `//node[@resource-id='app:id/item'][@index > 0][1]`, "Banana"},
+		{"and", `//node[@index > 0 and @resource-id='app:id/item']`, "Banana," + dont},
+		{"or", `//node[@text='Apple' or @resource-id='app:id/total']`, "Apple,  Total:   3  "},
+		{"not", `//node[@resource-id='app:id/item'][not(@text='Banana')]`, "Apple," + dont},
+		{"mod", `//node[@resource-id='app:id/item'][@index mod 2 = 0]`, "Apple," + dont},
+		{"arithmetic", `//node[@index * 2 - 1 = 3]`, dont},
+		{"count", `//node[count(node) = 3]`, "app:id/list"},
+		{"attribute exists", `//node[@text and @text != '']`, "Apple,Banana," + dont + ",  Total:   3  "},
+
+		// Functions
+		{"contains", `//node[contains(@text, 'an')]`, "Banana"},
+		{"starts-with", `//node[starts-with(@text, 'Ba')]`, "Banana"},
+		{"ends-with extension", `//node[ends-with(@text, 'ple')]`, "Apple"},
+		{"substring", `//node[substring(@text, 2, 3) = 'ana']`, "Banana"},
+		{"substring-before", `//node[substring-before(@resource-id, '/') = 'app:id']`, "app:id/list,Apple,Banana," + dont + ",  Total:   3  "},
+		{"substring-after", `//node[substring-after(@resource-id, '/') = 'total']`, "  Total:   3  "},
+		{"string-length", `//node[string-length(@text) = 5]`, "Apple"},
+		{"normalize-space", `//node[normalize-space(@text) = 'Total: 3']`, "  Total:   3  "},
+		{"translate", `//node[translate(@text, 'abn', 'ABN') = 'BANANA']`, "Banana"},
+		{"number", `//node[number(@index) = 2]`, dont},
+		{"name", `//*[name() = 'node'][@index = 2]`, dont},
+
+		// Quoting
+		{"concat quoting", `//node[@text=concat('Don', "'", 't say "yes"')]`, dont},
+		{"builder quoting", NewXPath().Descendant("node").AttrEq("text", dont).String(), dont},
+		{"builder ends with", NewXPath().Descendant("node").AttrEndsWith("resource-id", "/total").String(), "  Total:   3  "},
+		{"builder ends with quote", NewXPath().Descendant("node").AttrEndsWith("text", `"yes"`).String(), dont},
+		{"builder last", NewXPath().Descendant("node").AttrEq("resource-id", "app:id/item").Last().String(), dont},
+		{"builder parent", NewXPath().Descendant("node").AttrEq("text", "Apple").Parent().String(), "app:id/list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := evalXPath(tt.expr, root)
+			if err != nil {
+				t.Fatalf("evalXPath(%s) error = %v", tt.expr, err)
+			}
+			if got := nodeNames(nodes); got != tt.want {
+				t.Errorf("evalXPath(%s) = %q, want %q", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalXPathRelative(t *testing.T) {
+	root := parseHierarchy(t, xpathHierarchy)
+	list, _ := evalXPath(`//node[@resource-id='app:id/list']`, root)
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"node[2]", "Banana"},
+		{"./node[last()]", `Don't say "yes"`},
+		{".//node[@index=1]", "Banana"},
+		{"//node[@index=1]", "Banana,  Total:   3  "},
+		{"..", "hierarchy"},
+		{"following-sibling::node", "  Total:   3  "},
+	}
+
+	for _, tt := range tests {
+		nodes, err := evalXPath(tt.expr, list[0])
+		if err != nil {
+			t.Fatalf("evalXPath(%s) error = %v", tt.expr, err)
+		}
+		if got := nodeNames(nodes); got != tt.want {
+			t.Errorf("evalXPath(%s) from the list = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestXPathQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"OK", "'OK'"},
+		{"", "''"},
+		{"Don't", `"Don't"`},
+		{`say "yes"`, `'say "yes"'`},
+		{`Don't say "yes"`, `concat('Don', "'", 't say "yes"')`},
+		{`'"`, `concat("'", '"')`},
+		{`"'`, `concat('"', "'")`},
+		{`a''b"`, `concat('a', "'", "'", 'b"')`},
+	}
+
+	for _, tt := range tests {
+		if got := XPathQuote(tt.s); got != tt.want {
+			t.Errorf("XPathQuote(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+
+		// The quoted string selects a node holding it
+		node := etree.NewElement("node")
+		node.CreateAttr("text", tt.s)
+		parent := etree.NewElement("hierarchy")
+		parent.AddChild(node)
+
+		nodes, err := evalXPath("//node[@text="+XPathQuote(tt.s)+"]", parent)
+		if err != nil || len(nodes) != 1 {
+			t.Errorf("selecting %q = %v, %v, want the node", tt.s, nodes, err)
+		}
+	}
+}
+
+func TestXPathErrors(t *testing.T) {
+	root := parseHierarchy(t, xpathHierarchy)
+
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		// Syntax errors, at the offending token
+		{`//node[`, 7, "unexpected end of expression"},
+		{`//node]`, 6, `unexpected "]"`},
+		{`//node[@text='a]`, 13, "unterminated literal"},
+		{`//node[@text="a]`, 13, "unterminated literal"},
+		{`//node[foo()]`, 7, "unknown function foo()"},
+		{`//node[contains(@text)]`, 7, "wrong number of arguments to contains()"},
+		{`//node[last(1)]`, 7, "wrong number of arguments to last()"},
+		{`//following::node`, 2, `unsupported axis "following"`},
+		{`//comment()`, 2, "unsupported node test comment()"},
+		{`//node[1.2.3]`, 7, `invalid number "1.2.3"`},
+		{`//node[#]`, 7, `unexpected character '#'`},
+		{`//node[@text='a' 'b']`, 17, `unexpected literal "b"`},
+		{`//node[@text=]`, 13, `unexpected "]"`},
+		{`concat('a', 'b'`, 15, "unexpected end of expression"},
+		{`//node[@text='é' and #]`, 22, `unexpected character '#'`},
+
+		// Evaluation errors, without offset
+		{`count(//node)`, -1, "result is a number, not elements"},
+		{`//node/@text`, -1, "result holds attributes or texts, not elements only"},
+		{`1 | //node`, -1, "operands of | must be node-sets"},
+		{`'a'[1]`, -1, "predicate applied to a string, not a node-set"},
+		{`//node[count('a') = 1]`, -1, "count(): argument is a string, not a node-set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := evalXPath(tt.expr, root)
+
+			var xerr *XPathError
+			if !errors.As(err, &xerr) {
+				t.Fatalf("evalXPath() error = %v, want *XPathError", err)
+			}
+			if xerr.Expr != tt.expr || xerr.Pos != tt.pos || xerr.Msg != tt.msg {
+				t.Errorf("error = {%q %d %q}, want {%q %d %q}", xerr.Expr, xerr.Pos, xerr.Msg, tt.expr, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+func TestXPathMatchCache(t *testing.T) {
+	root := parseHierarchy(t, xpathHierarchy)
+	items := XPath(`//node[@resource-id="app:id/item"]`)
+
+	var c matchCache
+	var matched []*etree.Element
+	var walk func(parent *etree.Element)
+	walk = func(parent *etree.Element) {
+		for _, child := range parent.ChildElements() {
+			if items.match(child, &c) {
+				matched = append(matched, child)
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+
+	if got := nodeNames(matched); got != `Apple,Banana,Don't say "yes"` {
+		t.Errorf("matched %s", got)
+	}
+	// The expression is evaluated once for the whole hierarchy
+	if len(c.selected) != 1 {
+		t.Errorf("evaluated %d times, want once", len(c.selected))
+	}
+
+	// Another hierarchy is evaluated on its own
+	other := parseHierarchy(t, xpathHierarchy)
+	if items.match(other.FindElement("//node"), &c) {
+		t.Error("the list of another hierarchy matched")
+	}
+	if len(c.selected) != 2 {
+		t.Errorf("%d evaluations cached, want 2", len(c.selected))
+	}
+}
@@ -0,0 +1,1242 @@
+package driver
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/beevik/etree"
+)
+
+// This file implements the subset of XPath 1.0 used on hierarchy dumps:
+// location paths with the usual axes, predicates, operators, and the core
+// string, number and node-set functions, plus ends-with() of XPath 2.0 as a
+// non-standard extension. Variables, namespaces and the following / preceding
+// axes are not supported.
+
+// xtoken is a lexical token of an XPath expression
+type xtoken struct {
+	kind xtokenKind
+	text string  // name, operator or literal value
+	num  float64 // value of a number
+	pos  int     // byte offset in the expression
+}
+
+type xtokenKind int
+
+const (
+	xtEOF      xtokenKind = iota
+	xtName                // NCName, or * as a name test
+	xtOperator            // and, or, div, mod, *, |, +, -, =, !=, <, <=, >, >=
+	xtPunct               // / // [ ] ( ) @ , . .. ::
+	xtString              // literal
+	xtNumber              // number
+)
+
+// xlex splits an XPath expression into tokens
+func xlex(expr string) ([]xtoken, error) {
+	var tokens []xtoken
+
+	// A * or a name is an operator if it follows a token ending an operand,
+	// as decided by section 3.7 of the XPath 1.0 specification
+	operand := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		switch last.kind {
+		case xtOperator:
+			return false
+		case xtPunct:
+			switch last.text {
+			case "@", "::", "(", "[", ",", "/", "//":
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, &XPathError{Expr: expr, Pos: i, Msg: "unterminated literal"}
+			}
+			tokens = append(tokens, xtoken{kind: xtString, text: expr[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(expr) && expr[i+1] >= '0' && expr[i+1] <= '9':
+			start := i
+			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(expr[start:i], 64)
+			if err != nil {
+				return nil, &XPathError{Expr: expr, Pos: start, Msg: "invalid number " + strconv.Quote(expr[start:i])}
+			}
+			tokens = append(tokens, xtoken{kind: xtNumber, num: num, text: expr[start:i], pos: start})
+
+		case c == '*':
+			kind := xtName
+			if operand() {
+				kind = xtOperator
+			}
+			tokens = append(tokens, xtoken{kind: kind, text: "*", pos: i})
+			i++
+
+		case isNameStart(expr[i:]):
+			start := i
+			for i < len(expr) && isNameChar(expr[i:]) {
+				_, size := utf8.DecodeRuneInString(expr[i:])
+				i += size
+			}
+			name := expr[start:i]
+			kind := xtName
+			if operand() && (name == "and" || name == "or" || name == "div" || name == "mod") {
+				kind = xtOperator
+			}
+			tokens = append(tokens, xtoken{kind: kind, text: name, pos: start})
+
+		default:
+			op, kind := "", xtPunct
+			for _, candidate := range []string{"//", "..", "::", "!=", "<=", ">=", "/", "[", "]", "(", ")", "@", ",", ".", "|", "+", "-", "=", "<", ">"} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			switch op {
+			case "":
+				return nil, &XPathError{Expr: expr, Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			case "!=", "<=", ">=", "|", "+", "-", "=", "<", ">":
+				kind = xtOperator
+			}
+			tokens = append(tokens, xtoken{kind: kind, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, xtoken{kind: xtEOF, pos: len(expr)}), nil
+}
+
+// isNameStart reports whether s starts with a character starting a name
+func isNameStart(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// isNameChar reports whether s starts with a character allowed in a name
+func isNameChar(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// xexpr is a compiled XPath expression
+type xexpr interface {
+	eval(ctx *xcontext) (any, error)
+}
+
+// xcontext is the evaluation context: the context node, its position and
+// the size of the context node set, plus the document order of the tree
+type xcontext struct {
+	node  xnode
+	pos   int
+	size  int
+	order map[any]int
+}
+
+// xnode is a node of the tree: an element, or an attribute or a text of an element
+type xnode struct {
+	el   *etree.Element
+	attr *etree.Attr
+	text *etree.CharData
+}
+
+// key identifies the node, for document order and deduplication
+func (n xnode) key() any {
+	switch {
+	case n.attr != nil:
+		return n.attr
+	case n.text != nil:
+		return n.text
+	}
+	return n.el
+}
+
+// isElement reports whether the node is an element, the root included
+func (n xnode) isElement() bool {
+	return n.attr == nil && n.text == nil
+}
+
+// isRoot reports whether the node is the document root, the parent of the top element
+func (n xnode) isRoot() bool {
+	return n.isElement() && n.el.Parent() == nil && n.el.Tag == ""
+}
+
+// stringValue returns the string value of the node
+func (n xnode) stringValue() string {
+	switch {
+	case n.attr != nil:
+		return n.attr.Value
+	case n.text != nil:
+		return n.text.Data
+	}
+
+	var b strings.Builder
+	var walk func(el *etree.Element)
+	walk = func(el *etree.Element) {
+		for _, child := range el.Child {
+			switch child := child.(type) {
+			case *etree.CharData:
+				b.WriteString(child.Data)
+			case *etree.Element:
+				walk(child)
+			}
+		}
+	}
+	walk(n.el)
+	return b.String()
+}
+
+// xparser is a recursive descent parser of XPath expressions
+type xparser struct {
+	expr   string
+	tokens []xtoken
+	i      int
+}
+
+// compileXPath parses an XPath expression
+func compileXPath(expr string) (xexpr, error) {
+	tokens, err := xlex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &xparser{expr: expr, tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != xtEOF {
+		return nil, p.unexpected()
+	}
+	return e, nil
+}
+
+func (p *xparser) peek() xtoken {
+	return p.tokens[p.i]
+}
+
+func (p *xparser) next() xtoken {
+	t := p.tokens[p.i]
+	if t.kind != xtEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the next token is the operator or punctuation s
+func (p *xparser) is(s string) bool {
+	t := p.peek()
+	return (t.kind == xtOperator || t.kind == xtPunct) && t.text == s
+}
+
+// lookahead reports whether the token after the next one is the punctuation s
+func (p *xparser) lookahead(s string) bool {
+	t := p.tokens[min(p.i+1, len(p.tokens)-1)]
+	return t.kind == xtPunct && t.text == s
+}
+
+// expect consumes the punctuation s
+func (p *xparser) expect(s string) error {
+	if !p.is(s) {
+		return p.unexpected()
+	}
+	p.next()
+	return nil
+}
+
+// errorf creates a syntax error at the next token
+func (p *xparser) errorf(format string, args ...any) error {
+	return &XPathError{Expr: p.expr, Pos: p.peek().pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// unexpected creates an error for the next token
+func (p *xparser) unexpected() error {
+	t := p.peek()
+	switch t.kind {
+	case xtEOF:
+		return p.errorf("unexpected end of expression")
+	case xtString:
+		return p.errorf("unexpected literal %q", t.text)
+	}
+	return p.errorf("unexpected %q", t.text)
+}
+
+// parseBinary parses operands separated by the given operators, left to right
+func (p *xparser) parseBinary(operand func() (xexpr, error), ops ...string) (xexpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.kind != xtOperator || !slices.Contains(ops, t.text) {
+			return left, nil
+		}
+		p.next()
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &xbinary{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *xparser) parseOr() (xexpr, error) {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *xparser) parseAnd() (xexpr, error) {
+	return p.parseBinary(p.parseEquality, "and")
+}
+
+func (p *xparser) parseEquality() (xexpr, error) {
+	return p.parseBinary(p.parseRelational, "=", "!=")
+}
+
+func (p *xparser) parseRelational() (xexpr, error) {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *xparser) parseAdditive() (xexpr, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *xparser) parseMultiplicative() (xexpr, error) {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *xparser) parseUnary() (xexpr, error) {
+	if p.is("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &xnegate{operand: operand}, nil
+	}
+	return p.parseBinary(p.parsePath, "|")
+}
+
+// parsePath parses a location path, or a filter expression optionally followed by a path
+func (p *xparser) parsePath() (xexpr, error) {
+	t := p.peek()
+
+	var filter xexpr
+	switch {
+	case t.kind == xtString:
+		p.next()
+		filter = xliteral{value: t.text}
+	case t.kind == xtNumber:
+		p.next()
+		filter = xliteral{value: t.num}
+	case p.is("("):
+		p.next()
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		filter = e
+	case t.kind == xtName && t.text != "*" && p.lookahead("(") && !isNodeType(t.text):
+		call, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		filter = call
+	}
+
+	if filter == nil {
+		return p.parseLocationPath()
+	}
+
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	if len(preds) > 0 {
+		filter = &xfilter{expr: filter, preds: preds}
+	}
+
+	if !p.is("/") && !p.is("//") {
+		return filter, nil
+	}
+
+	steps, err := p.parseRelativePath()
+	if err != nil {
+		return nil, err
+	}
+	return &xlocation{start: filter, steps: steps}, nil
+}
+
+// parseLocationPath parses an absolute or relative location path
+func (p *xparser) parseLocationPath() (xexpr, error) {
+	path := &xlocation{}
+
+	if p.is("/") {
+		path.absolute = true
+		p.next()
+
+		// "/" alone selects the root
+		t := p.peek()
+		if t.kind != xtName && !p.is("@") && !p.is(".") && !p.is("..") {
+			return path, nil
+		}
+	} else if p.is("//") {
+		path.absolute = true
+	}
+
+	steps, err := p.parseRelativePath()
+	if err != nil {
+		return nil, err
+	}
+	path.steps = steps
+	return path, nil
+}
+
+// parseRelativePath parses steps separated by / or //, a leading separator included
+func (p *xparser) parseRelativePath() ([]*xstep, error) {
+	var steps []*xstep
+
+	for first := true; ; first = false {
+		switch {
+		case p.is("//"):
+			p.next()
+			steps = append(steps, &xstep{axis: "descendant-or-self", test: "node()"})
+		case p.is("/"):
+			p.next()
+		case !first:
+			return steps, nil
+		}
+
+		step, err := p.parseStep()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+}
+
+// parseStep parses a step: an axis, a node test and predicates
+func (p *xparser) parseStep() (*xstep, error) {
+	switch {
+	case p.is("."):
+		p.next()
+		return &xstep{axis: "self", test: "node()"}, nil
+	case p.is(".."):
+		p.next()
+		return &xstep{axis: "parent", test: "node()"}, nil
+	}
+
+	step := &xstep{axis: "child"}
+	if p.is("@") {
+		p.next()
+		step.axis = "attribute"
+	} else if t := p.peek(); t.kind == xtName && p.lookahead("::") {
+		if !slices.Contains(xaxes, t.text) {
+			return nil, p.errorf("unsupported axis %q", t.text)
+		}
+		p.next()
+		p.next()
+		step.axis = t.text
+	}
+
+	t := p.peek()
+	if t.kind != xtName {
+		return nil, p.unexpected()
+	}
+	p.next()
+	step.test = t.text
+
+	if isNodeType(t.text) && p.is("(") {
+		if t.text != "node" && t.text != "text" {
+			return nil, &XPathError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf("unsupported node test %s()", t.text)}
+		}
+		p.next()
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		step.test = t.text + "()"
+	}
+
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	step.preds = preds
+	return step, nil
+}
+
+// parsePredicates parses the predicates following a step or a filter expression
+func (p *xparser) parsePredicates() ([]xexpr, error) {
+	var preds []xexpr
+	for p.is("[") {
+		p.next()
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+	}
+	return preds, nil
+}
+
+// parseCall parses a function call, checking the function and its arity
+func (p *xparser) parseCall() (xexpr, error) {
+	name := p.next()
+	p.next() // (
+
+	var args []xexpr
+	for !p.is(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // )
+
+	fn, ok := xfunctions[name.text]
+	if !ok {
+		return nil, &XPathError{Expr: p.expr, Pos: name.pos, Msg: fmt.Sprintf("unknown function %s()", name.text)}
+	}
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, &XPathError{Expr: p.expr, Pos: name.pos, Msg: fmt.Sprintf("wrong number of arguments to %s()", name.text)}
+	}
+
+	return &xcall{name: name.text, fn: fn, args: args}, nil
+}
+
+// isNodeType reports whether a name followed by ( is a node test rather than a function
+func isNodeType(name string) bool {
+	return name == "node" || name == "text" || name == "comment" || name == "processing-instruction"
+}
+
+// xaxes are the supported axes
+var xaxes = []string{
+	"ancestor", "ancestor-or-self", "attribute", "child", "descendant",
+	"descendant-or-self", "following-sibling", "parent", "preceding-sibling", "self",
+}
+
+// xliteral is a string or number literal
+type xliteral struct {
+	value any
+}
+
+func (l xliteral) eval(*xcontext) (any, error) {
+	return l.value, nil
+}
+
+// xnegate is the unary minus
+type xnegate struct {
+	operand xexpr
+}
+
+func (n *xnegate) eval(ctx *xcontext) (any, error) {
+	v, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -toNumber(v), nil
+}
+
+// xbinary is a binary operator
+type xbinary struct {
+	op          string
+	left, right xexpr
+}
+
+func (b *xbinary) eval(ctx *xcontext) (any, error) {
+	left, err := b.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short circuits
+	switch b.op {
+	case "and":
+		if !toBool(left) {
+			return false, nil
+		}
+	case "or":
+		if toBool(left) {
+			return true, nil
+		}
+	}
+
+	right, err := b.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch b.op {
+	case "and", "or":
+		return toBool(right), nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(b.op, left, right), nil
+	case "|":
+		l, lok := left.([]xnode)
+		r, rok := right.([]xnode)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operands of | must be node-sets")
+		}
+		return sortNodes(append(append([]xnode(nil), l...), r...), ctx.order), nil
+	}
+
+	x, y := toNumber(left), toNumber(right)
+	switch b.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "div":
+		return x / y, nil
+	default: // mod
+		return math.Mod(x, y), nil
+	}
+}
+
+// xfilter applies predicates to the node-set of an expression
+type xfilter struct {
+	expr  xexpr
+	preds []xexpr
+}
+
+func (f *xfilter) eval(ctx *xcontext) (any, error) {
+	v, err := f.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]xnode)
+	if !ok {
+		return nil, fmt.Errorf("predicate applied to a %s, not a node-set", typeName(v))
+	}
+	return applyPredicates(ctx, nodes, f.preds)
+}
+
+// xlocation is a location path, starting from the context node, the root or a filter expression
+type xlocation struct {
+	absolute bool
+	start    xexpr
+	steps    []*xstep
+}
+
+func (p *xlocation) eval(ctx *xcontext) (any, error) {
+	var nodes []xnode
+	switch {
+	case p.start != nil:
+		v, err := p.start.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if nodes, ok = v.([]xnode); !ok {
+			return nil, fmt.Errorf("path applied to a %s, not a node-set", typeName(v))
+		}
+	case p.absolute:
+		root := ctx.node.el
+		for root.Parent() != nil {
+			root = root.Parent()
+		}
+		nodes = []xnode{{el: root}}
+	default:
+		nodes = []xnode{ctx.node}
+	}
+
+	for _, step := range p.steps {
+		var next []xnode
+		for _, node := range nodes {
+			selected, err := step.eval(ctx, node)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		nodes = sortNodes(next, ctx.order)
+	}
+
+	return nodes, nil
+}
+
+// xstep is a step of a location path
+type xstep struct {
+	axis  string
+	test  string // name, *, node() or text()
+	preds []xexpr
+}
+
+// eval selects the nodes of the step from node, in document order
+func (s *xstep) eval(ctx *xcontext, node xnode) ([]xnode, error) {
+	var selected []xnode
+	for _, candidate := range axisNodes(s.axis, node) {
+		if s.matches(candidate) {
+			selected = append(selected, candidate)
+		}
+	}
+
+	// Positions count backwards on reverse axes
+	reverse := s.axis == "ancestor" || s.axis == "ancestor-or-self" || s.axis == "preceding-sibling" || s.axis == "parent"
+	if reverse {
+		reverseNodes(selected)
+	}
+
+	selected, err := applyPredicates(ctx, selected, s.preds)
+	if err != nil {
+		return nil, err
+	}
+
+	if reverse {
+		reverseNodes(selected)
+	}
+	return selected, nil
+}
+
+// matches reports whether a node passes the node test
+func (s *xstep) matches(node xnode) bool {
+	switch s.test {
+	case "node()":
+		return true
+	case "text()":
+		return node.text != nil
+	}
+
+	if s.axis == "attribute" {
+		return node.attr != nil && (s.test == "*" || node.attr.Key == s.test)
+	}
+	if !node.isElement() || node.isRoot() {
+		return false
+	}
+	return s.test == "*" || node.el.Tag == s.test
+}
+
+// axisNodes returns the nodes of an axis in document order
+func axisNodes(axis string, node xnode) []xnode {
+	var nodes []xnode
+
+	children := func(el *etree.Element) []xnode {
+		var children []xnode
+		for _, child := range el.Child {
+			switch child := child.(type) {
+			case *etree.Element:
+				children = append(children, xnode{el: child})
+			case *etree.CharData:
+				if !child.IsWhitespace() {
+					children = append(children, xnode{el: el, text: child})
+				}
+			}
+		}
+		return children
+	}
+
+	var descendants func(el *etree.Element)
+	descendants = func(el *etree.Element) {
+		for _, child := range children(el) {
+			nodes = append(nodes, child)
+			if child.isElement() {
+				descendants(child.el)
+			}
+		}
+	}
+
+	// The parent of an attribute or a text is its element
+	parent := func() (xnode, bool) {
+		if !node.isElement() {
+			return xnode{el: node.el}, true
+		}
+		if node.el.Parent() == nil {
+			return xnode{}, false
+		}
+		return xnode{el: node.el.Parent()}, true
+	}
+
+	switch axis {
+	case "self":
+		nodes = append(nodes, node)
+	case "child":
+		if node.isElement() {
+			nodes = children(node.el)
+		}
+	case "descendant", "descendant-or-self":
+		if axis == "descendant-or-self" {
+			nodes = append(nodes, node)
+		}
+		if node.isElement() {
+			descendants(node.el)
+		}
+	case "attribute":
+		if node.isElement() {
+			for i := range node.el.Attr {
+				nodes = append(nodes, xnode{el: node.el, attr: &node.el.Attr[i]})
+			}
+		}
+	case "parent":
+		if p, ok := parent(); ok {
+			nodes = append(nodes, p)
+		}
+	case "ancestor", "ancestor-or-self":
+		if axis == "ancestor-or-self" {
+			nodes = append(nodes, node)
+		}
+		p, ok := parent()
+		for ok {
+			nodes = append([]xnode{p}, nodes...)
+			if ok = p.el.Parent() != nil; ok {
+				p = xnode{el: p.el.Parent()}
+			}
+		}
+	case "following-sibling", "preceding-sibling":
+		if node.attr != nil {
+			break
+		}
+		p, ok := parent()
+		if !ok {
+			break
+		}
+		siblings := children(p.el)
+		for i, sibling := range siblings {
+			if sibling.key() != node.key() {
+				continue
+			}
+			if axis == "following-sibling" {
+				nodes = siblings[i+1:]
+			} else {
+				nodes = siblings[:i]
+			}
+			break
+		}
+	}
+
+	return nodes
+}
+
+// applyPredicates filters nodes, in axis order, with each predicate in turn
+func applyPredicates(ctx *xcontext, nodes []xnode, preds []xexpr) ([]xnode, error) {
+	for _, pred := range preds {
+		var kept []xnode
+		for i, node := range nodes {
+			v, err := pred.eval(&xcontext{node: node, pos: i + 1, size: len(nodes), order: ctx.order})
+			if err != nil {
+				return nil, err
+			}
+
+			// A number selects by position
+			var keep bool
+			if n, ok := v.(float64); ok {
+				keep = n == float64(i+1)
+			} else {
+				keep = toBool(v)
+			}
+			if keep {
+				kept = append(kept, node)
+			}
+		}
+		nodes = kept
+	}
+	return nodes, nil
+}
+
+// xcall is a function call
+type xcall struct {
+	name string
+	fn   xfunction
+	args []xexpr
+}
+
+func (c *xcall) eval(ctx *xcontext) (any, error) {
+	args := make([]any, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	v, err := c.fn.call(ctx, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s(): %w", c.name, err)
+	}
+	return v, nil
+}
+
+// xfunction is a function of the XPath core library
+type xfunction struct {
+	min, max int // number of arguments, max -1 if unbounded
+	call     func(ctx *xcontext, args []any) (any, error)
+}
+
+// xfunctions are the supported functions, ends-with coming from XPath 2.0
+var xfunctions = map[string]xfunction{
+	"last": {call: func(ctx *xcontext, args []any) (any, error) {
+		return float64(ctx.size), nil
+	}},
+	"position": {call: func(ctx *xcontext, args []any) (any, error) {
+		return float64(ctx.pos), nil
+	}},
+	"count": {min: 1, max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		nodes, err := nodesArg(ctx, args)
+		return float64(len(nodes)), err
+	}},
+	"name": {max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		nodes, err := nodesArg(ctx, args)
+		if err != nil || len(nodes) == 0 {
+			return "", err
+		}
+		switch n := nodes[0]; {
+		case n.attr != nil:
+			return n.attr.Key, nil
+		case n.isElement():
+			return n.el.Tag, nil
+		}
+		return "", nil
+	}},
+	"string": {max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return stringArg(ctx, args), nil
+	}},
+	"concat": {min: 2, max: -1, call: func(ctx *xcontext, args []any) (any, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(toString(arg))
+		}
+		return b.String(), nil
+	}},
+	"contains":    stringsFunc(func(s, t string) any { return strings.Contains(s, t) }),
+	"starts-with": stringsFunc(func(s, t string) any { return strings.HasPrefix(s, t) }),
+	"ends-with":   stringsFunc(func(s, t string) any { return strings.HasSuffix(s, t) }),
+	"substring-before": stringsFunc(func(s, t string) any {
+		before, _, _ := strings.Cut(s, t)
+		return before
+	}),
+	"substring-after": stringsFunc(func(s, t string) any {
+		_, after, _ := strings.Cut(s, t)
+		return after
+	}),
+	"substring": {min: 2, max: 3, call: func(ctx *xcontext, args []any) (any, error) {
+		start := math.Round(toNumber(args[1]))
+		end := math.Inf(1)
+		if len(args) == 3 {
+			end = start + math.Round(toNumber(args[2]))
+		}
+
+		// Characters are counted from 1, and kept if start <= position < end
+		var b strings.Builder
+		for i, r := range []rune(toString(args[0])) {
+			if pos := float64(i + 1); pos >= start && pos < end {
+				b.WriteRune(r)
+			}
+		}
+		return b.String(), nil
+	}},
+	"string-length": {max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return float64(utf8.RuneCountInString(stringArg(ctx, args))), nil
+	}},
+	"normalize-space": {max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return strings.Join(strings.Fields(stringArg(ctx, args)), " "), nil
+	}},
+	"translate": {min: 3, max: 3, call: func(ctx *xcontext, args []any) (any, error) {
+		from, to := []rune(toString(args[1])), []rune(toString(args[2]))
+		return strings.Map(func(r rune) rune {
+			i := slices.Index(from, r)
+			switch {
+			case i < 0:
+				return r
+			case i < len(to):
+				return to[i]
+			}
+			return -1
+		}, toString(args[0])), nil
+	}},
+	"boolean": {min: 1, max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return toBool(args[0]), nil
+	}},
+	"not": {min: 1, max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return !toBool(args[0]), nil
+	}},
+	"true": {call: func(ctx *xcontext, args []any) (any, error) {
+		return true, nil
+	}},
+	"false": {call: func(ctx *xcontext, args []any) (any, error) {
+		return false, nil
+	}},
+	"number": {max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		if len(args) == 0 {
+			return toNumber(ctx.node.stringValue()), nil
+		}
+		return toNumber(args[0]), nil
+	}},
+	"sum": {min: 1, max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		nodes, err := nodesArg(ctx, args)
+		var sum float64
+		for _, node := range nodes {
+			sum += toNumber(node.stringValue())
+		}
+		return sum, err
+	}},
+	"floor":   numberFunc(math.Floor),
+	"ceiling": numberFunc(math.Ceil),
+	"round": numberFunc(func(x float64) float64 {
+		// Halves round towards positive infinity
+		return math.Floor(x + 0.5)
+	}),
+}
+
+// stringArg returns the first argument as a string, the context node by default
+func stringArg(ctx *xcontext, args []any) string {
+	if len(args) == 0 {
+		return ctx.node.stringValue()
+	}
+	return toString(args[0])
+}
+
+// nodesArg returns the first argument as a node-set, the context node by default
+func nodesArg(ctx *xcontext, args []any) ([]xnode, error) {
+	if len(args) == 0 {
+		return []xnode{ctx.node}, nil
+	}
+	nodes, ok := args[0].([]xnode)
+	if !ok {
+		return nil, fmt.Errorf("argument is a %s, not a node-set", typeName(args[0]))
+	}
+	return nodes, nil
+}
+
+// stringsFunc creates a function of two strings
+func stringsFunc(fn func(s, t string) any) xfunction {
+	return xfunction{min: 2, max: 2, call: func(ctx *xcontext, args []any) (any, error) {
+		return fn(toString(args[0]), toString(args[1])), nil
+	}}
+}
+
+// numberFunc creates a function of a number
+func numberFunc(fn func(x float64) float64) xfunction {
+	return xfunction{min: 1, max: 1, call: func(ctx *xcontext, args []any) (any, error) {
+		return fn(toNumber(args[0])), nil
+	}}
+}
+
+// compare applies a comparison operator following the XPath 1.0 rules:
+// a node-set compares true if any of its nodes does
+func compare(op string, left, right any) bool {
+	if nodes, ok := left.([]xnode); ok {
+		if _, ok := right.(bool); ok {
+			return compareValues(op, toBool(left), right)
+		}
+		for _, node := range nodes {
+			if compare(op, node.stringValue(), right) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if nodes, ok := right.([]xnode); ok {
+		if _, ok := left.(bool); ok {
+			return compareValues(op, left, toBool(right))
+		}
+		for _, node := range nodes {
+			if compare(op, left, node.stringValue()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return compareValues(op, left, right)
+}
+
+// compareValues compares two values that are not node-sets
+func compareValues(op string, left, right any) bool {
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, lb := left.(bool)
+		_, rb := right.(bool)
+		_, ln := left.(float64)
+		_, rn := right.(float64)
+		switch {
+		case lb || rb:
+			equal = toBool(left) == toBool(right)
+		case ln || rn:
+			equal = toNumber(left) == toNumber(right)
+		default:
+			equal = toString(left) == toString(right)
+		}
+		return equal == (op == "=")
+	}
+
+	x, y := toNumber(left), toNumber(right)
+	switch op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	default:
+		return x >= y
+	}
+}
+
+// toString converts a value with the string() function rules
+func toString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == math.Trunc(v) && math.Abs(v) < 1e15:
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []xnode:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	}
+	return ""
+}
+
+// toNumber converts a value with the number() function rules
+func toNumber(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+
+	s := strings.TrimSpace(toString(v))
+	if !xnumber.MatchString(s) {
+		return math.NaN()
+	}
+	n, _ := strconv.ParseFloat(s, 64)
+	return n
+}
+
+// xnumber matches the strings number() converts, without exponents nor signs other than -
+var xnumber = regexp.MustCompile(`^-?(\d+(\.\d*)?|\.\d+)$`)
+
+// toBool converts a value with the boolean() function rules
+func toBool(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []xnode:
+		return len(v) > 0
+	}
+	return false
+}
+
+// typeName names the XPath type of a value, for errors
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "node-set"
+}
+
+// documentOrder numbers the nodes of the tree holding node in document order
+func documentOrder(node *etree.Element) map[any]int {
+	root := node
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+
+	order := make(map[any]int)
+	var walk func(el *etree.Element)
+	walk = func(el *etree.Element) {
+		order[el] = len(order)
+		for i := range el.Attr {
+			order[&el.Attr[i]] = len(order)
+		}
+		for _, child := range el.Child {
+			switch child := child.(type) {
+			case *etree.Element:
+				walk(child)
+			case *etree.CharData:
+				order[child] = len(order)
+			}
+		}
+	}
+	walk(root)
+
+	return order
+}
+
+// sortNodes sorts nodes in document order and removes duplicates
+func sortNodes(nodes []xnode, order map[any]int) []xnode {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return order[nodes[i].key()] < order[nodes[j].key()]
+	})
+
+	unique := nodes[:0]
+	for i, node := range nodes {
+		if i == 0 || node.key() != nodes[i-1].key() {
+			unique = append(unique, node)
+		}
+	}
+	return unique
+}
+
+// reverseNodes reverses nodes in place
+func reverseNodes(nodes []xnode) {
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+}